@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,75 +16,109 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-contrib/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/handlers"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/middleware"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
 	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/router"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/database/memory"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/database/postgres/repositories"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/metrics"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
 	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/store"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/mahimapatel13/ride-sharing-system/internal/config"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/matching"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/rider"
 	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/worker"
 )
 
+// cabMetricsInterval is how often the cabs per status gauge is refreshed
+const cabMetricsInterval = 15 * time.Second
+
+// shutdownTimeout bounds the whole shutdown, from closing the listener to
+// closing the connections
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	log.Printf("Bootstrapping sytem..")
 
 	log.Printf("Loading .env ..")
 	cfg := config.LoadEnv()
 
-    ctx := context.Background()
+    // structured logger handed to every component, the standard logger
+    // writes through it as well
+	logger, err := logging.New(os.Stdout, cfg.LoggingConfig.Level, cfg.LoggingConfig.Format)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	slog.SetDefault(logger)
 
-    // setting up redis client
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisConfig.Address,
-		Password: cfg.RedisConfig.Password,
-		DB:       cfg.RedisConfig.DB,
-		Protocol: cfg.RedisConfig.Protocol,
-	})
+    // cancelled once the server has shut down, stops the background loops
+    ctx, stopBackground := context.WithCancel(context.Background())
+    defer stopBackground()
 
-	queueName := "ride-matching"
+    // tracing, spans are exported to stdout or an OTLP collector
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TracingConfig.Exporter, cfg.TracingConfig.OTLPEndpoint, cfg.TracingConfig.ServiceName)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
 
-    // configuring RabbitMQ queue options
-	queueOpts := queue.QueueOptions{
-		Name:       queueName,
-		Durable:    true,
-		AutoDelete: false,
-		Exclusive:  false,
-		NoWait:     false,
+    // connecting to the stores, queue and database, or keeping it all in process
+	var b backend
+	switch cfg.StorageBackend {
+	case "redis":
+		b = connectBackend(ctx, cfg, logger)
+	case "memory":
+		logger.Info("Using in-memory storage, state is lost on exit")
+		b = memoryBackend(cfg, logger)
+	default:
+		fatal("Unknown STORAGE_BACKEND, expected redis or memory", fmt.Errorf("storage backend %q", cfg.StorageBackend))
 	}
 
-    // establishing connection to RabbitMQ
-	mqConn, err := queue.ConnectRabbitMQ(cfg.RabbitMQConfig)
-	if err != nil {
-		log.Fatalf("Failed to connect to RabbitMQ: %s", err.Error())
+    // road network routing, straight lines for anything outside the graph
+	var roads routing.Router = routing.NewHaversineRouter(cfg.RoutingConfig.AvgSpeedKmh)
+	if cfg.RoutingConfig.GraphFile != "" {
+		graph, err := routing.LoadGraph(cfg.RoutingConfig.GraphFile, cfg.RoutingConfig.AvgSpeedKmh)
+		if err != nil {
+			fatal("Failed to load routing graph", err)
+		}
+		logger.Info("Loaded routing graph", "nodes", graph.Nodes())
+		roads = routing.WithFallback(graph, roads)
 	}
 
-    // creating a channel to communicate to RabbitMQ queue
-	mqChan, err := queue.CreateChannel(mqConn, queueName)
+    // selecting the matching strategy, per zone if configured
+	matchers, err := matching.NewSelector(cfg.MatchingConfig.Strategy, cfg.MatchingConfig.ZoneStrategies, cfg.MatchingConfig.AcceptanceWeight, roads)
 	if err != nil {
-		log.Fatalf("Failed to initialise RabbitMQ channel: %s", err.Error())
+		fatal("Failed to configure matching strategy", err)
 	}
 
-    // declaring a persistent RabbitMQ queue 
-	err = queue.DeclareQueue(mqChan.Channel,queueOpts)
-    if err != nil {
-        log.Fatalf("Failed to decalre RabbitMQ queue: %s", err.Error())
-    }
-
     // intialising worker pool object
-	workerPool := worker.NewPool(cfg.MaxWorkerCount, mqChan.Channel, queueName, redisClient)
+	workerPool := worker.NewPool(cfg.MaxWorkerCount, b.jobs, cfg.RabbitMQConfig.MaxRetries, b.cabs, b.locations, b.publisher, b.drivers, b.rideRepo, matchers, roads, logger)
+	workerPool.OfferTimeout = cfg.MatchingConfig.OfferTimeout
+	workerPool.Wait = worker.WaitOptions{
+		Limit:    cfg.MatchingConfig.WaitLimit,
+		Interval: cfg.MatchingConfig.WaitInterval,
+	}
+	workerPool.Batch = worker.BatchOptions{
+		Window:          cfg.MatchingConfig.BatchWindow,
+		RegionPrecision: cfg.MatchingConfig.BatchRegionPrecision,
+	}
     
     // starting the pool of workers
     workerPool.Run()
 
-    // connecting to database
-    db, err := pgxpool.New(ctx, fmt.Sprintf("user=%v password=%v host=%v port=%v dbname=%v", cfg.DatabaseConfig.User, cfg.DatabaseConfig.Password,cfg.DatabaseConfig.Host,cfg.DatabaseConfig.Port, cfg.DatabaseConfig.DatabaseName))
-
-    if err != nil{
-        log.Fatalf("Failed to connect to database: %s", err.Error())
-    }
-
     // setting up gin router
     r := gin.New()
-    r.Use(gin.Logger(), gin.Recovery())
+    r.Use(middleware.RequestID(), middleware.Logger(logger), gin.Recovery(), middleware.Metrics(), middleware.Tracing())
 
 	r.Use(cors.New(cors.Config{
         AllowOrigins:     []string{
@@ -89,9 +126,9 @@ func main() {
 
 		},
         AllowMethods:     []string{"POST", "GET", "OPTIONS", "PUT", "DELETE"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader},
         // CRITICAL: This allows your Interceptor to read the token!
-        ExposeHeaders:    []string{"Authorization"}, 
+        ExposeHeaders:    []string{"Authorization", middleware.RequestIDHeader}, 
         AllowCredentials: true,
         MaxAge:           12 * time.Hour,
     }))
@@ -99,15 +136,75 @@ func main() {
 
     // health check point
     r.GET("/health", func(c *gin.Context) {
-		if err := db.Ping(c.Request.Context()); err != nil {
+		if err := b.ping(c.Request.Context()); err != nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "database unavailable", "error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		state, err := b.queueState()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "queue unavailable", "queue": state, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "queue": state})
 	})
 
+    // prometheus metrics, cab counts are refreshed in the background
+    metrics.WatchQueueDepth(b.jobs.Depth)
+    go metrics.WatchCabs(ctx, cabMetricsInterval, b.cabs.CountByStatus)
+    r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+    // building the destination catalogue
+    hubs := make([]ride.Destination, len(cfg.HubConfig.Hubs))
+    for i, h := range cfg.HubConfig.Hubs {
+        hubs[i] = ride.Destination{Name: h.Name, Latitude: h.Lat, Longitude: h.Lng}
+    }
+
+    destinations, err := ride.NewDestinations(hubs, cfg.HubConfig.Default)
+    if err != nil {
+        fatal("Failed to load destination hubs", err)
+    }
+
+    // request validation, points have to lie inside the service area
+    fence := make(ride.GeoFence, len(cfg.ValidationConfig.ServiceAreas))
+    for i, a := range cfg.ValidationConfig.ServiceAreas {
+        fence[i] = ride.Area{Name: a.Name, MinLat: a.MinLat, MinLng: a.MinLng, MaxLat: a.MaxLat, MaxLng: a.MaxLng}
+    }
+    for _, h := range hubs {
+        if !fence.Contains(h.Latitude, h.Longitude) {
+            logger.Warn("destination hub is outside the service area", "hub", h.Name)
+        }
+    }
+    if err := request.RegisterValidators(fence, cfg.ValidationConfig.MaxTolerance); err != nil {
+        fatal("Failed to register request validators", err)
+    }
+
+    // starting the hubs that push rider and driver events to connected sockets
+    go b.hub.Run(ctx)
+    go b.drivers.Run(ctx)
+
+    rideService := ride.NewRideService(b.jobs, b.locations, b.cabs, b.publisher, b.drivers, b.rideRepo, destinations, roads, logger)
+    driverService := driver.NewDriverService(b.cabs, b.publisher, b.jobs, b.driverRepo, logger)
+    riderService := rider.NewRiderService(b.riderRepo, logger)
+
+    // access tokens riders, drivers and operators authenticate with
+    tokenSecret := []byte(cfg.AuthConfig.TokenSecret)
+    if len(tokenSecret) == 0 {
+        logger.Warn("AUTH_TOKEN_SECRET is not set, using a random secret; tokens stop working on restart")
+        tokenSecret = make([]byte, 32)
+        if _, err := rand.Read(tokenSecret); err != nil {
+            fatal("Failed to generate token secret", err)
+        }
+    }
+    tokens := auth.NewTokens(tokenSecret, cfg.AuthConfig.TokenTTL)
+    if cfg.AuthConfig.AdminPassword == "" {
+        logger.Warn("AUTH_ADMIN_PASSWORD is not set, admin login is disabled")
+    }
+
+    // open rider and driver sockets, told to reconnect on shutdown
+    sessions := handlers.NewSessions()
+
     // register routes
-    router.RegisterRoutes(r, db, redisClient, mqChan)
+    router.RegisterRoutes(r, rideService, driverService, riderService, tokens, string(cfg.AuthConfig.AdminPassword), b.hub, b.drivers, sessions, cfg.SessionConfig.Grace, b.queueService, logger)
 
     // configure server with timeouts
 	srv := &http.Server{
@@ -121,17 +218,15 @@ func main() {
     // Create a server context for graceful shutdown
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
-    log.Println("server")
-
     quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	
 	
 	// Start server in a goroutine
 	go func() {
-		log.Println("Server starting", "port", 8081)
+		logger.Info("Server starting", "port", 8081)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Server failed to start", "error", err)
+			fatal("Server failed to start", err)
 		}
 		serverStopCtx()
 	}()
@@ -140,21 +235,180 @@ func main() {
 	// Wait for shutdown signal
 	select {
 	case <-quit:
-		log.Println("Shutdown signal received...")
+		logger.Info("Shutdown signal received")
 	case <-serverCtx.Done():
-		log.Println("Server stopped...")
+		logger.Info("Server stopped")
 	}
 
 	// Create a deadline for shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
 	// Shutdown the server
-	log.Println("Shutting down server...")
+	logger.Info("Shutting down server")
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Fatal("Server forced to shutdown", "error", err)
+		logger.Error("Server forced to shutdown", logging.Err(err))
+	}
+
+	// riders are told to reconnect, their queued jobs are kept
+	if err := sessions.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Rider sockets still open at shutdown deadline", logging.Err(err))
+	}
+
+	// stop consuming, running jobs finish or go back to the queue
+	if err := workerPool.Stop(shutdownCtx); err != nil {
+		logger.Warn("Worker pool did not stop in time", logging.Err(err))
 	}
 
-	log.Println("Server exited properly")
+	stopBackground()
 
+	if err := b.close(); err != nil {
+		logger.Error("Failed to close connections", logging.Err(err))
+	}
+
+	// flush the spans still buffered
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", logging.Err(err))
+	}
+
+	logger.Info("Server exited properly")
+
+}
+
+// fatal logs the error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
+// backend is everything the services keep their state in
+type backend struct {
+	locations    ride.LocationStore
+	cabs         ride.CabStore
+	jobs         queue.JobQueue
+	queueService queue.QueueService
+	publisher    events.Publisher
+	hub          *events.Hub
+	drivers      *events.DriverHub
+	rideRepo     ride.Repository
+	driverRepo   driver.Repository
+	riderRepo    rider.Repository
+	// ping reports whether the database is reachable
+	ping func(ctx context.Context) error
+	// queueState reports the state of the job queue connection, with the
+	// reason while it is not usable
+	queueState func() (string, error)
+	// close releases the connections once nothing uses them anymore
+	close func() error
+}
+
+// connectBackend connects to Redis, RabbitMQ and Postgres
+func connectBackend(ctx context.Context, cfg config.Config, logger *slog.Logger) backend {
+    // setting up redis client
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisConfig.Address,
+		Password: string(cfg.RedisConfig.Password),
+		DB:       cfg.RedisConfig.DB,
+		Protocol: cfg.RedisConfig.Protocol,
+	})
+
+	queueName := "ride-matching"
+	driverExchange := "driver-events"
+
+    // configuring RabbitMQ queue options
+	queueOpts := queue.QueueOptions{
+		Name:       queueName,
+		Durable:    true,
+		AutoDelete: false,
+		Exclusive:  false,
+		NoWait:     false,
+		Retry: queue.RetryOptions{
+			MaxRetries: cfg.RabbitMQConfig.MaxRetries,
+			BaseDelay:  cfg.RabbitMQConfig.RetryBaseDelay,
+		},
+	}
+
+    // establishing connection to RabbitMQ, the persistent queue is
+    // declared again on every reconnect
+	mqConn, err := queue.Connect(cfg.RabbitMQConfig, logger, queueOpts)
+	if err != nil {
+		fatal("Failed to connect to RabbitMQ", err)
+	}
+
+    // the job queue consumes on a channel of its own
+	jobs, err := queue.NewAMQPJobQueue(mqConn, queueName, logger)
+	if err != nil {
+		fatal("Failed to initialise RabbitMQ channel", err)
+	}
+
+    // connecting to database
+    db, err := pgxpool.New(ctx, fmt.Sprintf("user=%v password=%v host=%v port=%v dbname=%v", cfg.DatabaseConfig.User, string(cfg.DatabaseConfig.Password),cfg.DatabaseConfig.Host,cfg.DatabaseConfig.Port, cfg.DatabaseConfig.DatabaseName))
+
+    if err != nil{
+        fatal("Failed to connect to database", err)
+    }
+
+    // separate channel for admin tooling, dead letters are acked in bulk on it
+	adminChan, err := mqConn.Channel(nil)
+	if err != nil {
+		fatal("Failed to initialise RabbitMQ admin channel", err)
+	}
+
+    // driver events go out on a topic exchange keyed by cab, every API
+    // process consumes all of them through a queue of its own
+	driverTopic, err := queue.NewTopic(mqConn, driverExchange, events.DriverBinding, logger)
+	if err != nil {
+		fatal("Failed to initialise driver event exchange", err)
+	}
+
+	redisStore := store.NewRedisStore(redisClient, logger)
+
+	return backend{
+		locations:    redisStore,
+		cabs:         redisStore,
+		jobs:         jobs,
+		queueService: queue.NewQueueService(adminChan, queueName),
+		publisher:    events.NewRedisPublisher(redisClient),
+		hub:          events.NewHub(redisClient),
+		drivers:      events.NewDriverHub(driverTopic),
+		rideRepo:     repositories.NewRideRepository(db),
+		driverRepo:   repositories.NewDriverRepository(db),
+		riderRepo:    repositories.NewRiderRepository(db),
+		ping:         db.Ping,
+		queueState: func() (string, error) {
+			state, err := mqConn.State()
+			return string(state), err
+		},
+		close: func() error {
+			err := errors.Join(mqConn.Close(), redisClient.Close())
+			db.Close()
+			return err
+		},
+	}
+}
+
+// memoryBackend keeps all state in process, nothing has to be running
+func memoryBackend(cfg config.Config, logger *slog.Logger) backend {
+	memStore := store.NewMemoryStore()
+	jobs := queue.NewMemoryQueue(queue.RetryOptions{
+		MaxRetries: cfg.RabbitMQConfig.MaxRetries,
+		BaseDelay:  cfg.RabbitMQConfig.RetryBaseDelay,
+	}, logger)
+	hub := events.NewLocalHub()
+
+	return backend{
+		locations:    memStore,
+		cabs:         memStore,
+		jobs:         jobs,
+		queueService: jobs,
+		publisher:    hub,
+		hub:          hub,
+		drivers:      events.NewLocalDriverHub(),
+		rideRepo:     memory.NewRideRepository(),
+		driverRepo:   memory.NewDriverRepository(),
+		riderRepo:    memory.NewRiderRepository(),
+		ping:         func(ctx context.Context) error { return nil },
+		queueState:   func() (string, error) { return "memory", nil },
+		close:        func() error { return nil },
+	}
 }
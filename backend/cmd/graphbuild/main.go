@@ -0,0 +1,218 @@
+// Command graphbuild converts an OpenStreetMap XML extract (.osm) into the
+// graph file read by routing.LoadGraph. PBF extracts can be converted to XML
+// first, e.g. with osmium cat city.osm.pbf -o city.osm.
+//
+//	go run ./cmd/graphbuild -in city.osm -out city.graph
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// defaultSpeeds is the assumed speed in km/h per highway type when a way has
+// no usable maxspeed tag. Types missing here are not drivable.
+var defaultSpeeds = map[string]float64{
+	"motorway":       80,
+	"motorway_link":  50,
+	"trunk":          60,
+	"trunk_link":     40,
+	"primary":        45,
+	"primary_link":   35,
+	"secondary":      40,
+	"secondary_link": 30,
+	"tertiary":       30,
+	"tertiary_link":  25,
+	"unclassified":   25,
+	"residential":    20,
+	"living_street":  10,
+	"service":        15,
+}
+
+type osmNode struct {
+	ID  int64   `xml:"id,attr"`
+	Lat float64 `xml:"lat,attr"`
+	Lng float64 `xml:"lon,attr"`
+}
+
+type osmTag struct {
+	K string `xml:"k,attr"`
+	V string `xml:"v,attr"`
+}
+
+type osmWay struct {
+	ID   int64 `xml:"id,attr"`
+	Refs []struct {
+		Ref int64 `xml:"ref,attr"`
+	} `xml:"nd"`
+	Tags []osmTag `xml:"tag"`
+}
+
+type way struct {
+	nodes  []int64
+	speed  float64
+	oneway int // 0 both directions, 1 forward, -1 backward
+}
+
+func main() {
+	in := flag.String("in", "", "OpenStreetMap XML extract")
+	out := flag.String("out", "", "graph file to write")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("Failed to open extract: %s", err.Error())
+	}
+	defer f.Close()
+
+	nodes, ways, err := readExtract(f)
+	if err != nil {
+		log.Fatalf("Failed to read extract: %s", err.Error())
+	}
+
+	o, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create graph file: %s", err.Error())
+	}
+	defer o.Close()
+
+	edges, err := writeGraph(o, nodes, ways)
+	if err != nil {
+		log.Fatalf("Failed to write graph file: %s", err.Error())
+	}
+
+	log.Printf("Wrote %d edges from %d ways", edges, len(ways))
+}
+
+// readExtract streams the XML and keeps every node plus the drivable ways
+func readExtract(r io.Reader) (map[int64]osmNode, []way, error) {
+	nodes := make(map[int64]osmNode)
+	var ways []way
+
+	dec := xml.NewDecoder(bufio.NewReader(r))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "node":
+			var n osmNode
+			if err := dec.DecodeElement(&n, &start); err != nil {
+				return nil, nil, err
+			}
+			nodes[n.ID] = n
+
+		case "way":
+			var w osmWay
+			if err := dec.DecodeElement(&w, &start); err != nil {
+				return nil, nil, err
+			}
+			if parsed, ok := drivable(w); ok {
+				ways = append(ways, parsed)
+			}
+		}
+	}
+
+	return nodes, ways, nil
+}
+
+func drivable(w osmWay) (way, bool) {
+	tags := make(map[string]string, len(w.Tags))
+	for _, t := range w.Tags {
+		tags[t.K] = t.V
+	}
+
+	speed, ok := defaultSpeeds[tags["highway"]]
+	if !ok || len(w.Refs) < 2 {
+		return way{}, false
+	}
+
+	if v, err := strconv.ParseFloat(strings.TrimSuffix(tags["maxspeed"], " km/h"), 64); err == nil && v > 0 {
+		speed = v
+	}
+
+	oneway := 0
+	switch tags["oneway"] {
+	case "yes", "true", "1":
+		oneway = 1
+	case "-1", "reverse":
+		oneway = -1
+	}
+	if tags["highway"] == "motorway" && tags["oneway"] == "" {
+		oneway = 1
+	}
+
+	out := way{speed: speed, oneway: oneway}
+	for _, ref := range w.Refs {
+		out.nodes = append(out.nodes, ref.Ref)
+	}
+
+	return out, true
+}
+
+// writeGraph writes the nodes used by drivable ways followed by one edge per
+// consecutive pair of way nodes
+func writeGraph(w io.Writer, nodes map[int64]osmNode, ways []way) (int, error) {
+	bw := bufio.NewWriter(w)
+
+	used := make(map[int64]bool)
+	for _, wy := range ways {
+		for _, id := range wy.nodes {
+			n, ok := nodes[id]
+			if !ok || used[id] {
+				continue
+			}
+			used[id] = true
+			fmt.Fprintf(bw, "N %d %.7f %.7f\n", n.ID, n.Lat, n.Lng)
+		}
+	}
+
+	edges := 0
+	for _, wy := range ways {
+		for i := 0; i+1 < len(wy.nodes); i++ {
+			a, okA := nodes[wy.nodes[i]]
+			b, okB := nodes[wy.nodes[i+1]]
+			if !okA || !okB {
+				continue
+			}
+
+			metres := routing.HaversineKm(a.Lat, a.Lng, b.Lat, b.Lng) * 1000
+
+			switch wy.oneway {
+			case 0:
+				fmt.Fprintf(bw, "B %d %d %.1f %.0f\n", a.ID, b.ID, metres, wy.speed)
+			case 1:
+				fmt.Fprintf(bw, "E %d %d %.1f %.0f\n", a.ID, b.ID, metres, wy.speed)
+			case -1:
+				fmt.Fprintf(bw, "E %d %d %.1f %.0f\n", b.ID, a.ID, metres, wy.speed)
+			}
+			edges++
+		}
+	}
+
+	return edges, bw.Flush()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// client talks to the API the same way the frontend and driver apps do
+type client struct {
+	base string
+	http *http.Client
+	// token is sent as the bearer token, when set
+	token string
+}
+
+func newClient(base string) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 256
+
+	return &client{
+		base: strings.TrimRight(base, "/"),
+		http: &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}
+}
+
+// withToken returns a client authenticating with the access token
+func (c *client) withToken(token string) *client {
+	authed := *c
+	authed.token = token
+	return &authed
+}
+
+// apiError is a non-2xx response, carrying the API's message
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Status, e.Message)
+}
+
+func (c *client) post(path string, body, out any) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.base+path, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decode(resp, out)
+}
+
+func (c *client) get(path string, out any) error {
+	req, err := http.NewRequest(http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decode(resp, out)
+}
+
+func (c *client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+func decode(resp *http.Response, out any) error {
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return &apiError{Status: resp.StatusCode, Message: body.Message}
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// dial opens a WebSocket on the API, ws:// or wss:// matching the base URL,
+// speaking the given subprotocol
+func (c *client) dial(path, subprotocol string) (*websocket.Conn, error) {
+	url := "ws" + strings.TrimPrefix(c.base, "http") + path
+
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{subprotocol}
+
+	ws, _, err := dialer.Dial(url, header)
+	return ws, err
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// arrivedKm is how close a driver has to get to count as being at a stop
+const arrivedKm = 0.05
+
+// cabView is the cab as returned by the driver endpoints
+type cabView struct {
+	CabID          string      `json:"cab_id"`
+	Status         string      `json:"status"`
+	PassengerCount int         `json:"passenger_count"`
+	Stops          []ride.Stop `json:"stops"`
+}
+
+// driverMessage is a frame of the cab's event socket
+type driverMessage struct {
+	Type    protocol.Type `json:"type"`
+	Payload struct {
+		RiderID int         `json:"rider_id"`
+		Stops   []ride.Stop `json:"stops"`
+	} `json:"payload"`
+}
+
+// driver is a virtual driver. It roams the bounding box while empty and
+// otherwise follows its cab's stop list, advancing the trips at every stop.
+type driver struct {
+	index  int
+	cfg    *config
+	api    *client
+	router routing.Router
+	stats  *stats
+	rng    *rand.Rand
+
+	cabID string
+	pos   routing.Point
+	goal  routing.Point
+	path  []routing.Point
+	stops []ride.Stop
+	// done holds the stops already served, the cab's list may lag behind
+	done map[string]bool
+}
+
+func (d *driver) run(ctx context.Context, runID int64) {
+	var reg struct {
+		CabID       string `json:"cab_id"`
+		AccessToken string `json:"access_token"`
+	}
+
+	class := d.cfg.classes[d.rng.Intn(len(d.cfg.classes))]
+
+	err := d.api.post("/api/v1/driver/register", map[string]any{
+		"name":           fmt.Sprintf("sim driver %d", d.index),
+		"phone":          fmt.Sprintf("sim-%d-%d", runID, d.index),
+		"vehicle_number": fmt.Sprintf("SIM-%d-%d", runID, d.index),
+		"vehicle_class":  class,
+		"password":       fmt.Sprintf("sim-%d-%d", runID, d.index),
+	}, &reg)
+	if err != nil {
+		log.Printf("driver %d: register failed: %v", d.index, err)
+		d.stats.update(func(s *stats) { s.driverError++ })
+		return
+	}
+
+	d.cabID = reg.CabID
+	d.api = d.api.withToken(reg.AccessToken)
+	d.pos = d.cfg.box.random(d.rng)
+	d.done = make(map[string]bool)
+
+	var cab cabView
+	err = d.api.post("/api/v1/driver/"+d.cabID+"/online", map[string]float64{"lat": d.pos.Lat, "lng": d.pos.Lng}, &cab)
+	if err != nil {
+		log.Printf("driver %d: going online failed: %v", d.index, err)
+		d.stats.update(func(s *stats) { s.driverError++ })
+		return
+	}
+	d.stops = cab.Stops
+
+	routes := make(chan []ride.Stop)
+	go d.listen(ctx, routes, rand.New(rand.NewSource(d.rng.Int63())))
+
+	ticker := time.NewTicker(d.cfg.ping)
+	defer ticker.Stop()
+
+	// distance covered per ping in simulated time
+	stepKm := d.cfg.speedKmh * d.cfg.ping.Hours() * d.cfg.speedup
+
+	for {
+		select {
+		case <-ctx.Done():
+			// drivers with riders on board stay online, like a real shift end
+			_ = d.api.post("/api/v1/driver/"+d.cabID+"/offline", nil, nil)
+			return
+		case stops := <-routes:
+			d.stops = stops
+			continue
+		case <-ticker.C:
+		}
+
+		d.drive(stepKm)
+
+		err := d.api.post("/api/v1/driver/"+d.cabID+"/location", map[string]float64{"lat": d.pos.Lat, "lng": d.pos.Lng}, &cab)
+		d.stats.update(func(s *stats) {
+			s.pings++
+			if err != nil {
+				s.driverError++
+			}
+		})
+		if err == nil {
+			d.stops = cab.Stops
+		}
+	}
+}
+
+// listen follows the cab's event socket and hands every new route to
+// routes. Offers are accepted, save for the configured share of declines.
+// Without the socket the route is still read from the pings.
+func (d *driver) listen(ctx context.Context, routes chan<- []ride.Stop, rng *rand.Rand) {
+	ws, err := d.api.dial("/api/v1/driver/"+d.cabID+"/events", protocol.DriverSubprotocol)
+	if err != nil {
+		log.Printf("driver %d: event socket failed: %v", d.index, err)
+		return
+	}
+	defer ws.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = ws.Close()
+	}()
+
+	for {
+		var m driverMessage
+		if err := ws.ReadJSON(&m); err != nil {
+			return
+		}
+
+		d.stats.update(func(s *stats) { s.driverEvents[m.Type]++ })
+
+		switch m.Type {
+		case protocol.TypeOffer:
+			answer := protocol.TypeAccept
+			if rng.Float64() < d.cfg.declineRate {
+				answer = protocol.TypeDecline
+			}
+			payload, _ := json.Marshal(protocol.Accept{RiderID: m.Payload.RiderID})
+			if err := ws.WriteJSON(protocol.Envelope{Type: answer, Payload: payload}); err != nil {
+				return
+			}
+		case protocol.TypeRoute, protocol.TypeAssigned, protocol.TypeRiderCancelled:
+			select {
+			case routes <- m.Payload.Stops:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// drive moves the cab stepKm towards its next stop, or a random point
+// while it has none, serving every stop it reaches on the way
+func (d *driver) drive(stepKm float64) {
+	for stepKm > 0 {
+		stop := d.nextStop()
+
+		goal := d.goal
+		if stop != nil {
+			goal = routing.Point{Lat: stop.Lat, Lng: stop.Lng}
+		} else if len(d.path) == 0 {
+			goal = d.cfg.box.random(d.rng)
+		}
+
+		if goal != d.goal || len(d.path) == 0 {
+			d.goal = goal
+			d.path = d.route(d.pos, goal)
+		}
+
+		stepKm = d.advance(stepKm)
+
+		if routing.HaversineKm(d.pos.Lat, d.pos.Lng, d.goal.Lat, d.goal.Lng) > arrivedKm {
+			return
+		}
+
+		d.path = nil
+		if stop != nil {
+			d.serve(*stop)
+		}
+	}
+}
+
+func (d *driver) nextStop() *ride.Stop {
+	for i := range d.stops {
+		if !d.done[stopKey(d.stops[i])] {
+			return &d.stops[i]
+		}
+	}
+	return nil
+}
+
+// serve moves the stop's trip on. Trips cancelled meanwhile fail the
+// transition, their stops are already gone from the cab's route.
+func (d *driver) serve(stop ride.Stop) {
+	d.done[stopKey(stop)] = true
+
+	var steps []ride.TripStatus
+	switch stop.Kind {
+	case ride.StopPickup:
+		steps = []ride.TripStatus{ride.TripDriverArrived, ride.TripInProgress}
+	case ride.StopDrop:
+		steps = []ride.TripStatus{ride.TripCompleted}
+	}
+
+	for _, status := range steps {
+		if err := advanceTrip(d.api, stop.TripID, status); err != nil {
+			return
+		}
+	}
+}
+
+// route returns the waypoints from one point to another, along the road
+// graph when one is loaded
+func (d *driver) route(from, to routing.Point) []routing.Point {
+	r, err := d.router.Route(from, to)
+	if err != nil || len(r.Points) == 0 {
+		return []routing.Point{to}
+	}
+
+	points := append([]routing.Point(nil), r.Points...)
+	if points[len(points)-1] != to {
+		points = append(points, to)
+	}
+	return points
+}
+
+// advance moves along the path and returns the distance left over once the
+// end of the path is reached
+func (d *driver) advance(stepKm float64) float64 {
+	for len(d.path) > 0 {
+		next := d.path[0]
+		legKm := routing.HaversineKm(d.pos.Lat, d.pos.Lng, next.Lat, next.Lng)
+
+		if legKm > stepKm {
+			f := stepKm / legKm
+			d.pos.Lat += (next.Lat - d.pos.Lat) * f
+			d.pos.Lng += (next.Lng - d.pos.Lng) * f
+			return 0
+		}
+
+		d.pos = next
+		d.path = d.path[1:]
+		stepKm -= legKm
+	}
+
+	return stepKm
+}
+
+func stopKey(s ride.Stop) string {
+	return fmt.Sprintf("%d:%s", s.RiderID, s.Kind)
+}
+
+func advanceTrip(api *client, tripID int, status ride.TripStatus) error {
+	return api.post(fmt.Sprintf("/api/v1/ride/trip/%d/status", tripID), map[string]string{"status": string(status)}, nil)
+}
@@ -0,0 +1,304 @@
+// Command simulator is a load generator that plays a city against a running
+// API. Virtual drivers register, go online and drive around a bounding box
+// (straight lines, or along a routing graph), following their cab's stops
+// once riders are matched into it. Virtual riders arrive following a demand
+// curve, ask for a fare and request rides over the real WebSocket. At the
+// end it reports matching latency, pool sizes, detours, cancellations and
+// fares.
+//
+//	go run ./cmd/simulator -drivers 200 -rate 300 -curve 0.5,1,2,1 -duration 10m -speedup 10
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+type config struct {
+	box        bbox
+	curve      []float64
+	rate       float64 // rider arrivals per minute at a curve value of 1
+	duration   time.Duration
+	drain      time.Duration
+	drivers    int
+	classes    []string
+	speedKmh   float64
+	speedup    float64
+	ping       time.Duration
+	tolerance  float64
+	maxLuggage int
+	hubShare   float64
+	hubs       []string
+	cancelRate float64
+	// declineRate is the share of offers drivers decline
+	declineRate float64
+	patience    time.Duration
+}
+
+// bbox is the area riders appear in and drivers roam
+type bbox struct {
+	minLat, minLng, maxLat, maxLng float64
+}
+
+func (b bbox) random(rng *rand.Rand) routing.Point {
+	return routing.Point{
+		Lat: b.minLat + rng.Float64()*(b.maxLat-b.minLat),
+		Lng: b.minLng + rng.Float64()*(b.maxLng-b.minLng),
+	}
+}
+
+func main() {
+	api := flag.String("api", "http://localhost:8081", "base URL of the API")
+	box := flag.String("bbox", "23.20,77.35,23.30,77.47", "min_lat,min_lng,max_lat,max_lng of the simulated area")
+	curve := flag.String("curve", "1", "comma separated demand multipliers, spread evenly over -duration")
+	rate := flag.Float64("rate", 60, "rider arrivals per minute at a demand multiplier of 1")
+	duration := flag.Duration("duration", 5*time.Minute, "how long new riders keep arriving")
+	drain := flag.Duration("drain", 2*time.Minute, "how long to wait for open rides after the last arrival")
+	drivers := flag.Int("drivers", 50, "number of simulated drivers")
+	classes := flag.String("classes", "hatchback,sedan,suv", "vehicle classes drivers register with, picked at random")
+	graphFile := flag.String("graph", "", "routing graph drivers follow, straight lines when empty")
+	speed := flag.Float64("speed", routing.DefaultSpeedKmh, "driving speed in km/h")
+	speedup := flag.Float64("speedup", 10, "simulated time runs this many times faster than real time")
+	ping := flag.Duration("ping", 2*time.Second, "interval of driver location pings")
+	tolerance := flag.Float64("tolerance", 0.3, "mean detour riders accept, as a share of their direct distance")
+	maxLuggage := flag.Int("max-luggage", 2, "riders carry 0 to this many pieces of luggage")
+	hubShare := flag.Float64("hub-share", 0.3, "share of riders heading to a destination hub instead of a random drop")
+	cancelRate := flag.Float64("cancel", 0.05, "share of riders that cancel on their own while waiting")
+	declineRate := flag.Float64("decline", 0.1, "share of offers drivers decline")
+	patience := flag.Duration("patience", 2*time.Minute, "riders still unmatched after this long cancel")
+	every := flag.Duration("report", 10*time.Second, "interval of progress lines")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	cfg := &config{
+		rate:        *rate,
+		duration:    *duration,
+		drain:       *drain,
+		drivers:     *drivers,
+		classes:     splitList(*classes),
+		speedKmh:    *speed,
+		speedup:     *speedup,
+		ping:        *ping,
+		tolerance:   *tolerance,
+		maxLuggage:  *maxLuggage,
+		hubShare:    *hubShare,
+		cancelRate:  *cancelRate,
+		declineRate: *declineRate,
+		patience:    *patience,
+	}
+
+	var err error
+	if cfg.box, err = parseBBox(*box); err != nil {
+		log.Fatalf("Invalid -bbox: %v", err)
+	}
+	if cfg.curve, err = parseCurve(*curve); err != nil {
+		log.Fatalf("Invalid -curve: %v", err)
+	}
+	if len(cfg.classes) == 0 {
+		log.Fatal("-classes must name at least one vehicle class")
+	}
+
+	var router routing.Router = routing.NewHaversineRouter(cfg.speedKmh)
+	if *graphFile != "" {
+		graph, err := routing.LoadGraph(*graphFile, cfg.speedKmh)
+		if err != nil {
+			log.Fatalf("Failed to load routing graph: %v", err)
+		}
+		log.Printf("Drivers follow a routing graph with %d nodes", graph.Nodes())
+		router = routing.WithFallback(graph, router)
+	}
+
+	client := newClient(*api)
+
+	var dest struct {
+		Destinations []struct {
+			Name string `json:"name"`
+		} `json:"destinations"`
+	}
+	if err := client.get("/api/v1/ride/destinations", &dest); err != nil {
+		log.Fatalf("Failed to reach the API at %s: %v", *api, err)
+	}
+	for _, d := range dest.Destinations {
+		cfg.hubs = append(cfg.hubs, d.Name)
+	}
+
+	st := newStats()
+	rng := rand.New(rand.NewSource(*seed))
+
+	// arrivals stop after -duration, riders and drivers get -drain more
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	arrivals, cancelArrivals := context.WithTimeout(ctx, cfg.duration)
+	defer cancelArrivals()
+
+	running, cancelRunning := context.WithCancel(ctx)
+	defer cancelRunning()
+
+	log.Printf("Simulating %d drivers and %.0f riders/min for %s (seed %d)", cfg.drivers, cfg.rate, cfg.duration, *seed)
+
+	var fleetDone sync.WaitGroup
+	runID := time.Now().Unix()
+	for i := range cfg.drivers {
+		d := &driver{
+			index:  i,
+			cfg:    cfg,
+			api:    client,
+			router: router,
+			stats:  st,
+			rng:    rand.New(rand.NewSource(rng.Int63())),
+		}
+		fleetDone.Add(1)
+		go func() {
+			defer fleetDone.Done()
+			d.run(running, runID)
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(*every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-running.Done():
+				return
+			case <-ticker.C:
+				st.progress(os.Stdout)
+			}
+		}
+	}()
+
+	var riders sync.WaitGroup
+	nextRider := 0
+	start := time.Now()
+
+	for {
+		perMinute := cfg.rate * cfg.demandAt(time.Since(start))
+
+		var wait time.Duration
+		if perMinute > 0 {
+			// Poisson arrivals, exponentially distributed gaps
+			wait = time.Duration(rng.ExpFloat64() / perMinute * float64(time.Minute))
+		} else {
+			wait = time.Second
+		}
+
+		select {
+		case <-arrivals.Done():
+		case <-time.After(wait):
+			if perMinute == 0 {
+				continue
+			}
+
+			r := &rider{
+				index:  nextRider,
+				cfg:    cfg,
+				api:    client,
+				router: router,
+				stats:  st,
+				rng:    rand.New(rand.NewSource(rng.Int63())),
+			}
+			nextRider++
+			riders.Add(1)
+			go func() {
+				defer riders.Done()
+				r.run(running, runID)
+			}()
+			continue
+		}
+		break
+	}
+
+	arrived := time.Since(start)
+	log.Printf("Arrivals stopped, waiting up to %s for open rides", cfg.drain)
+
+	finished := make(chan struct{})
+	go func() {
+		riders.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(cfg.drain):
+		log.Println("Drain timeout, open rides are left behind")
+	case <-ctx.Done():
+	}
+
+	cancelRunning()
+	fleetDone.Wait()
+
+	st.report(os.Stdout, arrived)
+}
+
+// demandAt returns the curve's multiplier for the elapsed time
+func (c *config) demandAt(elapsed time.Duration) float64 {
+	i := int(float64(len(c.curve)) * elapsed.Seconds() / c.duration.Seconds())
+	return c.curve[max(0, min(i, len(c.curve)-1))]
+}
+
+func parseBBox(s string) (bbox, error) {
+	parts := splitList(s)
+	if len(parts) != 4 {
+		return bbox{}, fmt.Errorf("expected 4 comma separated numbers, got %q", s)
+	}
+
+	v := make([]float64, 4)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return bbox{}, err
+		}
+		v[i] = f
+	}
+
+	b := bbox{minLat: v[0], minLng: v[1], maxLat: v[2], maxLng: v[3]}
+	if b.minLat >= b.maxLat || b.minLng >= b.maxLng {
+		return bbox{}, fmt.Errorf("min corner must be south-west of max corner")
+	}
+
+	return b, nil
+}
+
+func parseCurve(s string) ([]float64, error) {
+	var curve []float64
+	for _, p := range splitList(s) {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, err
+		}
+		if f < 0 || math.IsNaN(f) {
+			return nil, fmt.Errorf("demand multiplier %q must not be negative", p)
+		}
+		curve = append(curve, f)
+	}
+
+	if len(curve) == 0 {
+		return nil, fmt.Errorf("empty demand curve")
+	}
+
+	return curve, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
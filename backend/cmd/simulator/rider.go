@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// wsMessage is any message the ride request socket sends, the payload
+// fields the simulator looks at
+type wsMessage struct {
+	Type    protocol.Type `json:"type"`
+	Payload struct {
+		Status  string `json:"status"`
+		CabID   string `json:"cab_id"`
+		TripID  int    `json:"trip_id"`
+		Message string `json:"message"`
+	} `json:"payload"`
+}
+
+// rider is a virtual rider. It asks for a fare, requests the ride over the
+// WebSocket and either waits to be matched or gives up. Once matched it
+// stays connected until its driver completes the trip.
+type rider struct {
+	index  int
+	cfg    *config
+	api    *client
+	router routing.Router
+	stats  *stats
+	rng    *rand.Rand
+	// id is the rider's account, set by signup
+	id int
+}
+
+func (r *rider) run(ctx context.Context, runID int64) {
+	if err := r.signup(runID); err != nil {
+		r.fail()
+		return
+	}
+
+	pickup := r.cfg.box.random(r.rng)
+
+	req := map[string]any{
+		"lat":       pickup.Lat,
+		"lng":       pickup.Lng,
+		"luggage":   r.rng.Intn(r.cfg.maxLuggage + 1),
+		"tolerance": r.cfg.tolerance * (0.5 + r.rng.Float64()),
+	}
+
+	fareReq := map[string]any{"lat": pickup.Lat, "lng": pickup.Lng}
+
+	if len(r.cfg.hubs) > 0 && r.rng.Float64() < r.cfg.hubShare {
+		hub := r.cfg.hubs[r.rng.Intn(len(r.cfg.hubs))]
+		req["destination"] = hub
+		fareReq["destination"] = hub
+	} else {
+		drop := r.cfg.box.random(r.rng)
+		req["drop"] = map[string]float64{"lat": drop.Lat, "lng": drop.Lng}
+		fareReq["drop"] = req["drop"]
+	}
+
+	var fare struct {
+		Fare float64 `json:"fare"`
+	}
+	if err := r.api.post("/api/v1/ride/fare", fareReq, &fare); err == nil {
+		r.stats.update(func(s *stats) { s.fares = append(s.fares, fare.Fare) })
+	}
+
+	ws, err := r.api.dial("/api/v1/ride/request", protocol.Subprotocol)
+	if err != nil {
+		r.fail()
+		return
+	}
+	defer ws.Close()
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		r.fail()
+		return
+	}
+	if err := ws.WriteJSON(protocol.Envelope{Type: protocol.TypeRequest, Payload: payload}); err != nil {
+		r.fail()
+		return
+	}
+
+	requested := time.Now()
+	r.stats.update(func(s *stats) { s.requested++ })
+
+	done := make(chan struct{})
+	defer close(done)
+
+	messages := make(chan wsMessage)
+	go read(ws, messages, done)
+
+	// some riders give up early on their own, the rest once their patience runs out
+	var giveUp <-chan time.Time
+	if r.rng.Float64() < r.cfg.cancelRate {
+		giveUp = time.After(time.Duration(r.rng.Int63n(int64(r.cfg.patience))))
+	}
+	patience := time.After(r.cfg.patience)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-giveUp:
+			_ = ws.WriteJSON(protocol.Envelope{Type: protocol.TypeCancel})
+			r.stats.update(func(s *stats) { s.cancelled++ })
+			return
+
+		case <-patience:
+			_ = ws.WriteJSON(protocol.Envelope{Type: protocol.TypeCancel})
+			r.stats.update(func(s *stats) { s.timedOut++ })
+			return
+
+		case m, ok := <-messages:
+			if !ok {
+				r.fail()
+				return
+			}
+
+			switch m.Type {
+			case protocol.TypeError:
+				r.fail()
+				return
+			case protocol.TypeMatched:
+				r.matched(ctx, messages, m, time.Since(requested))
+				return
+			case protocol.TypeNoCab:
+				r.stats.update(func(s *stats) { s.noCab++ })
+				return
+			}
+		}
+	}
+}
+
+// signup creates the rider's account, the rider authenticates with its
+// token from then on
+func (r *rider) signup(runID int64) error {
+	var account struct {
+		Rider struct {
+			ID int `json:"rider_id"`
+		} `json:"rider"`
+		AccessToken string `json:"access_token"`
+	}
+
+	err := r.api.post("/api/v1/rider/signup", map[string]string{
+		"name":     fmt.Sprintf("Sim Rider %d", r.index),
+		"email":    fmt.Sprintf("sim-%d-%d@riders.test", runID, r.index),
+		"phone":    fmt.Sprintf("sim-rider-%d-%d", runID, r.index),
+		"password": fmt.Sprintf("sim-%d-%d", runID, r.index),
+	}, &account)
+	if err != nil {
+		return err
+	}
+
+	r.id = account.Rider.ID
+	r.api = r.api.withToken(account.AccessToken)
+	return nil
+}
+
+// matched records the match and rides along until the trip is over
+func (r *rider) matched(ctx context.Context, messages <-chan wsMessage, m wsMessage, latency time.Duration) {
+	var cab cabView
+	cabID := m.Payload.CabID
+	cabErr := r.api.get("/api/v1/driver/"+cabID, &cab)
+
+	r.stats.update(func(s *stats) {
+		s.matched++
+		s.latencies = append(s.latencies, latency.Seconds())
+		s.ridersPerCab[cabID]++
+
+		if cabErr != nil {
+			return
+		}
+		s.poolAtMatch = append(s.poolAtMatch, float64(cab.PassengerCount))
+		if detourKm, directKm, ok := plannedDetour(r.router, cab.Stops, r.id); ok {
+			s.detourKm = append(s.detourKm, detourKm)
+			if directKm > 0 {
+				s.detourRatio = append(s.detourRatio, detourKm/directKm)
+			}
+		}
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			if m.Type != protocol.TypeStatus {
+				continue
+			}
+			if m.Payload.Status == string(ride.TripCompleted) {
+				r.stats.update(func(s *stats) { s.completed++ })
+				return
+			}
+			if m.Payload.Status == string(ride.TripCancelled) {
+				return
+			}
+		}
+	}
+}
+
+func (r *rider) fail() {
+	r.stats.update(func(s *stats) { s.errors++ })
+}
+
+// read forwards socket messages until the socket closes or the rider is done
+func read(ws *websocket.Conn, out chan<- wsMessage, done <-chan struct{}) {
+	defer close(out)
+
+	for {
+		var m wsMessage
+		if err := ws.ReadJSON(&m); err != nil {
+			return
+		}
+
+		select {
+		case out <- m:
+		case <-done:
+			return
+		}
+	}
+}
+
+// plannedDetour is the rider's distance from pickup to drop along the cab's
+// route minus their direct distance, as planned at match time
+func plannedDetour(router routing.Router, stops []ride.Stop, riderID int) (detourKm, directKm float64, ok bool) {
+	pickup, drop := -1, -1
+	for i, s := range stops {
+		if s.RiderID != riderID {
+			continue
+		}
+		if s.Kind == ride.StopPickup {
+			pickup = i
+		} else {
+			drop = i
+		}
+	}
+
+	if pickup < 0 || drop < pickup {
+		return 0, 0, false
+	}
+
+	rideKm := 0.0
+	for i := pickup; i < drop; i++ {
+		rideKm += routing.DistanceKm(router,
+			routing.Point{Lat: stops[i].Lat, Lng: stops[i].Lng},
+			routing.Point{Lat: stops[i+1].Lat, Lng: stops[i+1].Lng})
+	}
+
+	directKm = stops[drop].DirectKm
+	return max(0, rideKm-directKm), directKm, true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
+)
+
+// stats collects the outcome of every virtual rider and driver
+type stats struct {
+	start time.Time
+
+	mu        sync.Mutex
+	requested int
+	matched   int
+	cancelled int // gave up on their own before being matched
+	timedOut  int // still unmatched after their patience ran out
+	noCab     int // given up by the server, no cab took them in time
+	completed int
+	errors    int
+
+	latencies    []float64 // seconds from request to MATCHED
+	detourKm     []float64
+	detourRatio  []float64 // detour as a share of the direct distance
+	poolAtMatch  []float64 // riders in the cab right after the match
+	ridersPerCab map[string]int
+	fares        []float64
+
+	pings       int
+	driverError int
+	// driverEvents counts the frames drivers received on their event socket
+	driverEvents map[protocol.Type]int
+}
+
+func newStats() *stats {
+	return &stats{
+		start:        time.Now(),
+		ridersPerCab: make(map[string]int),
+		driverEvents: make(map[protocol.Type]int),
+	}
+}
+
+func (s *stats) update(f func(s *stats)) {
+	s.mu.Lock()
+	f(s)
+	s.mu.Unlock()
+}
+
+// progress prints a one line summary while the simulation runs
+func (s *stats) progress(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waiting := s.requested - s.matched - s.cancelled - s.timedOut - s.noCab - s.errors
+
+	fmt.Fprintf(w, "t=%-6s requested=%d matched=%d waiting=%d cancelled=%d timed_out=%d no_cab=%d completed=%d errors=%d latency_p50=%.2fs cabs=%d\n",
+		time.Since(s.start).Truncate(time.Second), s.requested, s.matched, waiting,
+		s.cancelled, s.timedOut, s.noCab, s.completed, s.errors, percentile(s.latencies, 50), len(s.ridersPerCab))
+}
+
+// report prints the final summary, arrivals is how long riders kept arriving
+func (s *stats) report(w io.Writer, arrivals time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.start)
+
+	fmt.Fprintf(w, "\n=== simulation report (%s) ===\n", elapsed.Truncate(time.Second))
+	fmt.Fprintf(w, "riders requested   %d (%.1f/min)\n", s.requested, float64(s.requested)/arrivals.Minutes())
+	fmt.Fprintf(w, "matched            %d (%s)\n", s.matched, share(s.matched, s.requested))
+	fmt.Fprintf(w, "completed          %d\n", s.completed)
+	fmt.Fprintf(w, "cancelled          %d (%s)\n", s.cancelled, share(s.cancelled, s.requested))
+	fmt.Fprintf(w, "timed out          %d (%s)\n", s.timedOut, share(s.timedOut, s.requested))
+	fmt.Fprintf(w, "no cab             %d (%s)\n", s.noCab, share(s.noCab, s.requested))
+	fmt.Fprintf(w, "errors             %d\n", s.errors)
+	fmt.Fprintf(w, "driver pings       %d (%d failed)\n", s.pings, s.driverError)
+	fmt.Fprintf(w, "driver events      offer=%d offer_expired=%d assigned=%d rider_cancelled=%d pool_full=%d\n",
+		s.driverEvents[protocol.TypeOffer], s.driverEvents[protocol.TypeOfferExpired],
+		s.driverEvents[protocol.TypeAssigned], s.driverEvents[protocol.TypeRiderCancelled], s.driverEvents[protocol.TypePoolFull])
+
+	fmt.Fprintln(w)
+	distribution(w, "match latency (s)", s.latencies)
+	distribution(w, "detour (km)", s.detourKm)
+	distribution(w, "detour / direct", s.detourRatio)
+	distribution(w, "riders in cab at match", s.poolAtMatch)
+	distribution(w, "fare", s.fares)
+
+	sizes := make(map[int]int)
+	for _, n := range s.ridersPerCab {
+		sizes[n]++
+	}
+
+	keys := make([]int, 0, len(sizes))
+	for n := range sizes {
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+
+	fmt.Fprintf(w, "\nriders per cab over the run (%d cabs)\n", len(s.ridersPerCab))
+	for _, n := range keys {
+		fmt.Fprintf(w, "  %2d riders  %d cabs\n", n, sizes[n])
+	}
+}
+
+func distribution(w io.Writer, name string, values []float64) {
+	if len(values) == 0 {
+		fmt.Fprintf(w, "%-24s n=0\n", name)
+		return
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	fmt.Fprintf(w, "%-24s n=%-6d mean=%-8.2f p50=%-8.2f p90=%-8.2f p99=%-8.2f max=%.2f\n",
+		name, len(values), sum/float64(len(values)),
+		percentile(values, 50), percentile(values, 90), percentile(values, 99), percentile(values, 100))
+}
+
+// percentile uses the nearest-rank method, 0 for no values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+
+	return sorted[rank]
+}
+
+func share(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
@@ -0,0 +1,41 @@
+// Command wsschema writes the JSON schema of the ride request WebSocket
+// protocol, or with -driver of the driver event protocol, see package
+// protocol. The dashboard's copies are regenerated with
+//
+//	go generate ./internal/api/protocol
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
+)
+
+func main() {
+	out := flag.String("o", "", "file to write the schema to, stdout if empty")
+	driver := flag.Bool("driver", false, "write the driver event protocol instead of the ride protocol")
+	flag.Parse()
+
+	schema := protocol.Schema()
+	if *driver {
+		schema = protocol.DriverSchema()
+	}
+
+	body, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Fatalf("encoding schema: %v", err)
+	}
+	body = append(body, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(body)
+	} else {
+		err = os.WriteFile(*out, body, 0o644)
+	}
+	if err != nil {
+		log.Fatalf("writing schema: %v", err)
+	}
+}
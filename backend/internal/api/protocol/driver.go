@@ -0,0 +1,173 @@
+package protocol
+
+//go:generate go run ../../../cmd/wsschema -driver -o ../../../../dashboard/src/protocol/driver.v1.schema.json
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/websocket"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+// DriverSubprotocol is negotiated on the upgrade of a driver's event socket.
+// Drivers send ACCEPT, DECLINE and PING frames, the server sends ROUTE once
+// and then OFFER, OFFER_EXPIRED, ASSIGNED, RIDER_CANCELLED, POOL_FULL, PONG
+// and ERROR frames.
+const DriverSubprotocol = "driver.v1"
+
+// Messages sent by the driver
+const (
+	TypeAccept  Type = "ACCEPT"
+	TypeDecline Type = "DECLINE"
+)
+
+// Messages sent to the driver
+const (
+	TypeRoute          Type = "ROUTE"
+	TypeOffer          Type = "OFFER"
+	TypeOfferExpired   Type = "OFFER_EXPIRED"
+	TypeAssigned       Type = "ASSIGNED"
+	TypeRiderCancelled Type = "RIDER_CANCELLED"
+	TypePoolFull       Type = "POOL_FULL"
+)
+
+// Accept takes the rider offered to the cab
+type Accept struct {
+	RiderID int `json:"rider_id" binding:"required,gt=0"`
+}
+
+// Decline turns the rider offered to the cab down, they are offered to
+// another cab
+type Decline struct {
+	RiderID int `json:"rider_id" binding:"required,gt=0"`
+}
+
+// Route is the cab's ordered stop list when the socket opens
+type Route struct {
+	CabID string      `json:"cab_id"`
+	Stops []ride.Stop `json:"stops"`
+}
+
+func (Route) MessageType() Type { return TypeRoute }
+
+// Offer asks the driver to take a rider, their seat is held until
+// ExpiresInSeconds pass. Stops is the cab's route with the rider's pickup
+// and drop in place.
+type Offer struct {
+	CabID            string      `json:"cab_id"`
+	RiderID          int         `json:"rider_id"`
+	TripID           int         `json:"trip_id"`
+	ExpiresInSeconds int         `json:"expires_in_seconds"`
+	Stops            []ride.Stop `json:"stops"`
+}
+
+func (Offer) MessageType() Type { return TypeOffer }
+
+// OfferExpired is an offer the driver did not answer in time, Stops is the
+// cab's route without the rider
+type OfferExpired struct {
+	CabID   string      `json:"cab_id"`
+	RiderID int         `json:"rider_id"`
+	TripID  int         `json:"trip_id"`
+	Stops   []ride.Stop `json:"stops"`
+}
+
+func (OfferExpired) MessageType() Type { return TypeOfferExpired }
+
+// Assigned is a rider added to the cab, Stops is the cab's new route with
+// the rider's pickup and drop in place
+type Assigned struct {
+	CabID   string      `json:"cab_id"`
+	RiderID int         `json:"rider_id"`
+	TripID  int         `json:"trip_id"`
+	Stops   []ride.Stop `json:"stops"`
+}
+
+func (Assigned) MessageType() Type { return TypeAssigned }
+
+// RiderCancelled is a rider of the cab who gave up their trip, Stops is the
+// cab's route without them
+type RiderCancelled struct {
+	CabID   string      `json:"cab_id"`
+	RiderID int         `json:"rider_id"`
+	TripID  int         `json:"trip_id"`
+	Stops   []ride.Stop `json:"stops"`
+}
+
+func (RiderCancelled) MessageType() Type { return TypeRiderCancelled }
+
+// PoolFull tells the driver every seat of the cab is taken, no rider joins
+// until one gets off
+type PoolFull struct {
+	CabID          string `json:"cab_id"`
+	PassengerCount int    `json:"passenger_count"`
+	Capacity       int    `json:"capacity"`
+}
+
+func (PoolFull) MessageType() Type { return TypePoolFull }
+
+// driverClientMessages lists what the driver may send
+var driverClientMessages = []clientMessage{
+	{TypeAccept, Accept{}},
+	{TypeDecline, Decline{}},
+	{TypePing, Ping{}},
+}
+
+// driverServerMessages lists what the driver is sent
+var driverServerMessages = []Message{
+	Route{},
+	Offer{},
+	OfferExpired{},
+	Assigned{},
+	RiderCancelled{},
+	PoolFull{},
+	Pong{},
+	Error{},
+}
+
+// SupportedDriver reports whether a driver's upgrade request can be served,
+// it either offers no subprotocol or offers DriverSubprotocol
+func SupportedDriver(r *http.Request) bool {
+	offered := websocket.Subprotocols(r)
+	return len(offered) == 0 || slices.Contains(offered, DriverSubprotocol)
+}
+
+// DecodeDriver reads a frame sent by the driver. The payload is an
+// *Accept, *Decline or *Ping; it is decoded but not validated.
+func DecodeDriver(raw []byte) (Type, any, error) {
+	var e Envelope
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return "", nil, err
+	}
+
+	var payload any
+	switch e.Type {
+	case TypeAccept:
+		payload = &Accept{}
+	case TypeDecline:
+		payload = &Decline{}
+	case TypePing:
+		payload = &Ping{}
+	case "":
+		return "", nil, fmt.Errorf("%w, the frame has no type", ErrUnknownType)
+	default:
+		return e.Type, nil, fmt.Errorf("%w %q", ErrUnknownType, e.Type)
+	}
+
+	if len(e.Payload) > 0 && string(e.Payload) != "null" {
+		if err := json.Unmarshal(e.Payload, payload); err != nil {
+			return e.Type, nil, err
+		}
+	}
+
+	return e.Type, payload, nil
+}
+
+// DriverSchema returns the JSON schema of the driver protocol, laid out
+// like Schema
+func DriverSchema() map[string]any {
+	return schema(DriverSubprotocol, "Driver event WebSocket protocol", driverClientMessages, driverServerMessages)
+}
@@ -0,0 +1,125 @@
+package protocol
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+)
+
+// Request asks for a shared ride, it is the first frame of every socket
+type Request = request.RideRequest
+
+// Cancel gives up the ride while it is not matched yet
+type Cancel struct {
+	Reason string `json:"reason,omitempty" binding:"max=200"`
+}
+
+// Ping asks the server for a Pong, e.g. to keep proxies from closing an
+// idle socket
+type Ping struct {
+	ID string `json:"id,omitempty" binding:"max=64"`
+}
+
+// Session carries the token the rider resumes the ride with after the
+// socket dropped. It is the first frame of every ride socket.
+type Session struct {
+	Token        string `json:"session_token"`
+	TripID       int    `json:"trip_id"`
+	GraceSeconds int    `json:"grace_seconds"`
+}
+
+func (Session) MessageType() Type { return TypeSession }
+
+// Status is a change of the ride's status: PENDING while searching, then
+// the trip's status once matched
+type Status struct {
+	Status  string `json:"status"`
+	TripID  int    `json:"trip_id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (Status) MessageType() Type { return TypeStatus }
+
+// Matched names the cab the rider was matched into
+type Matched struct {
+	CabID   string `json:"cab_id"`
+	TripID  int    `json:"trip_id"`
+	Message string `json:"message,omitempty"`
+}
+
+func (Matched) MessageType() Type { return TypeMatched }
+
+// DriverLocation is a location ping of the rider's cab
+type DriverLocation struct {
+	CabID string  `json:"cab_id"`
+	Lat   float64 `json:"lat"`
+	Lng   float64 `json:"lng"`
+}
+
+func (DriverLocation) MessageType() Type { return TypeDriverLocation }
+
+// ETA targets
+const (
+	TargetPickup = "PICKUP"
+	TargetDrop   = "DROP"
+)
+
+// ETA is how far the rider's cab is from the pickup, or from the drop once
+// the rider is on board
+type ETA struct {
+	CabID      string  `json:"cab_id"`
+	TripID     int     `json:"trip_id"`
+	Target     string  `json:"target"`
+	DistanceKm float64 `json:"distance_km"`
+	Seconds    int     `json:"seconds"`
+}
+
+func (ETA) MessageType() Type { return TypeETA }
+
+// Pong answers a Ping with its ID
+type Pong struct {
+	ID string `json:"id,omitempty"`
+}
+
+func (Pong) MessageType() Type { return TypePong }
+
+// Restarting tells the rider the server is going away, the trip is kept and
+// the rider reconnects
+type Restarting struct {
+	TripID  int    `json:"trip_id"`
+	Message string `json:"message"`
+}
+
+func (Restarting) MessageType() Type { return TypeRestarting }
+
+// NoCab tells the rider no cab could take them in time, the trip is
+// cancelled and the socket closes
+type NoCab struct {
+	TripID  int    `json:"trip_id"`
+	Message string `json:"message"`
+}
+
+func (NoCab) MessageType() Type { return TypeNoCab }
+
+// Error is the REST error envelope sent as a frame
+type Error struct {
+	response.Error
+}
+
+func (Error) MessageType() Type { return TypeError }
+
+// Fail returns the error frame for the HTTP status
+func Fail(status int, message string) Error {
+	return Error{response.New(status, message)}
+}
+
+// Invalid returns the error frame for a frame that could not be decoded or
+// failed validation
+func Invalid(err error) Error {
+	if errors.Is(err, ErrUnknownType) {
+		return Fail(http.StatusBadRequest, err.Error())
+	}
+	return Error{response.Invalid(err)}
+}
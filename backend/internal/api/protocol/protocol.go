@@ -0,0 +1,126 @@
+// Package protocol is version 1 of the ride request WebSocket protocol.
+//
+// Every frame is a JSON envelope naming the message type, the message
+// itself is its payload:
+//
+//	{"type": "REQUEST", "payload": {"lat": 23.26, "lng": 77.41, "tolerance": 0.3}}
+//
+// The rider opens the socket offering the Subprotocol, sends one REQUEST
+// and then CANCEL or PING frames. The server answers with STATUS, MATCHED,
+// DRIVER_LOCATION, ETA, PONG, RESTARTING and ERROR frames until the trip is
+// over. Sockets opened without a subprotocol speak this version as well.
+//
+// The JSON schema of all messages is generated from this package, see
+// cmd/wsschema.
+package protocol
+
+//go:generate go run ../../../cmd/wsschema -o ../../../../dashboard/src/protocol/ride.v1.schema.json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// Version is the protocol version implemented by this package
+const Version = 1
+
+// Subprotocol is negotiated on the WebSocket upgrade
+const Subprotocol = "ride.v1"
+
+// Type names the message carried by an envelope
+type Type string
+
+// Messages sent by the rider
+const (
+	TypeRequest Type = "REQUEST"
+	TypeCancel  Type = "CANCEL"
+	TypePing    Type = "PING"
+)
+
+// Messages sent by the server
+const (
+	TypeSession        Type = "SESSION"
+	TypeStatus         Type = "STATUS"
+	TypeMatched        Type = "MATCHED"
+	TypeDriverLocation Type = "DRIVER_LOCATION"
+	TypeETA            Type = "ETA"
+	TypePong           Type = "PONG"
+	TypeRestarting     Type = "RESTARTING"
+	TypeNoCab          Type = "NO_CAB"
+	TypeError          Type = "ERROR"
+)
+
+// ErrUnknownType is returned for frames of a type the rider may not send
+var ErrUnknownType = errors.New("unknown message type")
+
+// Envelope is a single frame on the socket
+type Envelope struct {
+	Type    Type            `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Message is a message sent by the server
+type Message interface {
+	MessageType() Type
+}
+
+// Supported reports whether the upgrade request can be served, it either
+// offers no subprotocol or offers this version's
+func Supported(r *http.Request) bool {
+	offered := websocket.Subprotocols(r)
+	return len(offered) == 0 || slices.Contains(offered, Subprotocol)
+}
+
+// Encode wraps the message in its envelope
+func Encode(m Message) (Envelope, error) {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Type: m.MessageType(), Payload: payload}, nil
+}
+
+// Write sends the message on the socket
+func Write(ws *websocket.Conn, m Message) error {
+	e, err := Encode(m)
+	if err != nil {
+		return err
+	}
+	return ws.WriteJSON(e)
+}
+
+// Decode reads a frame sent by the rider. The payload is a *Request,
+// *Cancel or *Ping; it is decoded but not validated.
+func Decode(raw []byte) (Type, any, error) {
+	var e Envelope
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return "", nil, err
+	}
+
+	var payload any
+	switch e.Type {
+	case TypeRequest:
+		payload = &Request{}
+	case TypeCancel:
+		payload = &Cancel{}
+	case TypePing:
+		payload = &Ping{}
+	case "":
+		return "", nil, fmt.Errorf("%w, the frame has no type", ErrUnknownType)
+	default:
+		return e.Type, nil, fmt.Errorf("%w %q", ErrUnknownType, e.Type)
+	}
+
+	if len(e.Payload) > 0 && string(e.Payload) != "null" {
+		if err := json.Unmarshal(e.Payload, payload); err != nil {
+			return e.Type, nil, err
+		}
+	}
+
+	return e.Type, payload, nil
+}
@@ -0,0 +1,215 @@
+package protocol
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// clientMessage is a message the client may send, with its payload
+type clientMessage struct {
+	Type    Type
+	Payload any
+}
+
+// clientMessages lists what the rider may send
+var clientMessages = []clientMessage{
+	{TypeRequest, Request{}},
+	{TypeCancel, Cancel{}},
+	{TypePing, Ping{}},
+}
+
+// serverMessages lists what the server sends
+var serverMessages = []Message{
+	Session{},
+	Status{},
+	Matched{},
+	DriverLocation{},
+	ETA{},
+	Pong{},
+	Restarting{},
+	NoCab{},
+	Error{},
+}
+
+// Schema returns the JSON schema (draft 2020-12) of this protocol version.
+// Frames sent by the rider match $defs/ClientMessage, frames sent by the
+// server $defs/ServerMessage. Payload properties and their constraints are
+// read from the json and binding tags of the message types.
+func Schema() map[string]any {
+	return schema(Subprotocol, "Ride request WebSocket protocol", clientMessages, serverMessages)
+}
+
+func schema(subprotocol, title string, clientMessages []clientMessage, serverMessages []Message) map[string]any {
+	g := &schemaGen{defs: map[string]any{}}
+
+	client := make([]any, len(clientMessages))
+	for i, m := range clientMessages {
+		g.output = false
+		client[i] = g.envelope(m.Type, reflect.TypeOf(m.Payload))
+	}
+
+	server := make([]any, len(serverMessages))
+	for i, m := range serverMessages {
+		g.output = true
+		server[i] = g.envelope(m.MessageType(), reflect.TypeOf(m))
+	}
+
+	g.defs["ClientMessage"] = map[string]any{"oneOf": client}
+	g.defs["ServerMessage"] = map[string]any{"oneOf": server}
+
+	return map[string]any{
+		"$schema":       "https://json-schema.org/draft/2020-12/schema",
+		"$id":           subprotocol,
+		"title":         title + ", version " + strconv.Itoa(Version),
+		"x-subprotocol": subprotocol,
+		"$defs":         g.defs,
+	}
+}
+
+type schemaGen struct {
+	defs map[string]any
+	// output is set for messages the server sends, their fields are present
+	// unless omitempty. Fields sent by the rider are required by binding tag.
+	output bool
+}
+
+// envelope is the schema of the frame carrying a message of the type, its
+// payload is required when the message has required fields
+func (g *schemaGen) envelope(typ Type, payload reflect.Type) map[string]any {
+	ref := g.ref(payload)
+
+	required := []string{"type"}
+	if def, ok := g.defs[payload.Name()].(map[string]any); ok && def["required"] != nil {
+		required = append(required, "payload")
+	}
+
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":    map[string]any{"const": string(typ)},
+			"payload": ref,
+		},
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// ref adds the struct to $defs, once, and returns a reference to it
+func (g *schemaGen) ref(t reflect.Type) map[string]any {
+	ref := map[string]any{"$ref": "#/$defs/" + t.Name()}
+	if _, ok := g.defs[t.Name()]; ok {
+		return ref
+	}
+
+	// placeholder for recursive types
+	g.defs[t.Name()] = true
+
+	properties := map[string]any{}
+	var required []string
+	g.fields(t, properties, &required)
+
+	def := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		def["required"] = required
+	}
+	g.defs[t.Name()] = def
+
+	return ref
+}
+
+// fields adds the struct's JSON fields, promoting those of embedded structs
+// the way encoding/json does
+func (g *schemaGen) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := g.schemaOf(f.Type)
+		bound := constrain(s, f.Type, strings.Split(f.Tag.Get("binding"), ","))
+		if g.output {
+			bound = !strings.Contains(opts, "omitempty")
+		}
+		if bound {
+			*required = append(*required, name)
+		}
+		properties[name] = s
+	}
+}
+
+func (g *schemaGen) schemaOf(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return g.ref(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+// constrain adds the binding rules to the field's schema and reports
+// whether the field is required
+func constrain(s map[string]any, t reflect.Type, rules []string) bool {
+	required := false
+	text := t.Kind() == reflect.String
+
+	for _, rule := range rules {
+		tag, param, _ := strings.Cut(rule, "=")
+		n, numErr := strconv.ParseFloat(param, 64)
+
+		switch {
+		case tag == "required":
+			required = true
+		case tag == "latitude":
+			s["minimum"], s["maximum"] = -90, 90
+		case tag == "longitude":
+			s["minimum"], s["maximum"] = -180, 180
+		case tag == "email":
+			s["format"] = "email"
+		case tag == "oneof":
+			s["enum"] = strings.Fields(param)
+		case tag == "tolerance":
+			// the upper bound is MAX_TOLERANCE of the server
+			s["exclusiveMinimum"] = 0
+		case numErr != nil:
+			continue
+		case tag == "gte" || (tag == "min" && !text):
+			s["minimum"] = n
+		case tag == "lte" || (tag == "max" && !text):
+			s["maximum"] = n
+		case tag == "gt":
+			s["exclusiveMinimum"] = n
+		case tag == "lt":
+			s["exclusiveMaximum"] = n
+		case tag == "min":
+			s["minLength"] = n
+		case tag == "max":
+			s["maxLength"] = n
+		}
+	}
+
+	return required
+}
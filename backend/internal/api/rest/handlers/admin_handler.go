@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type AdminHandler struct {
+	rideService  ride.Service
+	queueService queue.QueueService
+	tokens       *auth.Tokens
+	// password operators log in with, login is disabled when empty
+	password string
+	logger   *slog.Logger
+}
+
+func NewAdminHandler(rideService ride.Service, queueService queue.QueueService, tokens *auth.Tokens, password string, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		rideService:  rideService,
+		queueService: queueService,
+		tokens:       tokens,
+		password:     password,
+		logger:       logger,
+	}
+}
+
+// Login answers with an operator access token for the configured password
+func (h *AdminHandler) Login(c *gin.Context) {
+	r := request.GetReqBody[request.AdminLoginRequest](c)
+
+	if h.password == "" {
+		response.Fail(c, http.StatusForbidden, "admin login is disabled")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Password), []byte(h.password)) != 1 {
+		h.logger.WarnContext(c.Request.Context(), "failed admin login", "client_ip", c.ClientIP())
+		response.Fail(c, http.StatusUnauthorized, "invalid password")
+		return
+	}
+
+	token, expiresAt, err := h.tokens.Issue(auth.Admin())
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to issue access token", logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, "failed to issue access token")
+		return
+	}
+
+	h.logger.InfoContext(c.Request.Context(), "admin logged in", "client_ip", c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_at":   expiresAt,
+	})
+}
+
+// InspectCell returns the riders waiting in a geohash cell and the live
+// state of the cabs in it
+func (h *AdminHandler) InspectCell(c *gin.Context) {
+	cell, err := h.rideService.InspectCell(c.Request.Context(), c.Param("geohash"))
+	if errors.Is(err, ride.ErrInvalidCell) {
+		response.Fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to inspect cell", "geohash", c.Param("geohash"), logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cabs := make([]gin.H, len(cell.Cabs))
+	for i, cab := range cell.Cabs {
+		cabs[i] = gin.H{
+			"cab_id":           cab.ID,
+			"driver_id":        cab.DriverID,
+			"status":           cab.Status,
+			"lat":              cab.Latitude,
+			"lng":              cab.Longitude,
+			"passenger_count":  cab.PassengerCount,
+			"luggage_count":    cab.LuggageCount,
+			"capacity":         cab.Capacity,
+			"luggage_capacity": cab.LuggageCapacity,
+			"vehicle_class":    cab.VehicleClass,
+			"last_update_ts":   cab.LastUpdate,
+		}
+	}
+
+	waiting := cell.WaitingRiders
+	if waiting == nil {
+		waiting = []int{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"geohash":        cell.Geohash,
+		"waiting_riders": waiting,
+		"cabs":           cabs,
+	})
+}
+
+// ForceCancelTrip cancels a trip in any state but the terminal ones
+func (h *AdminHandler) ForceCancelTrip(c *gin.Context) {
+	tripID, err := strconv.Atoi(c.Param("tripID"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, "invalid trip id")
+		return
+	}
+
+	trip, err := h.rideService.ForceCancelTrip(c.Request.Context(), tripID)
+	if err != nil {
+		h.logger.WarnContext(c.Request.Context(), "failed to force-cancel trip", logging.TripID(tripID), logging.Err(err))
+		writeTripError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tripJSON(trip))
+}
+
+// DrainQueue takes waiting ride requests off the matching queue and cancels
+// their trips, the riders are told on their sockets
+func (h *AdminHandler) DrainQueue(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	bodies, err := h.queueService.DrainQueue(queryLimit(c))
+	if err != nil && len(bodies) == 0 {
+		h.logger.ErrorContext(ctx, "failed to drain queue", logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cancelled := []int{}
+	for _, body := range bodies {
+		var req ride.Rider
+		if jsonErr := json.Unmarshal(body, &req); jsonErr != nil || req.TripID == 0 {
+			h.logger.WarnContext(ctx, "drained job is not a ride request", "bytes", len(body))
+			continue
+		}
+
+		if _, cancelErr := h.rideService.ForceCancelTrip(ctx, req.TripID); cancelErr != nil {
+			h.logger.WarnContext(ctx, "failed to cancel trip of drained job", logging.TripID(req.TripID), logging.RiderID(req.ID), logging.Err(cancelErr))
+			continue
+		}
+		cancelled = append(cancelled, req.TripID)
+	}
+
+	if err != nil {
+		h.logger.ErrorContext(ctx, "queue drain stopped early", "drained", len(bodies), "cancelled", len(cancelled), logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"code": response.CodeInternal, "message": err.Error(), "drained": len(bodies), "cancelled_trips": cancelled})
+		return
+	}
+
+	h.logger.WarnContext(ctx, "drained queue", "drained", len(bodies), "cancelled", len(cancelled))
+	c.JSON(http.StatusOK, gin.H{"drained": len(bodies), "cancelled_trips": cancelled})
+}
+
+// ListDeadLetters returns dead-lettered ride requests without consuming them
+func (h *AdminHandler) ListDeadLetters(c *gin.Context) {
+	letters, err := h.queueService.PeekDeadLetters(queryLimit(c))
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to read dead letters", logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	out := make([]gin.H, len(letters))
+	for i, l := range letters {
+		var body any = string(l.Body)
+		if json.Valid(l.Body) {
+			body = json.RawMessage(l.Body)
+		}
+
+		out[i] = gin.H{
+			"message_id":  l.MessageID,
+			"retry_count": l.RetryCount,
+			"error":       l.Error,
+			"body":        body,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"count": len(out), "dead_letters": out})
+}
+
+// ReplayDeadLetters puts dead-lettered ride requests back on the matching queue
+func (h *AdminHandler) ReplayDeadLetters(c *gin.Context) {
+	n, err := h.queueService.ReplayDeadLetters(queryLimit(c))
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to replay dead letters", "replayed", n, logging.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"code": response.CodeInternal, "message": err.Error(), "replayed": n})
+		return
+	}
+
+	h.logger.InfoContext(c.Request.Context(), "replayed dead letters", "replayed", n)
+	c.JSON(http.StatusOK, gin.H{"replayed": n})
+}
+
+func queryLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+	return min(limit, maxLimit)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+)
+
+type DriverHandler struct {
+	service  driver.Service
+	hub      *events.DriverHub
+	sessions *Sessions
+	tokens   *auth.Tokens
+	logger   *slog.Logger
+}
+
+func NewDriverHandler(service driver.Service, hub *events.DriverHub, sessions *Sessions, tokens *auth.Tokens, logger *slog.Logger) *DriverHandler {
+	return &DriverHandler{
+		service:  service,
+		hub:      hub,
+		sessions: sessions,
+		tokens:   tokens,
+		logger:   logger,
+	}
+}
+
+func (h *DriverHandler) RegisterDriver(c *gin.Context) {
+	r := request.GetReqBody[request.RegisterDriverRequest](c)
+
+	d, err := h.service.RegisterDriver(c.Request.Context(), driver.Driver{
+		Name:          r.Name,
+		Phone:         r.Phone,
+		VehicleNumber: r.VehicleNumber,
+		Capacity:      r.Capacity,
+		VehicleClass:  ride.VehicleClass(r.VehicleClass),
+	}, r.Password)
+	if err != nil {
+		h.logger.WarnContext(c.Request.Context(), "failed to register driver", logging.Err(err))
+		h.writeError(c, err)
+		return
+	}
+
+	h.logger.InfoContext(c.Request.Context(), "driver registered", "driver_id", d.ID, logging.CabID(d.CabID))
+
+	h.writeToken(c, http.StatusCreated, d)
+}
+
+func (h *DriverHandler) Login(c *gin.Context) {
+	r := request.GetReqBody[request.DriverLoginRequest](c)
+
+	d, err := h.service.Login(c.Request.Context(), r.Phone, r.Password)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeToken(c, http.StatusOK, d)
+}
+
+// writeToken answers with the driver's cab and a fresh access token
+// allowed to act for it
+func (h *DriverHandler) writeToken(c *gin.Context, status int, d *driver.Driver) {
+	token, expiresAt, err := h.tokens.Issue(auth.Driver(d.ID, d.CabID))
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to issue access token", "driver_id", d.ID, logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, "failed to issue access token")
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"driver_id":     d.ID,
+		"cab_id":        d.CabID,
+		"capacity":      d.Capacity,
+		"vehicle_class": d.VehicleClass,
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_at":    expiresAt,
+	})
+}
+
+func (h *DriverHandler) GoOnline(c *gin.Context) {
+	r := request.GetReqBody[request.Location](c)
+
+	cab, err := h.service.GoOnline(c.Request.Context(), c.Param("cabID"), r.Lat, r.Lng)
+	if err != nil {
+		h.logger.WarnContext(c.Request.Context(), "failed to bring cab online", logging.CabID(c.Param("cabID")), logging.Err(err))
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cabJSON(cab))
+}
+
+func (h *DriverHandler) GoOffline(c *gin.Context) {
+	if err := h.service.GoOffline(c.Request.Context(), c.Param("cabID")); err != nil {
+		h.logger.WarnContext(c.Request.Context(), "failed to take cab offline", logging.CabID(c.Param("cabID")), logging.Err(err))
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cab_id": c.Param("cabID"), "status": driver.CabOffline})
+}
+
+// GetCab returns the cab's live state including its remaining stops. Riders
+// only see the cab they are assigned to.
+func (h *DriverHandler) GetCab(c *gin.Context) {
+	cab, err := h.service.GetCab(c.Request.Context(), c.Param("cabID"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	identity, _ := auth.IdentityFrom(c.Request.Context())
+	if !identity.OwnsCab(cab.ID) && !(identity.Is(auth.RoleRider) && slices.Contains(cab.RiderIDs, identity.RiderID)) {
+		response.Fail(c, http.StatusForbidden, "not assigned to this cab")
+		return
+	}
+
+	c.JSON(http.StatusOK, cabJSON(cab))
+}
+
+func (h *DriverHandler) UpdateLocation(c *gin.Context) {
+	r := request.GetReqBody[request.Location](c)
+
+	cab, err := h.service.UpdateLocation(c.Request.Context(), c.Param("cabID"), r.Lat, r.Lng)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cabJSON(cab))
+}
+
+func (h *DriverHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, driver.ErrInvalidCredentials):
+		response.Fail(c, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, driver.ErrDriverNotFound),
+		errors.Is(err, driver.ErrOfferNotFound):
+		response.Fail(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, driver.ErrDriverExists),
+		errors.Is(err, driver.ErrCabOffline),
+		errors.Is(err, driver.ErrCabHasPassengers):
+		response.Fail(c, http.StatusConflict, err.Error())
+	case errors.Is(err, ride.ErrUnknownVehicleClass),
+		errors.Is(err, driver.ErrWeakPassword),
+		errors.Is(err, driver.ErrTooManySeats):
+		response.Fail(c, http.StatusBadRequest, err.Error())
+	default:
+		response.Fail(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func cabJSON(cab *driver.Cab) gin.H {
+	return gin.H{
+		"cab_id":           cab.ID,
+		"status":           cab.Status,
+		"lat":              cab.Latitude,
+		"lng":              cab.Longitude,
+		"geohash":          cab.Geohash,
+		"passenger_count":  cab.PassengerCount,
+		"luggage_count":    cab.LuggageCount,
+		"capacity":         cab.Capacity,
+		"luggage_capacity": cab.LuggageCapacity,
+		"vehicle_class":    cab.VehicleClass,
+		"last_update_ts":   cab.LastUpdate.Unix(),
+		"offers":           cab.Offers.Offered,
+		"acceptance_rate":  cab.Offers.AcceptanceRate(),
+		"stops":            stopsJSON(cab.Stops),
+	}
+}
+
+func stopsJSON(stops []ride.Stop) []ride.Stop {
+	if stops == nil {
+		return []ride.Stop{}
+	}
+	return stops
+}
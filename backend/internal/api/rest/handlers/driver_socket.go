@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/metrics"
+)
+
+var driverUpgrader = websocket.Upgrader{
+	Subprotocols: []string{protocol.DriverSubprotocol},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// driverAnswer is the driver's answer to the offer of a rider
+type driverAnswer struct {
+	riderID int
+	accept  bool
+}
+
+// StreamEvents streams the cab's events to its driver: the route once, then
+// offers, new riders, cancellations and a full pool as they happen. The
+// driver answers offers on the same socket.
+func (h *DriverHandler) StreamEvents(c *gin.Context) {
+	if !protocol.SupportedDriver(c.Request) {
+		response.Fail(c, http.StatusBadRequest, "unsupported subprotocol, expected "+protocol.DriverSubprotocol)
+		return
+	}
+
+	ctx := c.Request.Context()
+	cabID := c.Param("cabID")
+
+	done, closing, ok := h.sessions.Track()
+	if !ok {
+		response.Fail(c, http.StatusServiceUnavailable, restartingMsg)
+		return
+	}
+	defer done()
+
+	// subscribe before reading the route so no change falls in between
+	cabEvents, unsubscribe := h.hub.Subscribe(cabID)
+	defer unsubscribe()
+
+	cab, err := h.service.GetCab(ctx, cabID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	ws, err := driverUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.WarnContext(ctx, "WebSocket upgrade failed", logging.Err(err))
+		return
+	}
+	defer ws.Close()
+
+	metrics.WebSocketsActive.WithLabelValues("driver").Inc()
+	defer metrics.WebSocketsActive.WithLabelValues("driver").Dec()
+
+	h.logger.InfoContext(ctx, "driver connected to cab events", logging.CabID(cabID))
+
+	_ = protocol.Write(ws, protocol.Route{CabID: cabID, Stops: stopsJSON(cab.Stops)})
+
+	replies, answers, disconnected := readDriverSocket(ws)
+
+	for {
+		select {
+		case <-disconnected:
+			return
+
+		case m := <-replies:
+			_ = protocol.Write(ws, m)
+
+		case a := <-answers:
+			h.answerOffer(ctx, ws, cabID, a)
+
+		case <-closing:
+			// drivers read their route again once reconnected
+			_ = ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseServiceRestart, restartingMsg),
+				time.Now().Add(time.Second))
+			return
+
+		case e := <-cabEvents:
+			h.writeEvent(ctx, ws, e)
+		}
+	}
+}
+
+// answerOffer hands the driver's answer to the matching worker. A declined
+// rider leaves the route, which is sent again.
+func (h *DriverHandler) answerOffer(ctx context.Context, ws *websocket.Conn, cabID string, a driverAnswer) {
+	err := h.service.AnswerOffer(ctx, cabID, a.riderID, a.accept)
+	switch {
+	case errors.Is(err, driver.ErrOfferNotFound):
+		_ = protocol.Write(ws, protocol.Fail(http.StatusNotFound, err.Error()))
+	case errors.Is(err, driver.ErrOfferClosed):
+		_ = protocol.Write(ws, protocol.Fail(http.StatusConflict, err.Error()))
+	case err != nil:
+		h.logger.ErrorContext(ctx, "failed to answer offer", logging.CabID(cabID), logging.RiderID(a.riderID), logging.Err(err))
+		_ = protocol.Write(ws, protocol.Fail(http.StatusInternalServerError, "failed to answer offer"))
+	case !a.accept:
+		cab, err := h.service.GetCab(ctx, cabID)
+		if err != nil {
+			h.logger.WarnContext(ctx, "failed to read route of cab", logging.CabID(cabID), logging.Err(err))
+			return
+		}
+		_ = protocol.Write(ws, protocol.Route{CabID: cabID, Stops: stopsJSON(cab.Stops)})
+	}
+}
+
+// writeEvent sends the event to the driver. Changes of the route carry the
+// route as it is now, which may already include later changes.
+func (h *DriverHandler) writeEvent(ctx context.Context, ws *websocket.Conn, e events.DriverEvent) {
+	if e.Type == events.TypePoolFull {
+		_ = protocol.Write(ws, protocol.PoolFull{CabID: e.CabID, PassengerCount: e.PassengerCount, Capacity: e.Capacity})
+		return
+	}
+
+	cab, err := h.service.GetCab(ctx, e.CabID)
+	if err != nil {
+		h.logger.WarnContext(ctx, "failed to read route of cab", logging.CabID(e.CabID), logging.Err(err))
+		return
+	}
+	stops := stopsJSON(cab.Stops)
+
+	switch e.Type {
+	case events.TypeOffered:
+		expiresIn := max(0, int(time.Until(time.Unix(e.ExpiresAt, 0)).Seconds()))
+		_ = protocol.Write(ws, protocol.Offer{CabID: e.CabID, RiderID: e.RiderID, TripID: e.TripID, ExpiresInSeconds: expiresIn, Stops: stops})
+	case events.TypeOfferExpired:
+		_ = protocol.Write(ws, protocol.OfferExpired{CabID: e.CabID, RiderID: e.RiderID, TripID: e.TripID, Stops: stops})
+	case events.TypeAssigned:
+		_ = protocol.Write(ws, protocol.Assigned{CabID: e.CabID, RiderID: e.RiderID, TripID: e.TripID, Stops: stops})
+	case events.TypeRiderCancelled:
+		_ = protocol.Write(ws, protocol.RiderCancelled{CabID: e.CabID, RiderID: e.RiderID, TripID: e.TripID, Stops: stops})
+	}
+}
+
+// readDriverSocket reads the driver's frames, answering pings and invalid
+// frames through replies and passing answers to offers on. disconnected is
+// closed once the socket cannot be read anymore.
+func readDriverSocket(ws *websocket.Conn) (<-chan protocol.Message, <-chan driverAnswer, <-chan struct{}) {
+	replies := make(chan protocol.Message, 8)
+	answers := make(chan driverAnswer, 8)
+	disconnected := make(chan struct{})
+
+	reply := func(m protocol.Message) {
+		select {
+		case replies <- m:
+		default:
+		}
+	}
+
+	// answers are never dropped, the driver would wait for an offer the
+	// worker expires
+	answer := func(a driverAnswer) {
+		select {
+		case answers <- a:
+		case <-disconnected:
+		}
+	}
+
+	go func() {
+		defer close(disconnected)
+
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			typ, payload, err := protocol.DecodeDriver(raw)
+			if err == nil {
+				err = request.Validate(payload)
+			}
+			if err != nil {
+				reply(protocol.Invalid(err))
+				continue
+			}
+
+			switch typ {
+			case protocol.TypePing:
+				reply(protocol.Pong{ID: payload.(*protocol.Ping).ID})
+			case protocol.TypeAccept:
+				answer(driverAnswer{riderID: payload.(*protocol.Accept).RiderID, accept: true})
+			case protocol.TypeDecline:
+				answer(driverAnswer{riderID: payload.(*protocol.Decline).RiderID})
+			}
+		}
+	}()
+
+	return replies, answers, disconnected
+}
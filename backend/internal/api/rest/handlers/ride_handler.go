@@ -2,205 +2,468 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"strconv"
 	// "sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
 	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
 	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
-	"github.com/mmcloughlin/geohash"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-	"log"
 	"net/http"
 )
 
+// statusPollInterval is how often the rider status is read from redis in
+// case a pushed event was missed, e.g. while the hub was resubscribing
+const statusPollInterval = 2 * time.Second
+
+// restartingMsg tells the rider to open a new socket, the trip is kept
+const restartingMsg = "server restarting, reconnect"
+
+// noCabMsg tells the rider their trip was cancelled as no cab took them
+const noCabMsg = "no cab available, try again later"
+
 type RideHandler struct {
     service ride.Service
+    hub     *events.Hub
+    sessions *Sessions
+    // grace is how long a ride survives without a rider socket
+    grace   time.Duration
+    logger  *slog.Logger
 }
 
-func NewRideHandler(service ride.Service) *RideHandler{
+func NewRideHandler(service ride.Service, hub *events.Hub, sessions *Sessions, grace time.Duration, logger *slog.Logger) *RideHandler{
     return &RideHandler{
         service: service,
+        hub:     hub,
+        sessions: sessions,
+        grace:   grace,
+        logger:  logger,
     }
 }
 
 func (h *RideHandler) RequestRide(c *gin.Context) {
+	if !protocol.Supported(c.Request) {
+		response.Fail(c, http.StatusBadRequest, "unsupported subprotocol, expected "+protocol.Subprotocol)
+		return
+	}
 
-	log.Printf("Handling Request Ride  request....")
-	// riderReq := request.GetReqBody[request.RideRequest](c)
-    
+	done, closing, ok := h.sessions.Track()
+	if !ok {
+		response.Fail(c, http.StatusServiceUnavailable, restartingMsg)
+		return
+	}
+	defer done()
 
-	log.Println("!!!")
 	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
+		h.logger.WarnContext(c.Request.Context(), "WebSocket upgrade failed", logging.Err(err))
 		return
 	}
 	defer ws.Close()
 
-	var riderReq request.RideRequest
+	metrics.WebSocketsActive.WithLabelValues("rider").Inc()
+	defer metrics.WebSocketsActive.WithLabelValues("rider").Dec()
 
-	riderID, _, err := h.service.GetRiderandTripID(c.Request.Context())
-	riderReq.RiderID = riderID
+	ctx := c.Request.Context()
 
-	if err := ws.ReadJSON(&riderReq); err != nil {
-		log.Println("ReadJSON error:", err)
+	// the route is authenticated, the rider is whoever the token names
+	identity, _ := auth.IdentityFrom(ctx)
+	riderID := identity.RiderID
+
+	// the request is checked before a trip is opened for it
+	riderReq, ok := h.readRideRequest(ctx, ws, riderID)
+	if !ok {
 		return
 	}
-	geohash := geohash.Encode(riderReq.Lat, riderReq.Lng)
-	log.Println("hi!!!!")
-
-	ctx, cancelCtx := context.WithCancel(c.Request.Context())
-	defer cancelCtx()
+	geohash := ride.CellOf(riderReq.Lat, riderReq.Lng)
 
-	cancelChan := make(chan struct{})
-
-	// ---- WS Reader Goroutine (listen for CANCEL / disconnect) ----
-	go func() {
-		for {
-			var msg map[string]any
-			if err := ws.ReadJSON(&msg); err != nil {
-				// client disconnected
-				cancelCtx()
-				return
-			}
+	drop, err := h.resolveDestination(riderReq.Destination, riderReq.Drop)
+	if err != nil {
+		_ = protocol.Write(ws, protocol.Fail(http.StatusBadRequest, err.Error()))
+		return
+	}
 
-			switch msg["type"] {
-			case "CANCEL_RIDE":
-				select {
-				case cancelChan <- struct{}{}:
-				default:
-				}
-				return
-			}
+	if riderReq.VehicleClass != "" {
+		if _, err := ride.LookupVehicleClass(riderReq.VehicleClass); err != nil {
+			_ = protocol.Write(ws, protocol.Fail(http.StatusBadRequest, err.Error()))
+			return
 		}
-	}()
+	}
+
+	tripID, err := h.service.CreateTrip(ctx, riderID)
+	if errors.Is(err, ride.ErrRideInProgress) {
+		_ = protocol.Write(ws, protocol.Fail(http.StatusConflict, err.Error()))
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to create trip", logging.RiderID(riderID), logging.Err(err))
+		_ = protocol.Write(ws, protocol.Fail(http.StatusInternalServerError, "failed to create trip"))
+		return
+	}
 
-	log.Println("RIDER!!!")
     req := ride.Rider{
-        ID: riderReq.RiderID,
+        ID: riderID,
         Latitude: riderReq.Lat,
         Longitude: riderReq.Lng,
+        TripID: tripID,
         Luggage: riderReq.Luggage,
+        Tolerance: riderReq.Tolerance,
         Geohash: geohash,
-
+        Destination: drop.Name,
+        DropLatitude: drop.Latitude,
+        DropLongitude: drop.Longitude,
+        VehicleClass: ride.VehicleClass(riderReq.VehicleClass),
     }
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("rider.id", req.ID),
+		attribute.Int("trip.id", req.TripID),
+	)
+	logger := h.logger.With(logging.RiderID(req.ID), logging.TripID(req.TripID))
+
+	// subscribe before publishing the request so the match cannot be missed
+	riderEvents, unsubscribe := h.hub.Subscribe(req.ID)
+	defer unsubscribe()
+
 	if err := h.service.AddRiderPresence(ctx, req); err != nil {
-		log.Println("AddRiderPresence error:", err)
-		_ = ws.WriteJSON(gin.H{"type": "error", "message": "failed to add rider"})
+		logger.ErrorContext(ctx, "failed to add rider", logging.Err(err))
+		_ = protocol.Write(ws, protocol.Fail(http.StatusInternalServerError, "failed to add rider"))
 		return
 	}
 
-	_ = ws.WriteJSON(gin.H{
-		"type":   "status",
-		"status": "PENDING",
-		"msg":    "Searching for shared ride...",
+	session, err := h.service.OpenSession(ctx, req)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to open ride session", logging.Err(err))
+		h.rollback(ctx, req)
+		_ = protocol.Write(ws, protocol.Fail(http.StatusInternalServerError, "failed to open ride session"))
+		return
+	}
+
+	h.writeSession(ws, session)
+	_ = protocol.Write(ws, protocol.Status{
+		Status:  "PENDING",
+		TripID:  req.TripID,
+		Message: "Searching for shared ride...",
 	})
 
-	select {
-	case <-time.After(5 * time.Second):
-	case <-cancelChan:
-		h.rollback(ctx, riderReq,geohash)
-		_ = ws.WriteJSON(gin.H{"type": "status", "status": "CANCELLED"})
+	h.attend(ctx, ws, closing, riderEvents, session, attachment{publish: true})
+}
+
+// ResumeRide reattaches a rider to their ride session after the socket
+// dropped, replaying the ride's latest state before streaming it again
+func (h *RideHandler) ResumeRide(c *gin.Context) {
+	if !protocol.Supported(c.Request) {
+		response.Fail(c, http.StatusBadRequest, "unsupported subprotocol, expected "+protocol.Subprotocol)
 		return
-	case <-ctx.Done():
-		h.rollback(ctx, riderReq, geohash)
+	}
+
+	token := c.Query("session_token")
+	if token == "" {
+		response.Fail(c, http.StatusBadRequest, "missing session_token")
 		return
 	}
 
-	if _, err := h.service.RequestRide(ctx, req); err != nil {
-		log.Println("RequestRide publish error:", err)
-		h.rollback(ctx, riderReq, geohash)
-		_ = ws.WriteJSON(gin.H{"type": "error", "message": "failed to start matching"})
+	ctx := c.Request.Context()
+	identity, _ := auth.IdentityFrom(ctx)
+
+	done, closing, ok := h.sessions.Track()
+	if !ok {
+		response.Fail(c, http.StatusServiceUnavailable, restartingMsg)
 		return
 	}
+	defer done()
 
-	ticker := time.NewTicker(50 * time.Millisecond)
-	defer ticker.Stop()
+	session, err := h.service.ResumeSession(ctx, token, identity.RiderID)
+	if errors.Is(err, ride.ErrSessionNotFound) {
+		response.Fail(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to resume ride session", logging.RiderID(identity.RiderID), logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, "failed to resume ride session")
+		return
+	}
 
-	for {
-		select {
-		case <-cancelChan:
-			h.rollback(ctx, riderReq, geohash)
-			_ = ws.WriteJSON(gin.H{"type": "status", "status": "CANCELLED"})
-			return
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.WarnContext(ctx, "WebSocket upgrade failed", logging.Err(err))
+		return
+	}
+	defer ws.Close()
 
-		case <-ctx.Done():
-			h.rollback(ctx, riderReq, geohash)
-			return
+	metrics.WebSocketsActive.WithLabelValues("rider").Inc()
+	defer metrics.WebSocketsActive.WithLabelValues("rider").Dec()
 
-		case <-ticker.C:
-			status, cabID, err := h.service.GetRiderStatus(ctx, riderReq.RiderID)
-			if err != nil {
-				log.Println("GetRiderStatus error:", err)
-				continue
-			}
-
-			if status == "MATCHED" {
-				_ = ws.WriteJSON(gin.H{
-					"type":   "status",
-					"status": "MATCHED",
-					"cab_id": cabID,
-					"msg":    "Driver found!",
-				})
-				return
-			}
-
-			_ = ws.WriteJSON(gin.H{
-				"type":   "status",
-				"status": "PENDING",
-			})
-		}
+	req := session.Rider
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("rider.id", req.ID),
+		attribute.Int("trip.id", req.TripID),
+	)
+	h.logger.InfoContext(ctx, "ride session resumed", logging.RiderID(req.ID), logging.TripID(req.TripID), "epoch", session.Epoch)
+
+	// subscribe before reading the state so no event falls in between
+	riderEvents, unsubscribe := h.hub.Subscribe(req.ID)
+	defer unsubscribe()
+
+	h.writeSession(ws, session)
+
+	state, over := h.replay(ctx, ws, session)
+	if over {
+		return
 	}
+
+	h.attend(ctx, ws, closing, riderEvents, session, state)
 }
 
+func(h *RideHandler) CalculateFare(c *gin.Context){
 
+    r := request.GetReqBody[request.FareRequest](c)
 
-func(h *RideHandler) CalculateFare(c *gin.Context){
-    
-    log.Printf("Handling CalculateFare request..")
+    drop, err := h.resolveDestination(r.Destination, r.Drop)
+    if err != nil {
+        response.Fail(c, http.StatusBadRequest, err.Error())
+        return
+    }
 
-	log.Printf("hi")
-    r := request.GetReqBody[request.Location](c)
-    // geohash := geohash.Encode(r.Pickup.Lat, r.Pickup.Lng)
+    pickup := ride.Destination{Latitude: r.Lat, Longitude: r.Lng}
 
-    fare, err := h.service.CalculateFare(c.Request.Context(), r.Lat, r.Lng)
+    fare, err := h.service.CalculateFare(c.Request.Context(), pickup, drop, r.VehicleClass)
     if err != nil {
-        log.Printf("Error in calculating fare to airport: %s", err.Error())
-        c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+        h.logger.WarnContext(c.Request.Context(), "failed to calculate fare", "destination", drop.Name, logging.Err(err))
+        response.Fail(c, http.StatusBadRequest, err.Error())
 		return
     }
 
     c.JSON(http.StatusCreated, gin.H{
         "fare_id": fare.ID,
         "fare": fare.Amount,
+        "destination": drop.Name,
+        "vehicle_class": fare.VehicleClass,
     })
 }
 
+func (h *RideHandler) ListDestinations(c *gin.Context) {
+	hubs := h.service.ListDestinations()
+
+	out := make([]gin.H, len(hubs))
+	for i, d := range hubs {
+		out[i] = gin.H{"name": d.Name, "lat": d.Latitude, "lng": d.Longitude}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"destinations": out})
+}
+
+func (h *RideHandler) ListVehicleClasses(c *gin.Context) {
+	classes := ride.VehicleClasses()
+
+	out := make([]gin.H, len(classes))
+	for i, v := range classes {
+		out[i] = gin.H{
+			"vehicle_class":   v.Class,
+			"seats":           v.Seats,
+			"luggage":         v.Luggage,
+			"fare_multiplier": v.FareMultiplier,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vehicle_classes": out})
+}
+
+// resolveDestination prefers explicit drop coordinates, then a named hub,
+// then the configured default hub
+func (h *RideHandler) resolveDestination(name string, drop *request.Location) (ride.Destination, error) {
+	if drop != nil {
+		return ride.Destination{Name: name, Latitude: drop.Lat, Longitude: drop.Lng}, nil
+	}
+
+	return h.service.ResolveDestination(name)
+}
+
+
+// errTripUnderway is returned by rollback once the rider is on board
+var errTripUnderway = errors.New("trip already in progress")
+
+// rollback cancels the rider's trip and only then clears their state and
+// seat. A trip that is already in progress, or cannot be cancelled, is
+// left as it is.
+func (h *RideHandler) rollback(ctx context.Context, rider ride.Rider) error {
+	// the request context is usually already cancelled when the socket drops,
+	// cleanup must still reach redis and postgres
+	ctx = context.WithoutCancel(ctx)
+	logger := h.logger.With(logging.RiderID(rider.ID), logging.TripID(rider.TripID))
+
+	current, err := h.service.GetTrip(ctx, rider.TripID)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to read trip to cancel", logging.Err(err))
+		return err
+	}
+	if current.Status == ride.TripInProgress {
+		logger.InfoContext(ctx, "not cancelling trip in progress")
+		return errTripUnderway
+	}
+
+	logger.InfoContext(ctx, "cancelling ride request")
+
+	trip, err := h.service.AdvanceTrip(ctx, rider.TripID, ride.TripCancelled)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to cancel trip", logging.Err(err))
+		return err
+	}
 
-func (h *RideHandler) rollback(ctx context.Context, req request.RideRequest, geoHash string) {
 	// mare rider status as cancelled
-	_ = h.service.MarkRiderCancelled(ctx, req.RiderID)
+	_ = h.service.MarkRiderCancelled(ctx, rider.ID)
 
 	// remove from geohash set waiting pool
-	_ = h.service.RemoveFromWaitingPool(ctx, req.RiderID, geoHash)
+	_ = h.service.RemoveFromWaitingPool(ctx, rider.ID, rider.Geohash)
 
 	// check for assiged cab
-	cabID, err := h.service.GetAssignedCabIfAny(ctx, req.RiderID)
+	cabID, err := h.service.GetAssignedCabIfAny(ctx, rider.ID)
 	if err == nil && cabID != "" {
 		// release can and recaculate the min tolerance
-		_ = h.service.ReleaseCabSeat(ctx, cabID, req.RiderID)
+		_ = h.service.ReleaseCabSeat(ctx, cabID, rider.ID)
+	}
+
+	_ = h.service.DeleteRiderRedisKeys(ctx, rider.ID)
+
+	// cancelling tells the cab the trip was recorded in, the driver of a
+	// match not recorded yet is told here
+	if cabID != "" && trip.CabID != cabID {
+		_ = h.service.NotifyDriverCancellation(ctx, cabID, rider.ID, rider.TripID)
+	}
+
+	return nil
+}
+
+// leavePool clears a waiting rider whose trip was closed elsewhere
+func (h *RideHandler) leavePool(ctx context.Context, rider ride.Rider) {
+	ctx = context.WithoutCancel(ctx)
+
+	_ = h.service.RemoveFromWaitingPool(ctx, rider.ID, rider.Geohash)
+	_ = h.service.DeleteRiderRedisKeys(ctx, rider.ID)
+}
+
+func (h *RideHandler) GetTrip(c *gin.Context) {
+	tripID, err := strconv.Atoi(c.Param("tripID"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, "invalid trip id")
+		return
+	}
+
+	trip, err := h.service.GetTrip(c.Request.Context(), tripID)
+	if err != nil {
+		writeTripError(c, err)
+		return
+	}
+
+	identity, _ := auth.IdentityFrom(c.Request.Context())
+	if !canSeeTrip(identity, trip) {
+		response.Fail(c, http.StatusForbidden, "not your trip")
+		return
+	}
+
+	c.JSON(http.StatusOK, tripJSON(trip))
+}
 
-		_ = h.service.NotifyDriverCancellation(ctx, cabID, req.RiderID)
+func (h *RideHandler) UpdateTripStatus(c *gin.Context) {
+	tripID, err := strconv.Atoi(c.Param("tripID"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, "invalid trip id")
+		return
+	}
+
+	r := request.GetReqBody[request.TripStatusRequest](c)
+
+	status := ride.TripStatus(r.Status)
+	if !status.IsValid() {
+		response.Fail(c, http.StatusBadRequest, "unknown trip status " + r.Status)
+		return
 	}
 
-	_ = h.service.DeleteRiderRedisKeys(ctx, req.RiderID)
+	trip, err := h.service.GetTrip(c.Request.Context(), tripID)
+	if err != nil {
+		writeTripError(c, err)
+		return
+	}
+
+	// riders may only cancel their own trip, drivers move the trips of
+	// their cab along
+	identity, _ := auth.IdentityFrom(c.Request.Context())
+	if !canSeeTrip(identity, trip) {
+		response.Fail(c, http.StatusForbidden, "not your trip")
+		return
+	}
+	if identity.Is(auth.RoleRider) && status != ride.TripCancelled {
+		response.Fail(c, http.StatusForbidden, "riders can only cancel their trip")
+		return
+	}
+
+	trip, err = h.service.AdvanceTrip(c.Request.Context(), tripID, status)
+	if err != nil {
+		h.logger.WarnContext(c.Request.Context(), "failed to advance trip", logging.TripID(tripID), "status", status, logging.Err(err))
+		writeTripError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tripJSON(trip))
+}
+
+// canSeeTrip reports whether the identity may read the trip: its rider,
+// the driver of its cab or an operator
+func canSeeTrip(identity auth.Identity, trip *ride.Trip) bool {
+	if identity.Is(auth.RoleRider) {
+		return trip.RiderID == identity.RiderID
+	}
+	return identity.OwnsCab(trip.CabID)
+}
+
+func writeTripError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ride.ErrTripNotFound):
+		response.Fail(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, ride.ErrInvalidTransition),
+		errors.Is(err, ride.ErrTripConflict):
+		response.Fail(c, http.StatusConflict, err.Error())
+	default:
+		response.Fail(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func tripJSON(t *ride.Trip) gin.H {
+	events := make([]gin.H, len(t.Events))
+	for i, e := range t.Events {
+		events[i] = gin.H{"from": e.From, "to": e.To, "at": e.At}
+	}
+
+	return gin.H{
+		"trip_id":      t.TripID,
+		"rider_id":     t.RiderID,
+		"cab_id":       t.CabID,
+		"status":       t.Status,
+		"pickup":       gin.H{"lat": t.PickupLat, "lng": t.PickupLng},
+		"drop":         gin.H{"lat": t.DropLat, "lng": t.DropLng},
+		"created_at":   t.CreatedAt,
+		"started_at":   t.StartedAt,
+		"completed_at": t.CompletedAt,
+		"events":       events,
+	}
 }
 
 
 
 var upgrader = websocket.Upgrader{
+	Subprotocols: []string{protocol.Subprotocol},
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/protocol"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/metrics"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+)
+
+// searchDelay is how long a new request waits for a cancel before it is
+// published for matching
+const searchDelay = 5 * time.Second
+
+// attachment is where a socket picks up its ride session
+type attachment struct {
+	// publish is set on the socket the ride was requested on, the request
+	// is published for matching once searchDelay passed
+	publish bool
+	matched bool
+	// the ETA is to the pickup until the rider is on board, then to the drop
+	onBoard bool
+}
+
+// socketReader reads the rider's frames after the ride request
+type socketReader struct {
+	// replies are pongs and errors for invalid frames, sent by the writer
+	replies chan protocol.Message
+	cancel  chan struct{}
+	// disconnected is closed once the socket cannot be read anymore
+	disconnected chan struct{}
+}
+
+func readSocket(ws *websocket.Conn) *socketReader {
+	r := &socketReader{
+		replies:      make(chan protocol.Message, 8),
+		cancel:       make(chan struct{}, 1),
+		disconnected: make(chan struct{}),
+	}
+
+	reply := func(m protocol.Message) {
+		select {
+		case r.replies <- m:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(r.disconnected)
+
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			typ, payload, err := decodeFrame(raw)
+			if err != nil {
+				reply(protocol.Invalid(err))
+				continue
+			}
+
+			switch typ {
+			case protocol.TypePing:
+				reply(protocol.Pong{ID: payload.(*protocol.Ping).ID})
+			case protocol.TypeRequest:
+				reply(protocol.Fail(http.StatusConflict, "ride already requested on this socket"))
+			case protocol.TypeCancel:
+				select {
+				case r.cancel <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return r
+}
+
+// attend streams the ride to the rider's socket until the trip is over. A
+// dropped socket keeps the ride for the grace period so the rider can
+// resume it, a newer socket of the session takes the ride over.
+func (h *RideHandler) attend(ctx context.Context, ws *websocket.Conn, closing <-chan struct{}, riderEvents <-chan events.RiderEvent, session *ride.Session, state attachment) {
+	req := session.Rider
+	logger := h.logger.With(logging.RiderID(req.ID), logging.TripID(req.TripID))
+
+	reader := readSocket(ws)
+	disconnected := reader.disconnected
+
+	var searching <-chan time.Time
+	if state.publish {
+		timer := time.NewTimer(searchDelay)
+		defer timer.Stop()
+		searching = timer.C
+	}
+	// publishedAt is only set on the socket that published the request
+	var publishedAt time.Time
+	published := !state.publish
+
+	var grace <-chan time.Time
+
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	// cancel gives up the ride and closes its session. It reports false,
+	// leaving both alone, once the rider is on board.
+	cancel := func() bool {
+		if errors.Is(h.rollback(ctx, req), errTripUnderway) {
+			return false
+		}
+		h.closeSession(ctx, session)
+		return true
+	}
+
+	matched := func(cabID string) {
+		state.matched = true
+		if !publishedAt.IsZero() {
+			metrics.MatchLatency.Observe(time.Since(publishedAt).Seconds())
+		}
+		logger.InfoContext(ctx, "rider matched", logging.CabID(cabID))
+		writeMatched(ws, cabID, req.TripID)
+	}
+
+	for {
+		select {
+		case <-searching:
+			searching = nil
+
+			if _, err := h.service.RequestRide(ctx, req); err != nil {
+				logger.ErrorContext(ctx, "failed to start matching", logging.Err(err))
+				cancel()
+				frame := protocol.Fail(http.StatusInternalServerError, "failed to start matching")
+				if errors.Is(err, queue.ErrNotEnqueued) {
+					frame = protocol.Fail(http.StatusServiceUnavailable, "ride request could not be queued, try again")
+				}
+				_ = protocol.Write(ws, frame)
+				return
+			}
+			publishedAt = time.Now()
+			published = true
+
+		case m := <-reader.replies:
+			_ = protocol.Write(ws, m)
+
+		case <-reader.cancel:
+			if !cancel() {
+				_ = protocol.Write(ws, protocol.Fail(http.StatusConflict, "the trip is already in progress"))
+				continue
+			}
+			_ = protocol.Write(ws, protocol.Status{Status: string(ride.TripCancelled), TripID: req.TripID})
+			return
+
+		case <-disconnected:
+			disconnected = nil
+			logger.InfoContext(ctx, "rider socket dropped, keeping the ride", "grace", h.grace)
+
+			timer := time.NewTimer(h.grace)
+			defer timer.Stop()
+			grace = timer.C
+
+		case <-grace:
+			if h.superseded(ctx, session) {
+				return
+			}
+			logger.InfoContext(ctx, "rider did not resume the ride in time")
+			if !cancel() {
+				// the session stays open, the rider may still resume the ride
+				logger.InfoContext(ctx, "keeping the ride, the rider is on board")
+			}
+			return
+
+		case <-closing:
+			if !published {
+				// nothing was published yet, there is no match to resume
+				cancel()
+				writeRestarting(ws, req.TripID)
+				return
+			}
+			// the job stays queued and the session open, the rider resumes
+			// on another instance
+			logger.InfoContext(ctx, "closing rider socket for restart")
+			writeRestarting(ws, req.TripID)
+			return
+
+		case e := <-riderEvents:
+			switch e.Type {
+			case events.TypeCabLocation:
+				_ = protocol.Write(ws, protocol.DriverLocation{CabID: e.CabID, Lat: e.Lat, Lng: e.Lng})
+				if state.matched {
+					h.writeETA(ws, req, e, state.onBoard)
+				}
+
+			case events.TypeStatus:
+				switch e.Status {
+				case "MATCHED":
+					if !state.matched {
+						matched(e.CabID)
+					}
+				case events.StatusNoCab:
+					if e.TripID != req.TripID {
+						continue
+					}
+					// the worker cancelled the trip and cleared the rider
+					h.closeSession(ctx, session)
+					_ = protocol.Write(ws, protocol.NoCab{TripID: e.TripID, Message: noCabMsg})
+					return
+				case string(ride.TripCompleted), string(ride.TripCancelled):
+					if e.TripID != req.TripID {
+						continue
+					}
+					// the trip was closed elsewhere, seat and keys are already
+					// released. A rider still waiting has to leave the pool.
+					if !state.matched {
+						h.leavePool(ctx, req)
+					}
+					h.closeSession(ctx, session)
+					_ = protocol.Write(ws, protocol.Status{Status: e.Status, TripID: e.TripID})
+					return
+				default:
+					if e.Status == string(ride.TripInProgress) {
+						state.onBoard = true
+					}
+					_ = protocol.Write(ws, protocol.Status{Status: e.Status, TripID: e.TripID})
+				}
+			}
+
+		case <-ticker.C:
+			if published && h.superseded(ctx, session) {
+				// the rider resumed on a newer socket, which owns the ride now
+				logger.InfoContext(ctx, "ride session taken over by a newer socket")
+				return
+			}
+			if !published || state.matched {
+				continue
+			}
+
+			status, cabID, err := h.service.GetRiderStatus(ctx, req.ID)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to read rider status", logging.Err(err))
+				continue
+			}
+
+			if status == "MATCHED" {
+				matched(cabID)
+				continue
+			}
+
+			_ = protocol.Write(ws, protocol.Status{Status: "PENDING", TripID: req.TripID})
+		}
+	}
+}
+
+// superseded reports whether the rider resumed the session on a newer
+// socket. A session that is gone is superseded too, whoever closed it
+// finished the ride.
+func (h *RideHandler) superseded(ctx context.Context, session *ride.Session) bool {
+	epoch, err := h.service.SessionEpoch(context.WithoutCancel(ctx), session.Token)
+	if errors.Is(err, ride.ErrSessionNotFound) {
+		return true
+	}
+	if err != nil {
+		h.logger.WarnContext(ctx, "failed to read ride session", logging.TripID(session.Rider.TripID), logging.Err(err))
+		return false
+	}
+	return epoch != session.Epoch
+}
+
+// replay sends a resumed socket the ride's latest state. It reports over
+// when the trip already ended.
+func (h *RideHandler) replay(ctx context.Context, ws *websocket.Conn, session *ride.Session) (attachment, bool) {
+	req := session.Rider
+
+	trip, err := h.service.GetTrip(ctx, req.TripID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to read resumed trip", logging.TripID(req.TripID), logging.Err(err))
+		_ = protocol.Write(ws, protocol.Fail(http.StatusInternalServerError, "failed to read trip"))
+		return attachment{}, true
+	}
+
+	if trip.Status.IsTerminal() {
+		h.closeSession(ctx, session)
+		_ = protocol.Write(ws, protocol.Status{Status: string(trip.Status), TripID: trip.TripID})
+		return attachment{}, true
+	}
+
+	cabID := trip.CabID
+	if cabID == "" {
+		if status, assigned, err := h.service.GetRiderStatus(ctx, req.ID); err == nil && status == "MATCHED" {
+			cabID = assigned
+		}
+	}
+	if cabID == "" {
+		_ = protocol.Write(ws, protocol.Status{Status: "PENDING", TripID: req.TripID, Message: "Searching for shared ride..."})
+		return attachment{}, false
+	}
+
+	state := attachment{matched: true, onBoard: trip.Status == ride.TripInProgress}
+
+	writeMatched(ws, cabID, req.TripID)
+	if trip.Status != ride.TripCreated && trip.Status != ride.TripDriverAssigned {
+		_ = protocol.Write(ws, protocol.Status{Status: string(trip.Status), TripID: trip.TripID})
+	}
+
+	if cab, err := h.service.LocateCab(ctx, cabID); err == nil {
+		ping := events.RiderEvent{CabID: cabID, Lat: cab.Latitude, Lng: cab.Longitude}
+		_ = protocol.Write(ws, protocol.DriverLocation{CabID: cabID, Lat: ping.Lat, Lng: ping.Lng})
+		h.writeETA(ws, req, ping, state.onBoard)
+	}
+
+	return state, false
+}
+
+func (h *RideHandler) writeSession(ws *websocket.Conn, session *ride.Session) {
+	_ = protocol.Write(ws, protocol.Session{
+		Token:        session.Token,
+		TripID:       session.Rider.TripID,
+		GraceSeconds: int(h.grace.Seconds()),
+	})
+}
+
+func (h *RideHandler) closeSession(ctx context.Context, session *ride.Session) {
+	if err := h.service.CloseSession(context.WithoutCancel(ctx), session.Token); err != nil {
+		h.logger.WarnContext(ctx, "failed to close ride session", logging.TripID(session.Rider.TripID), logging.Err(err))
+	}
+}
+
+// readRideRequest reads the rider's first frame, answering with an error
+// frame when it is not a valid REQUEST
+func (h *RideHandler) readRideRequest(ctx context.Context, ws *websocket.Conn, riderID int) (protocol.Request, bool) {
+	_, raw, err := ws.ReadMessage()
+	if err != nil {
+		h.logger.WarnContext(ctx, "failed to read ride request", logging.RiderID(riderID), logging.Err(err))
+		return protocol.Request{}, false
+	}
+
+	typ, payload, err := decodeFrame(raw)
+	if err != nil {
+		_ = protocol.Write(ws, protocol.Invalid(err))
+		return protocol.Request{}, false
+	}
+	if typ != protocol.TypeRequest {
+		_ = protocol.Write(ws, protocol.Fail(http.StatusBadRequest, "the first frame must be a "+string(protocol.TypeRequest)))
+		return protocol.Request{}, false
+	}
+
+	return *payload.(*protocol.Request), true
+}
+
+// decodeFrame decodes a frame sent by the rider and runs the request
+// validations on its payload
+func decodeFrame(raw []byte) (protocol.Type, any, error) {
+	typ, payload, err := protocol.Decode(raw)
+	if err != nil {
+		return typ, nil, err
+	}
+	return typ, payload, request.Validate(payload)
+}
+
+func writeMatched(ws *websocket.Conn, cabID string, tripID int) {
+	_ = protocol.Write(ws, protocol.Matched{
+		CabID:   cabID,
+		TripID:  tripID,
+		Message: "Driver found!",
+	})
+}
+
+// writeETA sends how far the cab is from the rider's pickup, or their drop
+// once on board. Pings that cannot be routed send no ETA.
+func (h *RideHandler) writeETA(ws *websocket.Conn, req ride.Rider, e events.RiderEvent, onBoard bool) {
+	target, to := protocol.TargetPickup, ride.Destination{Latitude: req.Latitude, Longitude: req.Longitude}
+	if onBoard {
+		target, to = protocol.TargetDrop, ride.Destination{Latitude: req.DropLatitude, Longitude: req.DropLongitude}
+	}
+
+	eta, err := h.service.EstimateETA(ride.Destination{Latitude: e.Lat, Longitude: e.Lng}, to)
+	if err != nil {
+		return
+	}
+
+	_ = protocol.Write(ws, protocol.ETA{
+		CabID:      e.CabID,
+		TripID:     req.TripID,
+		Target:     target,
+		DistanceKm: math.Round(eta.DistanceKm*100) / 100,
+		Seconds:    int(eta.Duration.Seconds()),
+	})
+}
+
+// writeRestarting tells the rider the server is going away and closes the
+// socket with the service restart code
+func writeRestarting(ws *websocket.Conn, tripID int) {
+	_ = protocol.Write(ws, protocol.Restarting{TripID: tripID, Message: restartingMsg})
+	_ = ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseServiceRestart, restartingMsg),
+		time.Now().Add(time.Second))
+}
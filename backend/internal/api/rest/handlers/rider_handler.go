@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/rider"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+)
+
+type RiderHandler struct {
+	service rider.Service
+	tokens  *auth.Tokens
+	logger  *slog.Logger
+}
+
+func NewRiderHandler(service rider.Service, tokens *auth.Tokens, logger *slog.Logger) *RiderHandler {
+	return &RiderHandler{
+		service: service,
+		tokens:  tokens,
+		logger:  logger,
+	}
+}
+
+func (h *RiderHandler) Signup(c *gin.Context) {
+	r := request.GetReqBody[request.SignupRequest](c)
+
+	rd, err := h.service.Signup(c.Request.Context(), rider.Rider{
+		Name:  r.Name,
+		Email: r.Email,
+		Phone: r.Phone,
+	}, r.Password)
+	if err != nil {
+		h.logger.WarnContext(c.Request.Context(), "failed to sign up rider", logging.Err(err))
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeToken(c, http.StatusCreated, rd)
+}
+
+func (h *RiderHandler) Login(c *gin.Context) {
+	r := request.GetReqBody[request.LoginRequest](c)
+
+	rd, err := h.service.Login(c.Request.Context(), r.Email, r.Password)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeToken(c, http.StatusOK, rd)
+}
+
+// Me returns the authenticated rider's account
+func (h *RiderHandler) Me(c *gin.Context) {
+	identity, _ := auth.IdentityFrom(c.Request.Context())
+
+	rd, err := h.service.GetRider(c.Request.Context(), identity.RiderID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, riderJSON(rd))
+}
+
+// writeToken answers with a fresh access token for the rider
+func (h *RiderHandler) writeToken(c *gin.Context, status int, rd *rider.Rider) {
+	token, expiresAt, err := h.tokens.Issue(auth.Rider(rd.ID))
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to issue access token", logging.RiderID(rd.ID), logging.Err(err))
+		response.Fail(c, http.StatusInternalServerError, "failed to issue access token")
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"rider":        riderJSON(rd),
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_at":   expiresAt,
+	})
+}
+
+func (h *RiderHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, rider.ErrInvalidCredentials):
+		response.Fail(c, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, rider.ErrRiderNotFound):
+		response.Fail(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, rider.ErrRiderExists):
+		response.Fail(c, http.StatusConflict, err.Error())
+	case errors.Is(err, rider.ErrWeakPassword):
+		response.Fail(c, http.StatusBadRequest, err.Error())
+	default:
+		response.Fail(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func riderJSON(rd *rider.Rider) gin.H {
+	return gin.H{
+		"rider_id":   rd.ID,
+		"name":       rd.Name,
+		"email":      rd.Email,
+		"phone":      rd.Phone,
+		"created_at": rd.CreatedAt,
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// Sessions keeps track of the open rider and driver sockets so the server can tell
+// them it is restarting before it goes away. http.Server.Shutdown does not
+// wait for hijacked connections, Shutdown does.
+type Sessions struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	closing  chan struct{}
+	shutdown bool
+}
+
+// NewSessions function initialises an empty session tracker
+func NewSessions() *Sessions {
+	return &Sessions{closing: make(chan struct{})}
+}
+
+// Track registers a socket. done must be called once the socket is closed,
+// closing is closed when the server starts shutting down. ok is false once
+// the server is shutting down and the socket should not be opened.
+func (s *Sessions) Track() (done func(), closing <-chan struct{}, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdown {
+		return nil, nil, false
+	}
+
+	s.wg.Add(1)
+	return s.wg.Done, s.closing, true
+}
+
+// Shutdown tells every tracked socket to close and waits for them, or for
+// ctx to be done
+func (s *Sessions) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.shutdown {
+		s.shutdown = true
+		close(s.closing)
+	}
+	s.mu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
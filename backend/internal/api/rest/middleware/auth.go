@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+)
+
+// AccessTokenParam carries the access token on WebSocket upgrades, browsers
+// cannot set the Authorization header on them
+const AccessTokenParam = "access_token"
+
+// Authenticate middleware rejects requests without a valid access token and
+// stores the identity it names in the request context. The token is read
+// from the Authorization bearer header, or from the access_token query
+// parameter on WebSocket upgrades.
+func Authenticate(tokens *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			response.Abort(c, http.StatusUnauthorized, "missing access token")
+			return
+		}
+
+		claims, err := tokens.Verify(token)
+		if err != nil {
+			response.Abort(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := auth.IdentityFromClaims(claims)
+		if err != nil {
+			response.Abort(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), id))
+
+		c.Next()
+	}
+}
+
+// Authorize middleware lets requests of the given roles through, it must
+// run after Authenticate
+func Authorize(roles ...auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := auth.IdentityFrom(c.Request.Context())
+		if !ok {
+			response.Abort(c, http.StatusUnauthorized, "missing access token")
+			return
+		}
+
+		if !identity.Is(roles...) {
+			response.Abort(c, http.StatusForbidden, "not allowed for role "+string(identity.Role))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OwnCab middleware only lets the driver of the cab named by the route
+// parameter, or an operator, through. It must run after Authenticate.
+func OwnCab(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, _ := auth.IdentityFrom(c.Request.Context())
+
+		if !identity.OwnsCab(c.Param(param)) {
+			response.Abort(c, http.StatusForbidden, "not the driver of this cab")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func bearerToken(c *gin.Context) string {
+	if h := c.GetHeader("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+
+	if c.IsWebsocket() {
+		return c.Query(AccessTokenParam)
+	}
+
+	return ""
+}
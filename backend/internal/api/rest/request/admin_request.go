@@ -0,0 +1,5 @@
+package request
+
+type AdminLoginRequest struct {
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,15 @@
+package request
+
+type RegisterDriverRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Phone         string `json:"phone" binding:"required"`
+	VehicleNumber string `json:"vehicle_number" binding:"required"`
+	Capacity      int    `json:"capacity" binding:"gte=0"`
+	VehicleClass  string `json:"vehicle_class"`
+	Password      string `json:"password" binding:"required"`
+}
+
+type DriverLoginRequest struct {
+	Phone    string `json:"phone" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -3,20 +3,34 @@ package request
 import "github.com/gin-gonic/gin"
 
 type Location struct {
-	Lat float64 `json:"lat" validate:"latitude"`
-	Lng float64 `json:"lng" validate:"longitude"`
+	Lat float64 `json:"lat" binding:"required,latitude"`
+	Lng float64 `json:"lng" binding:"required,longitude"`
 }
 
-type CalculateFareRequest struct {
-	Pickup Location `json:"pickup" validate:"required"`
+// FareRequest carries the pickup point and either a named destination hub
+// or explicit drop coordinates. Without either the default hub is used.
+type FareRequest struct {
+	Lat         float64   `json:"lat" binding:"required,latitude"`
+	Lng         float64   `json:"lng" binding:"required,longitude"`
+	Destination string    `json:"destination"`
+	Drop        *Location `json:"drop"`
+	// VehicleClass prices the fare for a class, the default class if empty
+	VehicleClass string `json:"vehicle_class"`
 }
 
 type RideRequest struct {
-	RiderID   int     `json:"rider_id"`
-	Luggage   int     `json:"luggage" validate:"gte=0"`
-	Lat       float64 `json:"lat" validate:"required,latitude"`
-	Lng       float64 `json:"lng" validate:"required,longitude"`
-	Tolerance float64 `json:"tolerance" validate:"required"`
+	Luggage     int       `json:"luggage" binding:"gte=0"`
+	Lat         float64   `json:"lat" binding:"required,latitude"`
+	Lng         float64   `json:"lng" binding:"required,longitude"`
+	Tolerance   float64   `json:"tolerance" binding:"required,tolerance"`
+	Destination string    `json:"destination"`
+	Drop        *Location `json:"drop"`
+	// VehicleClass only matches cabs of that class, any cab if empty
+	VehicleClass string `json:"vehicle_class"`
+}
+
+type TripStatusRequest struct {
+	Status string `json:"status" binding:"required"`
 }
 
 func GetReqBody[T any](c *gin.Context) T {
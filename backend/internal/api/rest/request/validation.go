@@ -0,0 +1,67 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+// located is a request naming a point on the map
+type located interface {
+	coordinates() (lat, lng float64)
+}
+
+func (l Location) coordinates() (float64, float64)    { return l.Lat, l.Lng }
+func (r FareRequest) coordinates() (float64, float64) { return r.Lat, r.Lng }
+func (r RideRequest) coordinates() (float64, float64) { return r.Lat, r.Lng }
+
+// RegisterValidators adds the request validations to gin's validator, the
+// one ReqValidate and Validate run. Points have to lie inside the fence,
+// everywhere when it is empty, and a ride's tolerance has to be positive
+// and at most maxTolerance. It must be called before serving requests.
+func RegisterValidators(fence ride.GeoFence, maxTolerance float64) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("request: gin is not using go-playground/validator")
+	}
+
+	// errors name fields the way clients send them
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return f.Name
+		}
+		return name
+	})
+
+	v.RegisterAlias("tolerance", fmt.Sprintf("gt=0,lte=%g", maxTolerance))
+
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		lat, lng := sl.Current().Interface().(located).coordinates()
+
+		// missing or malformed coordinates are reported by their own tags
+		if (lat == 0 && lng == 0) || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			return
+		}
+
+		if !fence.Contains(lat, lng) {
+			sl.ReportError(lat, "lat", "Lat", "geofence", "")
+		}
+	}, Location{}, FareRequest{}, RideRequest{})
+
+	return nil
+}
+
+// Validate runs the request validations on a value decoded outside gin's
+// binding, e.g. a WebSocket frame
+func Validate(v any) error {
+	return binding.Validator.ValidateStruct(v)
+}
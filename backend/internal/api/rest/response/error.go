@@ -0,0 +1,150 @@
+// Package response holds the error envelope every REST handler and
+// WebSocket session answers with.
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Code tells clients what went wrong without parsing the message
+type Code string
+
+const (
+	CodeInvalidJSON  Code = "invalid_json"
+	CodeValidation   Code = "validation_failed"
+	CodeBadRequest   Code = "bad_request"
+	CodeUnauthorized Code = "unauthorized"
+	CodeForbidden    Code = "forbidden"
+	CodeNotFound     Code = "not_found"
+	CodeConflict     Code = "conflict"
+	CodeUnavailable  Code = "unavailable"
+	CodeInternal     Code = "internal"
+)
+
+// Error is the body of every error response. On a socket it is the payload
+// of an ERROR frame.
+type Error struct {
+	Code    Code         `json:"code"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError names a request field that failed validation, nested fields
+// are joined with dots, e.g. "drop.lat"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// CodeFor returns the code of errors answered with the HTTP status
+func CodeFor(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		if status < http.StatusInternalServerError {
+			return CodeBadRequest
+		}
+		return CodeInternal
+	}
+}
+
+// New returns the error answered with the HTTP status
+func New(status int, message string) Error {
+	return Error{Code: CodeFor(status), Message: message}
+}
+
+// Fail answers the request with the error for the HTTP status
+func Fail(c *gin.Context, status int, message string) {
+	c.JSON(status, New(status, message))
+}
+
+// Abort answers the request like Fail and stops the handler chain
+func Abort(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, New(status, message))
+}
+
+// Invalid returns the error for a request body that could not be decoded
+// or failed validation, listing the offending fields
+func Invalid(err error) Error {
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		out := Error{
+			Code:    CodeValidation,
+			Message: "request validation failed",
+			Errors:  make([]FieldError, len(ve)),
+		}
+		for i, fe := range ve {
+			out.Errors[i] = FieldError{Field: fieldName(fe), Message: fieldMessage(fe)}
+		}
+		return out
+	}
+
+	out := Error{Code: CodeInvalidJSON, Message: "invalid JSON format"}
+
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) && te.Field != "" {
+		out.Errors = []FieldError{{Field: te.Field, Message: "Should be of type " + te.Type.String()}}
+	}
+
+	return out
+}
+
+// fieldName is the field's path without the request type, json names are
+// used when the validator reports them
+func fieldName(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "This field is required."
+	case "lte":
+		return "Should be less than " + fe.Param()
+	case "gte":
+		return "Should be greater than " + fe.Param()
+	case "min":
+		return "Min value is " + fe.Param()
+	case "max":
+		return "Max value is " + fe.Param()
+	case "oneof":
+		return "Should be one of " + fe.Param()
+	case "email":
+		return "Should be a valid email"
+	case "latitude":
+		return "Should be a latitude between -90 and 90"
+	case "longitude":
+		return "Should be a longitude between -180 and 180"
+	case "geofence":
+		return "Should be inside the service area"
+	case "tolerance":
+		if fe.ActualTag() == "lte" {
+			return "Should be at most " + fe.Param()
+		}
+		return "Should be more than " + fe.Param()
+	case "required_without":
+		return "The field " + fe.Param() + " shouldn't be empty when this field is empty"
+	}
+	return "Failed the " + fe.Tag() + " check"
+}
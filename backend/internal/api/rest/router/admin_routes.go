@@ -0,0 +1,35 @@
+package router
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/handlers"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/middleware"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+)
+
+func RegisterAdminRoutes(
+	r *gin.RouterGroup,
+	rideService ride.Service,
+	queueService queue.QueueService,
+	tokens *auth.Tokens,
+	adminPassword string,
+	logger *slog.Logger,
+) {
+	h := handlers.NewAdminHandler(rideService, queueService, tokens, adminPassword, logger)
+
+	r.POST("/admin/login", middleware.ReqValidate[request.AdminLoginRequest](), h.Login)
+
+	admin := r.Group("/admin", middleware.Authenticate(tokens), middleware.Authorize(auth.RoleAdmin))
+	{
+		admin.GET("/dead-letters", h.ListDeadLetters)
+		admin.POST("/dead-letters/replay", h.ReplayDeadLetters)
+		admin.GET("/cells/:geohash", h.InspectCell)
+		admin.POST("/trips/:tripID/cancel", h.ForceCancelTrip)
+		admin.POST("/queue/drain", h.DrainQueue)
+	}
+}
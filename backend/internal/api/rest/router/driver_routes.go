@@ -0,0 +1,42 @@
+package router
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/handlers"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/middleware"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+)
+
+func RegisterDriverRoutes(
+	r *gin.RouterGroup,
+	driverService driver.Service,
+	drivers *events.DriverHub,
+	sessions *handlers.Sessions,
+	tokens *auth.Tokens,
+	logger *slog.Logger,
+) {
+	h := handlers.NewDriverHandler(driverService, drivers, sessions, tokens, logger)
+
+	d := r.Group("/driver")
+	{
+		d.POST("/register", middleware.ReqValidate[request.RegisterDriverRequest](), h.RegisterDriver)
+		d.POST("/login", middleware.ReqValidate[request.DriverLoginRequest](), h.Login)
+	}
+
+	// riders read the cab they are assigned to, drivers only act for their own cab
+	cab := d.Group("/:cabID", middleware.Authenticate(tokens))
+	{
+		cab.GET("", h.GetCab)
+
+		owner := cab.Group("", middleware.Authorize(auth.RoleDriver, auth.RoleAdmin), middleware.OwnCab("cabID"))
+		owner.POST("/online", middleware.ReqValidate[request.Location](), h.GoOnline)
+		owner.POST("/offline", h.GoOffline)
+		owner.POST("/location", middleware.ReqValidate[request.Location](), h.UpdateLocation)
+		owner.GET("/events", h.StreamEvents)
+	}
+}
@@ -1,26 +1,43 @@
 package router
 
 import (
+	"log/slog"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/middleware"
-	"github.com/redis/go-redis/v9"
 	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
 	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
 	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/handlers"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
 
 )
 
 func RegisterRideRoutes(
 	r *gin.RouterGroup,
-    redisClient *redis.Client,
     rideService ride.Service,
-
+    hub *events.Hub,
+    sessions *handlers.Sessions,
+    sessionGrace time.Duration,
+    tokens *auth.Tokens,
+    logger *slog.Logger,
 ){
-    h := handlers.NewRideHandler(rideService)
+    h := handlers.NewRideHandler(rideService, hub, sessions, sessionGrace, logger)
 
     ride := r.Group("/ride")
     {
-        ride.POST("/fare", middleware.ReqValidate[request.Location](), h.CalculateFare)
-        ride.GET("/request", h.RequestRide)
+        ride.POST("/fare", middleware.ReqValidate[request.FareRequest](), h.CalculateFare)
+        ride.GET("/request", middleware.Authenticate(tokens), middleware.Authorize(auth.RoleRider), h.RequestRide)
+        ride.GET("/resume", middleware.Authenticate(tokens), middleware.Authorize(auth.RoleRider), h.ResumeRide)
+        ride.GET("/destinations", h.ListDestinations)
+        ride.GET("/vehicle-classes", h.ListVehicleClasses)
+    }
+
+    // riders see their own trips, drivers the trips of their cab
+    trip := ride.Group("/trip/:tripID", middleware.Authenticate(tokens))
+    {
+        trip.GET("", h.GetTrip)
+        trip.POST("/status", middleware.ReqValidate[request.TripStatusRequest](), h.UpdateTripStatus)
     }
 }
\ No newline at end of file
@@ -0,0 +1,28 @@
+package router
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/handlers"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/middleware"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/request"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/rider"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+)
+
+func RegisterRiderRoutes(
+	r *gin.RouterGroup,
+	riderService rider.Service,
+	tokens *auth.Tokens,
+	logger *slog.Logger,
+) {
+	h := handlers.NewRiderHandler(riderService, tokens, logger)
+
+	rd := r.Group("/rider")
+	{
+		rd.POST("/signup", middleware.ReqValidate[request.SignupRequest](), h.Signup)
+		rd.POST("/login", middleware.ReqValidate[request.LoginRequest](), h.Login)
+		rd.GET("/me", middleware.Authenticate(tokens), middleware.Authorize(auth.RoleRider), h.Me)
+	}
+}
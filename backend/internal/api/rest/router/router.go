@@ -1,26 +1,49 @@
 package router
 
 import (
+	"log/slog"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/handlers"
+	"github.com/mahimapatel13/ride-sharing-system/internal/api/rest/response"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
 	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
-	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/database/postgres/repositories"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/rider"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/auth"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
 	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
-	"github.com/redis/go-redis/v9"
 )
 
 func RegisterRoutes(
 	r *gin.Engine,
-    pool *pgxpool.Pool,
-    redisClient *redis.Client,
-    mqChannel *queue.MQChannel,
+    rideService ride.Service,
+    driverService driver.Service,
+    riderService rider.Service,
+    tokens *auth.Tokens,
+    adminPassword string,
+    hub *events.Hub,
+    drivers *events.DriverHub,
+    sessions *handlers.Sessions,
+    sessionGrace time.Duration,
+    queueService queue.QueueService,
+    logger *slog.Logger,
 ){
 
     // api versioning
     v1 := r.Group("/api/v1")
 
-    rideRepo := repositories.NewRideRepository(pool)
+    RegisterRideRoutes(v1, rideService, hub, sessions, sessionGrace, tokens, logger)
+
+    RegisterRiderRoutes(v1, riderService, tokens, logger)
+
+    RegisterDriverRoutes(v1, driverService, drivers, sessions, tokens, logger)
+
+    RegisterAdminRoutes(v1, rideService, queueService, tokens, adminPassword, logger)
 
-    rideService := ride.NewRideService(mqChannel, redisClient, rideRepo)
-    RegisterRideRoutes(v1, redisClient,rideService)
+    // unknown routes answer with the error envelope too
+    r.NoRoute(func(c *gin.Context) {
+        response.Fail(c, http.StatusNotFound, "route not found")
+    })
 }
\ No newline at end of file
@@ -1,24 +1,142 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DatabaseConfig DatabaseConfig
-	RedisConfig    RedisConfig
-	RabbitMQConfig RabbitMQConfig
-	MaxWorkerCount int
+	DatabaseConfig   DatabaseConfig
+	RedisConfig      RedisConfig
+	RabbitMQConfig   RabbitMQConfig
+	MaxWorkerCount   int
+	HubConfig        HubConfig
+	ValidationConfig ValidationConfig
+	MatchingConfig   MatchingConfig
+	RoutingConfig    RoutingConfig
+	TracingConfig    TracingConfig
+	LoggingConfig    LoggingConfig
+	AuthConfig       AuthConfig
+	SessionConfig    SessionConfig
+	// StorageBackend is "redis" for Redis, RabbitMQ and Postgres or
+	// "memory" to keep everything in process for local development
+	StorageBackend string
+}
+
+// RoutingConfig points at the preprocessed road graph. Without a graph file
+// distances are straight lines driven at AvgSpeedKmh.
+type RoutingConfig struct {
+	GraphFile   string
+	AvgSpeedKmh float64
+}
+
+// LoggingConfig sets the minimum level ("debug", "info", "warn", "error")
+// and the output format ("json" or "text")
+type LoggingConfig struct {
+	Level  string
+	Format string
+}
+
+// AuthConfig signs the access tokens. Without a TokenSecret a random one
+// is used, tokens then stop working when the server restarts.
+type AuthConfig struct {
+	TokenSecret Secret
+	TokenTTL    time.Duration
+	// AdminPassword is what operators log in with, admin login is
+	// disabled without it
+	AdminPassword Secret
+}
+
+// SessionConfig sets how long a ride survives without a rider socket, the
+// rider may reconnect within Grace before the ride is cancelled
+type SessionConfig struct {
+	Grace time.Duration
+}
+
+// Secret is a config value kept out of the logs
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// MarshalText keeps the value out of JSON logs as well
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// TracingConfig selects where spans are exported to: "none", "stdout" or
+// "otlp". An empty OTLPEndpoint leaves it to the OTEL_EXPORTER_OTLP_*
+// variables.
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+// MatchingConfig selects the matching strategy, optionally per zone
+type MatchingConfig struct {
+	Strategy string
+	// ZoneStrategies maps a geohash prefix to the strategy used inside it
+	ZoneStrategies map[string]string
+	// BatchWindow collects requests per region before matching them
+	// jointly, 0 matches every request as it arrives
+	BatchWindow          time.Duration
+	BatchRegionPrecision int
+	// OfferTimeout is how long a driver has to accept a rider, 0 assigns
+	// riders without asking
+	OfferTimeout time.Duration
+	// WaitLimit is how long a rider no cab can take waits, from their ride
+	// request, before the trip is cancelled; matching is tried again every
+	// WaitInterval until then
+	WaitLimit    time.Duration
+	WaitInterval time.Duration
+	// AcceptanceWeight is how much ranking penalises drivers who decline
+	// offers, 0 ignores acceptance rates
+	AcceptanceWeight float64
+}
+
+// ValidationConfig bounds what ride requests may ask for
+type ValidationConfig struct {
+	// ServiceAreas fence the pickup and drop points, anywhere when empty
+	ServiceAreas []ServiceArea
+	// MaxTolerance is the largest detour a rider may accept, as a share of
+	// their direct distance
+	MaxTolerance float64
+}
+
+type ServiceArea struct {
+	Name   string
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// HubConfig is the catalogue of named drop points (airports, stations)
+type HubConfig struct {
+	Hubs    []Hub
+	Default string
+}
+
+type Hub struct {
+	Name string
+	Lat  float64
+	Lng  float64
 }
 
 type DatabaseConfig struct {
 	Port         string
 	User         string
-	Password     string
+	Password     Secret
 	DatabaseName string
 	Host         string
 	Address      string
@@ -26,35 +144,63 @@ type DatabaseConfig struct {
 
 type RabbitMQConfig struct{
 	URL string
+	// MaxRetries is how often a failed ride-matching job is retried
+	// before it is moved to the dead-letter queue
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	// ReconnectMinDelay is the first wait after the connection is lost,
+	// doubled on every failed attempt up to ReconnectMaxDelay
+	ReconnectMinDelay time.Duration
+	ReconnectMaxDelay time.Duration
+	// ConfirmTimeout is how long a publish waits for the broker's confirm
+	ConfirmTimeout time.Duration
 }
 
 type RedisConfig struct {
 	Protocol int
-	Password string
+	Password Secret
 	DB       int
 	Address  string
 }
 
 // LoadEnv loads the environment and file and configures the app using the env file
 func LoadEnv() Config {
-	log.Println("Reading .env file")
+	slog.Info("Reading .env file")
 	err := godotenv.Load(".env")
 
 	if err != nil {
-		log.Fatalf("Error in loading .env file: %v", err)
+		slog.Error("Error in loading .env file", "error", err)
+		os.Exit(1)
 	}
 	dbConfig := loadDBConfig()
 	redisConfig := loadRedisConfig()
 	mqConfig := loadRabbitMQConfig()
+	hubConfig := loadHubConfig()
+	matchingConfig := loadMatchingConfig()
+	routingConfig := loadRoutingConfig()
+	tracingConfig := loadTracingConfig()
+	loggingConfig := loadLoggingConfig()
+	authConfig := loadAuthConfig()
+	validationConfig := loadValidationConfig()
+	sessionConfig := loadSessionConfig()
 
 	config := Config{
-		DatabaseConfig: dbConfig,
-		RedisConfig:    redisConfig,
-		RabbitMQConfig: mqConfig,
-		MaxWorkerCount: getInt(getEnvValue("MAX_WORKER_COUNT", "1"), 1),
+		DatabaseConfig:   dbConfig,
+		RedisConfig:      redisConfig,
+		RabbitMQConfig:   mqConfig,
+		MaxWorkerCount:   getInt(getEnvValue("MAX_WORKER_COUNT", "1"), 1),
+		HubConfig:        hubConfig,
+		ValidationConfig: validationConfig,
+		MatchingConfig:   matchingConfig,
+		RoutingConfig:    routingConfig,
+		TracingConfig:    tracingConfig,
+		LoggingConfig:    loggingConfig,
+		AuthConfig:       authConfig,
+		SessionConfig:    sessionConfig,
+		StorageBackend:   getEnvValue("STORAGE_BACKEND", "redis"),
 	}
 
-	log.Println(config)
+	slog.Info("Loaded config", "config", config)
 	return config
 }
 
@@ -70,7 +216,7 @@ func loadDBConfig() DatabaseConfig {
 
 	dbConfig := DatabaseConfig{
 		User:         user,
-		Password:     pass,
+		Password:     Secret(pass),
 		DatabaseName: name,
 		Host:         host,
 		Address: addr,
@@ -87,6 +233,11 @@ func loadRabbitMQConfig() RabbitMQConfig {
 
 	mqConfig:= RabbitMQConfig{
 		URL: url,
+		MaxRetries:     getInt(getEnvValue("MATCH_MAX_RETRIES", "5"), 5),
+		RetryBaseDelay: time.Duration(getInt(getEnvValue("MATCH_RETRY_BASE_DELAY_MS", "500"), 500)) * time.Millisecond,
+		ReconnectMinDelay: time.Duration(getInt(getEnvValue("RABBITMQ_RECONNECT_MIN_DELAY_MS", "500"), 500)) * time.Millisecond,
+		ReconnectMaxDelay: time.Duration(getInt(getEnvValue("RABBITMQ_RECONNECT_MAX_DELAY_MS", "30000"), 30000)) * time.Millisecond,
+		ConfirmTimeout: time.Duration(getInt(getEnvValue("RABBITMQ_CONFIRM_TIMEOUT_MS", "5000"), 5000)) * time.Millisecond,
 	}
 
 	return mqConfig
@@ -99,7 +250,7 @@ func loadRedisConfig() RedisConfig {
 	prot := getEnvValue("REDIS_PROTOCOL", "DEFAULT_DB_PROTOCOL")
 
 	redisConfig := RedisConfig{
-		Password: pass,
+		Password: Secret(pass),
 		DB:       getInt(db, 0),
 		Address:  addr,
 		Protocol:    getInt(prot, 2),
@@ -108,6 +259,175 @@ func loadRedisConfig() RedisConfig {
 	return redisConfig
 }
 
+// Loads destination hubs
+// DESTINATION_HUBS is a comma separated list of name:lat:lng entries,
+// e.g. "airport:23.2875:77.3370,station:23.2682:77.4131"
+func loadHubConfig() HubConfig {
+	raw := getEnvValue("DESTINATION_HUBS", "airport:23.2875:77.3370")
+
+	var hubs []Hub
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			slog.Warn("Skipping malformed destination hub", "entry", entry)
+			continue
+		}
+
+		lat, latErr := strconv.ParseFloat(parts[1], 64)
+		lng, lngErr := strconv.ParseFloat(parts[2], 64)
+		if latErr != nil || lngErr != nil {
+			slog.Warn("Skipping destination hub with invalid coordinates", "entry", entry)
+			continue
+		}
+
+		hubs = append(hubs, Hub{Name: parts[0], Lat: lat, Lng: lng})
+	}
+
+	def := ""
+	if len(hubs) > 0 {
+		def = hubs[0].Name
+	}
+
+	return HubConfig{
+		Hubs:    hubs,
+		Default: getEnvValue("DEFAULT_DESTINATION", def),
+	}
+}
+
+// Loads request validation config
+// SERVICE_AREAS is a comma separated list of name:min_lat:min_lng:max_lat:max_lng
+// entries, e.g. "bhopal:23.15:77.30:23.35:77.55"
+func loadValidationConfig() ValidationConfig {
+	var areas []ServiceArea
+	for _, entry := range strings.Split(getEnvValue("SERVICE_AREAS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 5 {
+			slog.Warn("Skipping malformed service area", "entry", entry)
+			continue
+		}
+
+		var bounds [4]float64
+		valid := true
+		for i, p := range parts[1:] {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			bounds[i] = v
+		}
+		if !valid || bounds[0] > bounds[2] || bounds[1] > bounds[3] {
+			slog.Warn("Skipping service area with invalid bounds", "entry", entry)
+			continue
+		}
+
+		areas = append(areas, ServiceArea{
+			Name:   parts[0],
+			MinLat: bounds[0],
+			MinLng: bounds[1],
+			MaxLat: bounds[2],
+			MaxLng: bounds[3],
+		})
+	}
+
+	maxTolerance, err := strconv.ParseFloat(getEnvValue("MAX_TOLERANCE", "1"), 64)
+	if err != nil || maxTolerance <= 0 {
+		slog.Warn("Invalid MAX_TOLERANCE, using 1")
+		maxTolerance = 1
+	}
+
+	return ValidationConfig{
+		ServiceAreas: areas,
+		MaxTolerance: maxTolerance,
+	}
+}
+
+// Loads matching strategy config
+// MATCH_ZONE_STRATEGIES is a comma separated list of geohash-prefix:strategy
+// entries, e.g. "tsp9:min_detour,tsp3:load_balance"
+func loadMatchingConfig() MatchingConfig {
+	zones := make(map[string]string)
+
+	raw := getEnvValue("MATCH_ZONE_STRATEGIES", "")
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		prefix, strategy, ok := strings.Cut(entry, ":")
+		if !ok || prefix == "" {
+			slog.Warn("Skipping malformed zone strategy", "entry", entry)
+			continue
+		}
+		zones[prefix] = strategy
+	}
+
+	acceptanceWeight, err := strconv.ParseFloat(getEnvValue("MATCH_ACCEPTANCE_WEIGHT", "1"), 64)
+	if err != nil || acceptanceWeight < 0 {
+		slog.Warn("Invalid MATCH_ACCEPTANCE_WEIGHT, using 1")
+		acceptanceWeight = 1
+	}
+
+	return MatchingConfig{
+		Strategy:             getEnvValue("MATCH_STRATEGY", "greedy"),
+		ZoneStrategies:       zones,
+		BatchWindow:          time.Duration(getInt(getEnvValue("MATCH_BATCH_WINDOW_MS", "0"), 0)) * time.Millisecond,
+		BatchRegionPrecision: getInt(getEnvValue("MATCH_BATCH_REGION_PRECISION", "5"), 5),
+		OfferTimeout:         time.Duration(getInt(getEnvValue("MATCH_OFFER_TIMEOUT_SECONDS", "15"), 15)) * time.Second,
+		WaitLimit:            time.Duration(getInt(getEnvValue("MATCH_WAIT_SECONDS", "120"), 120)) * time.Second,
+		WaitInterval:         time.Duration(getInt(getEnvValue("MATCH_WAIT_INTERVAL_MS", "5000"), 5000)) * time.Millisecond,
+		AcceptanceWeight:     acceptanceWeight,
+	}
+}
+
+// Loads routing config
+func loadRoutingConfig() RoutingConfig {
+	return RoutingConfig{
+		GraphFile:   getEnvValue("ROUTING_GRAPH_FILE", ""),
+		AvgSpeedKmh: float64(getInt(getEnvValue("ROUTING_AVG_SPEED_KMH", "25"), 25)),
+	}
+}
+
+// Loads tracing config
+func loadTracingConfig() TracingConfig {
+	return TracingConfig{
+		Exporter:     getEnvValue("TRACING_EXPORTER", "none"),
+		OTLPEndpoint: getEnvValue("TRACING_OTLP_ENDPOINT", ""),
+		ServiceName:  getEnvValue("TRACING_SERVICE_NAME", "ride-sharing-api"),
+	}
+}
+
+// Loads logging config
+func loadLoggingConfig() LoggingConfig {
+	return LoggingConfig{
+		Level:  getEnvValue("LOG_LEVEL", "info"),
+		Format: getEnvValue("LOG_FORMAT", "json"),
+	}
+}
+
+// Loads auth config
+func loadAuthConfig() AuthConfig {
+	return AuthConfig{
+		TokenSecret: Secret(getEnvValue("AUTH_TOKEN_SECRET", "")),
+		TokenTTL:    time.Duration(getInt(getEnvValue("AUTH_TOKEN_TTL_MINUTES", "1440"), 1440)) * time.Minute,
+
+		AdminPassword: Secret(getEnvValue("AUTH_ADMIN_PASSWORD", "")),
+	}
+}
+
+// Loads ride session config
+func loadSessionConfig() SessionConfig {
+	return SessionConfig{
+		Grace: time.Duration(getInt(getEnvValue("RIDE_SESSION_GRACE_SECONDS", "60"), 60)) * time.Second,
+	}
+}
+
 func getEnvValue(key string, defaultValue string) string {
 	if value, ok := os.LookupEnv(key); ok && value != "" {
 		return value
@@ -0,0 +1,53 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+// Cab statuses as kept by the ride.CabStore
+const (
+	CabAvailable = ride.CabAvailable
+	CabFull      = ride.CabFull
+	CabOffline   = ride.CabOffline
+)
+
+// Driver represents a registered driver and the vehicle they operate.
+// Every driver owns exactly one cab whose ID keys its live state.
+type Driver struct {
+	ID            int
+	CabID         string
+	Name          string
+	Phone         string
+	VehicleNumber string
+	VehicleClass  ride.VehicleClass
+	Capacity      int
+	// PasswordHash is the bcrypt hash of the password, empty for drivers
+	// registered before driver accounts
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+// Cab represents the live state of a driver's vehicle
+type Cab struct {
+	ID             string
+	DriverID       int
+	Latitude       float64
+	Longitude      float64
+	Geohash        string
+	Status         string
+	PassengerCount int
+	LuggageCount   int
+	Capacity       int
+	// LuggageCapacity is counted separately from the seats in Capacity
+	LuggageCapacity int
+	VehicleClass    ride.VehicleClass
+	LastUpdate      time.Time
+	// Stops is the cab's remaining route, next stop first
+	Stops []ride.Stop
+	// RiderIDs are the riders assigned to the cab
+	RiderIDs []int
+	// Offers counts how the driver answered the riders offered to them
+	Offers ride.OfferStats
+}
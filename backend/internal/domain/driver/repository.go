@@ -0,0 +1,17 @@
+package driver
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrDriverNotFound = errors.New("driver not found")
+	ErrDriverExists   = errors.New("driver with this phone or vehicle number already exists")
+)
+
+type Repository interface {
+	CreateDriver(ctx context.Context, d Driver) (*Driver, error)
+	GetDriverByCabID(ctx context.Context, cabID string) (*Driver, error)
+	GetDriverByPhone(ctx context.Context, phone string) (*Driver, error)
+}
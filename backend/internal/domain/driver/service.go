@@ -0,0 +1,268 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password RegisterDriver accepts
+const MinPasswordLength = 8
+
+var (
+	ErrCabOffline       = ride.ErrCabOffline
+	ErrCabHasPassengers = ride.ErrCabHasPassengers
+	ErrOfferNotFound    = ride.ErrOfferNotFound
+	ErrOfferClosed      = ride.ErrOfferClosed
+
+	ErrInvalidCredentials = errors.New("invalid phone or password")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrTooManySeats       = errors.New("capacity exceeds the seats of the vehicle class")
+)
+
+type Service interface {
+	RegisterDriver(ctx context.Context, d Driver, password string) (*Driver, error)
+	Login(ctx context.Context, phone, password string) (*Driver, error)
+	GoOnline(ctx context.Context, cabID string, lat, lng float64) (*Cab, error)
+	GoOffline(ctx context.Context, cabID string) error
+	UpdateLocation(ctx context.Context, cabID string, lat, lng float64) (*Cab, error)
+	GetCab(ctx context.Context, cabID string) (*Cab, error)
+	AnswerOffer(ctx context.Context, cabID string, riderID int, accept bool) error
+}
+
+type service struct {
+	cabs      ride.CabStore
+	publisher events.Publisher
+	jobs      queue.JobQueue
+	repo      Repository
+	logger    *slog.Logger
+}
+
+// NewDriverService function initialises a new driver service. Answered
+// offers are handed back to the matching workers through jobs.
+func NewDriverService(cabs ride.CabStore, publisher events.Publisher, jobs queue.JobQueue, repo Repository, logger *slog.Logger) Service {
+	return &service{
+		cabs:      cabs,
+		publisher: publisher,
+		jobs:      jobs,
+		repo:      repo,
+		logger:    logger,
+	}
+}
+
+func (s *service) RegisterDriver(ctx context.Context, d Driver, password string) (*Driver, error) {
+	if len(password) < MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	vehicle, err := ride.LookupVehicleClass(string(d.VehicleClass))
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Capacity <= 0 {
+		d.Capacity = vehicle.Seats
+	}
+	if d.Capacity > vehicle.Seats {
+		return nil, fmt.Errorf("%w: a %s has %d", ErrTooManySeats, vehicle.Class, vehicle.Seats)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	d.VehicleClass = vehicle.Class
+	d.CabID = uuid.NewString()
+	d.Phone = strings.TrimSpace(d.Phone)
+	d.PasswordHash = string(hash)
+
+	return s.repo.CreateDriver(ctx, d)
+}
+
+// Login returns the driver the phone number and password belong to.
+// Unknown phones, wrong passwords and drivers without a password fail alike.
+func (s *service) Login(ctx context.Context, phone, password string) (*Driver, error) {
+	d, err := s.repo.GetDriverByPhone(ctx, strings.TrimSpace(phone))
+	if errors.Is(err, ErrDriverNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if d.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(d.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return d, nil
+}
+
+// GoOnline puts the driver's cab into the matching pool at the given location.
+// A cab coming back from OFFLINE starts empty; a cab that is already online
+// keeps its passengers and only has its position refreshed.
+func (s *service) GoOnline(ctx context.Context, cabID string, lat, lng float64) (*Cab, error) {
+	d, err := s.repo.GetDriverByCabID(ctx, cabID)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicle, err := ride.LookupVehicleClass(string(d.VehicleClass))
+	if err != nil {
+		return nil, err
+	}
+
+	// the class's seats bound drivers stored with a larger capacity
+	err = s.cabs.GoOnline(ctx, ride.CabState{
+		ID:              cabID,
+		DriverID:        d.ID,
+		Latitude:        lat,
+		Longitude:       lng,
+		Geohash:         ride.CellOf(lat, lng),
+		Capacity:        min(d.Capacity, vehicle.Seats),
+		LuggageCapacity: vehicle.Luggage,
+		VehicleClass:    vehicle.Class,
+		LastUpdate:      time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCab(ctx, cabID)
+}
+
+// GoOffline removes the cab from its cell so the matcher stops considering it.
+// Drivers cannot go offline while riders are still assigned to the cab.
+func (s *service) GoOffline(ctx context.Context, cabID string) error {
+	return s.cabs.GoOffline(ctx, cabID)
+}
+
+// UpdateLocation stores a location ping for the cab and moves it between
+// cells when it crosses a cell boundary.
+func (s *service) UpdateLocation(ctx context.Context, cabID string, lat, lng float64) (*Cab, error) {
+	err := s.cabs.UpdateLocation(ctx, cabID, lat, lng, ride.CellOf(lat, lng), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyRiders(ctx, cabID, lat, lng)
+
+	return s.GetCab(ctx, cabID)
+}
+
+// notifyRiders pushes the cab's new position to every rider assigned to it
+func (s *service) notifyRiders(ctx context.Context, cabID string, lat, lng float64) {
+	riderIDs, err := s.cabs.Riders(ctx, cabID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to read riders of cab", logging.CabID(cabID), logging.Err(err))
+		return
+	}
+
+	for _, riderID := range riderIDs {
+		err = s.publisher.PublishRiderEvent(ctx, events.RiderEvent{
+			Type:    events.TypeCabLocation,
+			RiderID: riderID,
+			CabID:   cabID,
+			Lat:     lat,
+			Lng:     lng,
+		})
+		if err != nil {
+			s.logger.WarnContext(ctx, "failed to publish cab location", logging.CabID(cabID), logging.RiderID(riderID), logging.Err(err))
+		}
+	}
+}
+
+func (s *service) GetCab(ctx context.Context, cabID string) (*Cab, error) {
+	state, err := s.cabs.Cab(ctx, cabID)
+	if errors.Is(err, ride.ErrCabNotFound) {
+		return &Cab{ID: cabID, Status: CabOffline}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stops, err := s.cabs.Stops(ctx, cabID)
+	if err != nil {
+		return nil, err
+	}
+
+	riderIDs, err := s.cabs.Riders(ctx, cabID)
+	if err != nil {
+		return nil, err
+	}
+
+	offers, err := s.cabs.OfferStats(ctx, cabID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cab{
+		ID:              state.ID,
+		DriverID:        state.DriverID,
+		Latitude:        state.Latitude,
+		Longitude:       state.Longitude,
+		Geohash:         state.Geohash,
+		Status:          state.Status,
+		PassengerCount:  state.PassengerCount,
+		LuggageCount:    state.LuggageCount,
+		Capacity:        state.Capacity,
+		LuggageCapacity: state.LuggageCapacity,
+		VehicleClass:    state.VehicleClass,
+		LastUpdate:      time.Unix(state.LastUpdate, 0),
+		Stops:           stops,
+		RiderIDs:        riderIDs,
+		Offers:          offers,
+	}, nil
+}
+
+// AnswerOffer records whether the driver takes the rider offered to their
+// cab and queues the rider's request again, so that a matching worker
+// assigns an accepted rider or matches a declined one elsewhere right
+// away. ErrOfferNotFound is returned if the rider was not offered to the
+// cab, ErrOfferClosed once the offer was answered, expired or the rider
+// cancelled.
+func (s *service) AnswerOffer(ctx context.Context, cabID string, riderID int, accept bool) error {
+	status := ride.OfferDeclined
+	if accept {
+		status = ride.OfferAccepted
+	}
+
+	offer, err := s.cabs.AnswerOffer(ctx, cabID, riderID, status, time.Now())
+	if err != nil {
+		return err
+	}
+
+	logger := s.logger.With(logging.CabID(cabID), logging.RiderID(riderID), "answer", status)
+	logger.InfoContext(ctx, "driver answered offer")
+
+	// the answer stands, only its follow-up is lost if the request cannot
+	// be queued again
+	body, err := json.Marshal(offer.Request)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to marshal answered ride request", logging.Err(err))
+		return nil
+	}
+
+	// the follow-up goes on as the job that made the offer, with its retries
+	// and the ride request's ID rather than the driver's
+	jobCtx := ctx
+	if offer.Job.RequestID != "" {
+		jobCtx = logging.WithRequestID(ctx, offer.Job.RequestID)
+	}
+	if err := s.jobs.Requeue(jobCtx, body, offer.Job.Retries); err != nil {
+		logger.ErrorContext(ctx, "failed to queue answered ride request", logging.Err(err))
+	}
+
+	return nil
+}
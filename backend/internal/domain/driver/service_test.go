@@ -0,0 +1,110 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/database/memory"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/store"
+)
+
+func TestRegisterDriverCapacity(t *testing.T) {
+	sedan, err := ride.LookupVehicleClass(string(ride.VehicleSedan))
+	if err != nil {
+		t.Fatalf("LookupVehicleClass: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		want     int
+		wantErr  error
+	}{
+		{name: "class seats by default", capacity: 0, want: sedan.Seats},
+		{name: "fewer seats than the class", capacity: 2, want: 2},
+		{name: "all the class's seats", capacity: sedan.Seats, want: sedan.Seats},
+		{name: "more seats than the class", capacity: sedan.Seats + 1, wantErr: driver.ErrTooManySeats},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.DiscardHandler)
+			svc := driver.NewDriverService(store.NewMemoryStore(), events.NewLocalHub(),
+				queue.NewMemoryQueue(queue.RetryOptions{}, logger), memory.NewDriverRepository(), logger)
+
+			d, err := svc.RegisterDriver(context.Background(), driver.Driver{
+				Name:          "Asha",
+				Phone:         "9000000001",
+				VehicleNumber: "KA01AB1234",
+				VehicleClass:  ride.VehicleSedan,
+				Capacity:      tt.capacity,
+			}, "long enough")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RegisterDriver err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if d.Capacity != tt.want {
+				t.Errorf("capacity = %d, want %d", d.Capacity, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnswerOfferRequeuesJob(t *testing.T) {
+	for _, accept := range []bool{true, false} {
+		t.Run(fmt.Sprintf("accept=%v", accept), func(t *testing.T) {
+			ctx := context.Background()
+			logger := slog.New(slog.DiscardHandler)
+
+			cabs := store.NewMemoryStore()
+			jobs := queue.NewMemoryQueue(queue.RetryOptions{}, logger)
+			svc := driver.NewDriverService(cabs, events.NewLocalHub(), jobs, memory.NewDriverRepository(), logger)
+
+			cab := ride.CabState{ID: "cab-1", DriverID: 1, Geohash: "tsp9d2", Capacity: 4, LuggageCapacity: 2, VehicleClass: ride.VehicleSedan}
+			if err := cabs.GoOnline(ctx, cab); err != nil {
+				t.Fatalf("GoOnline: %v", err)
+			}
+
+			rider := ride.Rider{ID: 7, TripID: 107, Geohash: "tsp9d2"}
+			if err := cabs.AddRider(ctx, rider); err != nil {
+				t.Fatalf("AddRider: %v", err)
+			}
+
+			made := ride.JobRef{Retries: 3, RequestID: "ride-request"}
+			stops := []ride.Stop{{RiderID: 7, TripID: 107, Kind: ride.StopPickup, Seats: 1}, {RiderID: 7, TripID: 107, Kind: ride.StopDrop, Seats: 1}}
+			online, err := cabs.Cab(ctx, cab.ID)
+			if err != nil {
+				t.Fatalf("Cab: %v", err)
+			}
+			if result, err := cabs.OfferRider(ctx, cab.ID, rider, online.StopsVersion, stops, time.Now().Add(time.Minute), made); err != nil || result != ride.AssignOK {
+				t.Fatalf("OfferRider = %v, %v", result, err)
+			}
+
+			if err := svc.AnswerOffer(logging.WithRequestID(ctx, "driver-answer"), cab.ID, rider.ID, accept); err != nil {
+				t.Fatalf("AnswerOffer: %v", err)
+			}
+
+			msgs, _ := jobs.Consume()
+			select {
+			case m := <-msgs:
+				if m.Retries != made.Retries || m.RequestID != made.RequestID {
+					t.Errorf("requeued job has %d retries and request ID %q, want %d and %q", m.Retries, m.RequestID, made.Retries, made.RequestID)
+				}
+			default:
+				t.Fatal("the answer queued no job")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package matching
+
+import (
+	"sort"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+// declinePenalty is what a driver who declines every offer adds to their
+// score at weight 1, in the units of the strategy's score: kilometres for
+// the distance strategies and a share of the cab's capacity for
+// load_balance
+var declinePenalty = map[string]float64{
+	StrategyGreedy:      1,
+	StrategyMinDetour:   1,
+	StrategyLoadBalance: 0.25,
+}
+
+// acceptanceMatcher ranks like the wrapped matcher but penalises cabs whose
+// drivers turn offers down
+type acceptanceMatcher struct {
+	Matcher
+	// penalty is added in full for an acceptance rate of 0
+	penalty float64
+}
+
+// WithAcceptance returns a matcher that adds weight * (1 - acceptance rate)
+// times the strategy's declinePenalty to every score of m. Adding keeps the
+// penalty when a cab scores 0, e.g. one waiting at the pickup. Equal scores
+// go to the driver more likely to accept. A weight of 0 returns m.
+func WithAcceptance(m Matcher, weight float64) Matcher {
+	if weight <= 0 {
+		return m
+	}
+
+	unit, ok := declinePenalty[m.Name()]
+	if !ok {
+		unit = 1
+	}
+	return acceptanceMatcher{Matcher: m, penalty: weight * unit}
+}
+
+func (m acceptanceMatcher) Rank(rider ride.Rider, cabs []Candidate) []Assignment {
+	rates := make(map[string]float64, len(cabs))
+	for _, cab := range cabs {
+		rates[cab.ID] = cab.Offers.AcceptanceRate()
+	}
+
+	out := m.Matcher.Rank(rider, cabs)
+	for i := range out {
+		rate := rates[out[i].CabID]
+		out[i].Score += m.penalty * (1 - rate)
+		out[i].AcceptanceRate = rate
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score < out[j].Score
+		}
+		if out[i].AcceptanceRate != out[j].AcceptanceRate {
+			return out[i].AcceptanceRate > out[j].AcceptanceRate
+		}
+		return out[i].DistanceKm < out[j].DistanceKm
+	})
+	return out
+}
@@ -0,0 +1,102 @@
+package matching
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+// declined is a driver who turned down n offers and accepted none
+func declined(n int) ride.OfferStats {
+	return ride.OfferStats{Offered: n, Declined: n}
+}
+
+func TestWithAcceptance(t *testing.T) {
+	rider := newRider(0, 0, 0, 3, 0)
+
+	tests := []struct {
+		name     string
+		strategy string
+		weight   float64
+		cabs     []Candidate
+		want     []string
+		scores   []float64
+	}{
+		{
+			// both cabs wait at the pickup, the base score is 0
+			name:     "penalised at a score of zero",
+			strategy: StrategyGreedy,
+			weight:   1,
+			cabs: []Candidate{
+				{ID: "decliner", Offers: declined(3)},
+				{ID: "keen"},
+			},
+			want:   []string{"keen", "decliner"},
+			scores: []float64{0, 0.5},
+		},
+		{
+			name:     "penalty is in kilometres",
+			strategy: StrategyGreedy,
+			weight:   2,
+			cabs: []Candidate{
+				{ID: "decliner", Offers: declined(9)},
+				{ID: "keen", Longitude: 1},
+			},
+			want:   []string{"keen", "decliner"},
+			scores: []float64{1, 1.5},
+		},
+		{
+			name:     "close decliner still beats a far cab",
+			strategy: StrategyMinDetour,
+			weight:   1,
+			cabs: []Candidate{
+				{ID: "decliner", Offers: declined(3)},
+				{ID: "keen", Longitude: 2},
+			},
+			want:   []string{"decliner", "keen"},
+			scores: []float64{0.5, 2},
+		},
+		{
+			name:     "penalty is a share of capacity for load_balance",
+			strategy: StrategyLoadBalance,
+			weight:   1,
+			cabs: []Candidate{
+				{ID: "decliner", Capacity: 4, Offers: declined(3)},
+				{ID: "keen", Capacity: 4},
+			},
+			want:   []string{"keen", "decliner"},
+			scores: []float64{0, 0.125},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.strategy, gridRouter{})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			got := WithAcceptance(m, tt.weight).Rank(rider, tt.cabs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ranked %d cabs, want %d", len(got), len(tt.want))
+			}
+
+			for i, a := range got {
+				if a.CabID != tt.want[i] {
+					t.Fatalf("rank %d = %s, want %s", i, a.CabID, tt.want[i])
+				}
+				if math.Abs(a.Score-tt.scores[i]) > 1e-9 {
+					t.Errorf("%s scores %.3f, want %.3f", a.CabID, a.Score, tt.scores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithAcceptanceZeroWeight(t *testing.T) {
+	m, _ := New(StrategyGreedy, gridRouter{})
+	if got := WithAcceptance(m, 0); got != m {
+		t.Errorf("WithAcceptance(m, 0) = %T, want m itself", got)
+	}
+}
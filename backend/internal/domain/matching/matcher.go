@@ -0,0 +1,97 @@
+package matching
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// Strategy names accepted in configuration
+const (
+	StrategyGreedy      = "greedy"
+	StrategyMinDetour   = "min_detour"
+	StrategyLoadBalance = "load_balance"
+)
+
+// staleAfterSeconds is how old a cab's last location ping may be before the
+// cab is no longer considered for matching
+const staleAfterSeconds = 30
+
+// Matcher ranks the eligible cabs for a rider, best first.
+// Implementations only order candidates; eligibility is checked by Eligible.
+type Matcher interface {
+	Name() string
+	Rank(rider ride.Rider, cabs []Candidate) []Assignment
+}
+
+// New returns the matcher registered under the given strategy name.
+// Distances are measured with the router, a nil router falls back to
+// straight-line distances.
+func New(strategy string, router routing.Router) (Matcher, error) {
+	switch strategy {
+	case StrategyGreedy, "":
+		return NearestCab{router: router}, nil
+	case StrategyMinDetour:
+		return MinDetour{router: router}, nil
+	case StrategyLoadBalance:
+		return LoadBalance{router: router}, nil
+	}
+	return nil, fmt.Errorf("unknown matching strategy %q", strategy)
+}
+
+// Eligible filters out cabs that cannot take the rider: cabs that are not
+// AVAILABLE, are of another class than the rider asked for, have not pinged
+// recently, lack a seat for the rider or space for their luggage, or whose route cannot fit the rider without detouring someone
+// beyond their tolerance. The cheapest insertion is kept on the candidate.
+func Eligible(rider ride.Rider, cabs []Candidate, now int64, router routing.Router) []Candidate {
+	out := make([]Candidate, 0, len(cabs))
+
+	for _, cab := range cabs {
+		if cab.Status != "AVAILABLE" {
+			continue
+		}
+
+		if now-cab.LastUpdate > staleAfterSeconds {
+			continue
+		}
+
+		if rider.VehicleClass != "" && cab.VehicleClass != rider.VehicleClass {
+			continue
+		}
+
+		if cab.PassengerCount+1 > cab.Capacity || cab.LuggageCount+rider.Luggage > cab.LuggageCapacity {
+			continue
+		}
+
+		start := routing.Point{Lat: cab.Latitude, Lng: cab.Longitude}
+		space := Space{Seats: cab.Capacity, Luggage: cab.LuggageCapacity}
+		plan, ok := Insert(router, start, space, cab.Stops, rider)
+		if !ok {
+			continue
+		}
+		cab.Plan = plan
+
+		out = append(out, cab)
+	}
+
+	return out
+}
+
+// sortAssignments orders by score and breaks ties by pickup distance
+func sortAssignments(a []Assignment) []Assignment {
+	sort.SliceStable(a, func(i, j int) bool {
+		if a[i].Score != a[j].Score {
+			return a[i].Score < a[j].Score
+		}
+		return a[i].DistanceKm < a[j].DistanceKm
+	})
+	return a
+}
+
+func pickupKm(router routing.Router, rider ride.Rider, cab Candidate) float64 {
+	return routing.DistanceKm(router,
+		routing.Point{Lat: cab.Latitude, Lng: cab.Longitude},
+		routing.Point{Lat: rider.Latitude, Lng: rider.Longitude})
+}
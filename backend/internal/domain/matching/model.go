@@ -0,0 +1,40 @@
+package matching
+
+import "github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+
+// Candidate is a cab near the rider as read from the cab:{id} hash and its
+// stop list
+type Candidate struct {
+	ID string
+	// DriverID is the driver the cab's offers go to
+	DriverID       int
+	Latitude       float64
+	Longitude      float64
+	Status         string
+	PassengerCount int
+	LuggageCount   int
+	Capacity       int
+	// LuggageCapacity is counted separately from the seats in Capacity
+	LuggageCapacity int
+	VehicleClass    ride.VehicleClass
+	LastUpdate      int64
+	Stops           []ride.Stop
+	// StopsVersion is bumped on every change to the stop list, an assignment
+	// only commits if the version is unchanged since it was read
+	StopsVersion int64
+	// Offers are the driver's answers to earlier offers
+	Offers ride.OfferStats
+	// Plan is the rider's cheapest insertion, set by Eligible
+	Plan *Insertion
+}
+
+// Assignment is a ranked option for placing the rider in a cab.
+// Lower scores are better; DistanceKm is the cab's distance to the pickup.
+type Assignment struct {
+	CabID      string
+	Score      float64
+	DistanceKm float64
+	Plan       *Insertion
+	// AcceptanceRate of the cab's driver, set when ranked WithAcceptance
+	AcceptanceRate float64
+}
@@ -0,0 +1,187 @@
+package matching
+
+import (
+	"math"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// detourSlackKm absorbs rounding when comparing detours with tolerances
+const detourSlackKm = 1e-6
+
+// Space is how many seats and bags a cab can carry at once
+type Space struct {
+	Seats   int
+	Luggage int
+}
+
+// Insertion is the cab's route with the new rider's pickup and drop placed
+type Insertion struct {
+	Stops []ride.Stop
+	// AddedKm is how much longer the cab's remaining route becomes
+	AddedKm float64
+}
+
+// ToleranceKm returns the rider's direct trip distance and the detour they
+// accept, their detour factor applied to the direct distance
+func ToleranceKm(router routing.Router, rider ride.Rider) (directKm, toleranceKm float64) {
+	directKm = routing.DistanceKm(router,
+		routing.Point{Lat: rider.Latitude, Lng: rider.Longitude},
+		routing.Point{Lat: rider.DropLatitude, Lng: rider.DropLongitude})
+
+	return directKm, directKm * rider.Tolerance
+}
+
+// Direct returns the rider's own pickup and drop stops, the route of a ride
+// they take alone
+func Direct(router routing.Router, rider ride.Rider) []ride.Stop {
+	directKm, toleranceKm := ToleranceKm(router, rider)
+
+	pickup := ride.Stop{
+		RiderID:     rider.ID,
+		TripID:      rider.TripID,
+		Kind:        ride.StopPickup,
+		Lat:         rider.Latitude,
+		Lng:         rider.Longitude,
+		Seats:       1,
+		Luggage:     rider.Luggage,
+		DirectKm:    directKm,
+		ToleranceKm: toleranceKm,
+	}
+
+	drop := pickup
+	drop.Kind = ride.StopDrop
+	drop.Lat = rider.DropLatitude
+	drop.Lng = rider.DropLongitude
+
+	return []ride.Stop{pickup, drop}
+}
+
+// Insert finds the cheapest position for the rider's pickup and drop in the
+// cab's stop list. Every position pair is tried; a plan is feasible when the
+// cab never carries more riders or bags than it has space for and no rider, old or new, is
+// detoured beyond their own tolerance. Riders already on board are measured
+// from the cab's current position.
+func Insert(router routing.Router, start routing.Point, space Space, stops []ride.Stop, rider ride.Rider) (*Insertion, bool) {
+	dist := memoDistance(router)
+
+	own := Direct(router, rider)
+	pickup, drop := own[0], own[1]
+
+	baseKm := routeKm(dist, start, stops)
+
+	var best []ride.Stop
+	bestKm := math.MaxFloat64
+
+	for i := 0; i <= len(stops); i++ {
+		for j := i; j <= len(stops); j++ {
+			plan := make([]ride.Stop, 0, len(stops)+2)
+			plan = append(plan, stops[:i]...)
+			plan = append(plan, pickup)
+			plan = append(plan, stops[i:j]...)
+			plan = append(plan, drop)
+			plan = append(plan, stops[j:]...)
+
+			km, ok := feasible(dist, start, space, plan)
+			if ok && km < bestKm {
+				best, bestKm = plan, km
+			}
+		}
+	}
+
+	if best == nil {
+		return nil, false
+	}
+
+	return &Insertion{Stops: best, AddedKm: bestKm - baseKm}, true
+}
+
+// feasible walks the route and returns its length if no space or
+// tolerance constraint is broken
+func feasible(dist func(a, b routing.Point) float64, start routing.Point, space Space, stops []ride.Stop) (float64, bool) {
+	pickedAt := make(map[int]float64, len(stops))
+
+	// riders whose pickup is not listed are already on board
+	var load Space
+	for _, s := range stops {
+		if s.Kind == ride.StopPickup {
+			pickedAt[s.RiderID] = -1
+		}
+	}
+	for _, s := range stops {
+		if _, pending := pickedAt[s.RiderID]; s.Kind == ride.StopDrop && !pending {
+			load.Seats += s.Seats
+			load.Luggage += s.Luggage
+		}
+	}
+	if !load.fits(space) {
+		return 0, false
+	}
+
+	cum := 0.0
+	at := start
+
+	for _, s := range stops {
+		p := routing.Point{Lat: s.Lat, Lng: s.Lng}
+		cum += dist(at, p)
+		at = p
+
+		switch s.Kind {
+		case ride.StopPickup:
+			pickedAt[s.RiderID] = cum
+			load.Seats += s.Seats
+			load.Luggage += s.Luggage
+			if !load.fits(space) {
+				return 0, false
+			}
+
+		case ride.StopDrop:
+			var detour float64
+			if from, pending := pickedAt[s.RiderID]; pending {
+				detour = cum - from - s.DirectKm
+			} else {
+				detour = cum - dist(start, p)
+			}
+
+			if detour > s.ToleranceKm+detourSlackKm {
+				return 0, false
+			}
+			load.Seats -= s.Seats
+			load.Luggage -= s.Luggage
+		}
+	}
+
+	return cum, true
+}
+
+func (l Space) fits(space Space) bool {
+	return l.Seats <= space.Seats && l.Luggage <= space.Luggage
+}
+
+func routeKm(dist func(a, b routing.Point) float64, start routing.Point, stops []ride.Stop) float64 {
+	km := 0.0
+	at := start
+	for _, s := range stops {
+		p := routing.Point{Lat: s.Lat, Lng: s.Lng}
+		km += dist(at, p)
+		at = p
+	}
+	return km
+}
+
+// memoDistance caches router answers for the duration of one insertion,
+// every candidate plan reuses the same handful of legs
+func memoDistance(router routing.Router) func(a, b routing.Point) float64 {
+	memo := make(map[[2]routing.Point]float64)
+
+	return func(a, b routing.Point) float64 {
+		key := [2]routing.Point{a, b}
+		if d, ok := memo[key]; ok {
+			return d
+		}
+		d := routing.DistanceKm(router, a, b)
+		memo[key] = d
+		return d
+	}
+}
@@ -0,0 +1,226 @@
+package matching
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// gridRouter treats coordinates as kilometres on a street grid, so
+// distances in the tests are exact
+type gridRouter struct{}
+
+func (gridRouter) Distance(from, to routing.Point) (float64, error) {
+	return math.Abs(from.Lat-to.Lat) + math.Abs(from.Lng-to.Lng), nil
+}
+
+func (r gridRouter) Duration(from, to routing.Point) (time.Duration, error) {
+	d, _ := r.Distance(from, to)
+	return time.Duration(d * float64(time.Minute)), nil
+}
+
+func (r gridRouter) Route(from, to routing.Point) (*routing.Route, error) {
+	d, _ := r.Distance(from, to)
+	return &routing.Route{Points: []routing.Point{from, to}, DistanceKm: d}, nil
+}
+
+// stop is a stop of rider id at (lat, lng) with their own direct distance
+// and tolerance
+func stop(id int, kind ride.StopKind, lat, lng, directKm, toleranceKm float64) ride.Stop {
+	return ride.Stop{RiderID: id, Kind: kind, Lat: lat, Lng: lng, Seats: 1, DirectKm: directKm, ToleranceKm: toleranceKm}
+}
+
+// newRider is rider 2 travelling from (pLat, pLng) to (dLat, dLng)
+func newRider(pLat, pLng, dLat, dLng, tolerance float64) ride.Rider {
+	return ride.Rider{ID: 2, Latitude: pLat, Longitude: pLng, DropLatitude: dLat, DropLongitude: dLng, Tolerance: tolerance}
+}
+
+// planOf names the stops of a plan, "p1" being rider 1's pickup
+func planOf(stops []ride.Stop) []string {
+	out := make([]string, len(stops))
+	for i, s := range stops {
+		kind := "d"
+		if s.Kind == ride.StopPickup {
+			kind = "p"
+		}
+		out[i] = kind + string(rune('0'+s.RiderID))
+	}
+	return out
+}
+
+func TestInsert(t *testing.T) {
+	origin := routing.Point{}
+	roomy := Space{Seats: 4, Luggage: 4}
+
+	tests := []struct {
+		name    string
+		space   Space
+		stops   []ride.Stop
+		rider   ride.Rider
+		want    []string
+		addedKm float64
+	}{
+		{
+			name:    "empty route",
+			space:   roomy,
+			rider:   newRider(0, 1, 0, 3, 0),
+			want:    []string{"p2", "d2"},
+			addedKm: 3,
+		},
+		{
+			name:    "drop stays after pickup when it is nearer",
+			space:   roomy,
+			rider:   newRider(0, 3, 0, 1, 0),
+			want:    []string{"p2", "d2"},
+			addedKm: 5,
+		},
+		{
+			name:  "rider on the way rides along within tolerance",
+			space: roomy,
+			stops: []ride.Stop{
+				stop(1, ride.StopPickup, 0, 1, 4, 0),
+				stop(1, ride.StopDrop, 0, 5, 4, 0),
+			},
+			rider:   newRider(0, 2, 0, 3, 0),
+			want:    []string{"p1", "p2", "d2", "d1"},
+			addedKm: 0,
+		},
+		{
+			name:  "detour within the passenger's tolerance",
+			space: roomy,
+			stops: []ride.Stop{
+				stop(1, ride.StopDrop, 0, 4, 4, 2.5),
+			},
+			rider:   newRider(1, 1, 1, 2, 0),
+			want:    []string{"p2", "d2", "d1"},
+			addedKm: 2,
+		},
+		{
+			name:  "kept out of the ride of a passenger it would detour too far",
+			space: roomy,
+			stops: []ride.Stop{
+				stop(1, ride.StopDrop, 0, 4, 4, 1),
+			},
+			rider:   newRider(1, 1, 1, 2, 0),
+			want:    []string{"d1", "p2", "d2"},
+			addedKm: 5,
+		},
+		{
+			name:  "no overlap without a free seat",
+			space: Space{Seats: 1, Luggage: 4},
+			stops: []ride.Stop{
+				stop(1, ride.StopPickup, 0, 1, 4, 0),
+				stop(1, ride.StopDrop, 0, 5, 4, 0),
+			},
+			rider:   newRider(0, 2, 0, 6, 0),
+			want:    []string{"p1", "d1", "p2", "d2"},
+			addedKm: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins, ok := Insert(gridRouter{}, origin, tt.space, tt.stops, tt.rider)
+			if !ok {
+				t.Fatal("Insert found no feasible plan")
+			}
+
+			got := planOf(ins.Stops)
+			if len(got) != len(tt.want) {
+				t.Fatalf("plan = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("plan = %v, want %v", got, tt.want)
+				}
+			}
+
+			if math.Abs(ins.AddedKm-tt.addedKm) > 1e-9 {
+				t.Errorf("added = %.2fkm, want %.2fkm", ins.AddedKm, tt.addedKm)
+			}
+		})
+	}
+}
+
+func TestInsertRejects(t *testing.T) {
+	rider := newRider(0, 1, 0, 3, 0)
+	rider.Luggage = 3
+
+	if ins, ok := Insert(gridRouter{}, routing.Point{}, Space{Seats: 4, Luggage: 2}, nil, rider); ok {
+		t.Errorf("Insert = %v, want no plan for luggage beyond the cab's space", planOf(ins.Stops))
+	}
+}
+
+func TestFeasible(t *testing.T) {
+	dist := memoDistance(gridRouter{})
+	roomy := Space{Seats: 4, Luggage: 4}
+
+	tests := []struct {
+		name  string
+		space Space
+		stops []ride.Stop
+		km    float64
+		ok    bool
+	}{
+		{name: "empty route", space: roomy, ok: true},
+		{
+			name:  "passenger on board within tolerance",
+			space: roomy,
+			stops: []ride.Stop{stop(1, ride.StopDrop, 0, 4, 4, 0)},
+			km:    4,
+			ok:    true,
+		},
+		{
+			name:  "passenger on board detoured beyond tolerance",
+			space: roomy,
+			stops: []ride.Stop{
+				stop(2, ride.StopPickup, 1, 1, 1, 0),
+				stop(2, ride.StopDrop, 1, 2, 1, 0),
+				stop(1, ride.StopDrop, 0, 4, 4, 1),
+			},
+		},
+		{
+			name:  "waiting rider detoured beyond tolerance",
+			space: roomy,
+			stops: []ride.Stop{
+				stop(1, ride.StopPickup, 0, 1, 2, 0.5),
+				stop(2, ride.StopPickup, 1, 2, 1, 0),
+				stop(2, ride.StopDrop, 1, 3, 1, 0),
+				stop(1, ride.StopDrop, 0, 3, 2, 0.5),
+			},
+		},
+		{
+			name:  "more riders than seats",
+			space: Space{Seats: 1, Luggage: 4},
+			stops: []ride.Stop{
+				stop(1, ride.StopPickup, 0, 1, 4, 0),
+				stop(2, ride.StopPickup, 0, 2, 1, 0),
+				stop(2, ride.StopDrop, 0, 3, 1, 0),
+				stop(1, ride.StopDrop, 0, 5, 4, 0),
+			},
+		},
+		{
+			name:  "passengers on board already fill the cab",
+			space: Space{Seats: 1, Luggage: 4},
+			stops: []ride.Stop{
+				stop(1, ride.StopDrop, 0, 4, 4, 0),
+				stop(2, ride.StopDrop, 0, 5, 5, 0),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km, ok := feasible(dist, routing.Point{}, tt.space, tt.stops)
+			if ok != tt.ok {
+				t.Fatalf("feasible = %t, want %t", ok, tt.ok)
+			}
+			if ok && math.Abs(km-tt.km) > 1e-9 {
+				t.Errorf("route = %.2fkm, want %.2fkm", km, tt.km)
+			}
+		})
+	}
+}
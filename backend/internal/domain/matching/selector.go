@@ -0,0 +1,54 @@
+package matching
+
+import (
+	"strings"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// Selector picks the matcher for a rider's cell. Zone overrides are keyed by
+// geohash prefix and the longest matching prefix wins, so a whole city can
+// run one strategy while a few districts A/B test another.
+type Selector struct {
+	def   Matcher
+	zones map[string]Matcher
+}
+
+// NewSelector builds a selector from strategy names. Every matcher weighs
+// the drivers' acceptance rates with acceptanceWeight, see WithAcceptance.
+func NewSelector(defaultStrategy string, zoneStrategies map[string]string, acceptanceWeight float64, router routing.Router) (*Selector, error) {
+	def, err := New(defaultStrategy, router)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Selector{
+		def:   WithAcceptance(def, acceptanceWeight),
+		zones: make(map[string]Matcher, len(zoneStrategies)),
+	}
+
+	for prefix, strategy := range zoneStrategies {
+		m, err := New(strategy, router)
+		if err != nil {
+			return nil, err
+		}
+		s.zones[prefix] = WithAcceptance(m, acceptanceWeight)
+	}
+
+	return s, nil
+}
+
+// For returns the matcher configured for the given geohash cell
+func (s *Selector) For(geohash string) Matcher {
+	best := ""
+	m := s.def
+
+	for prefix, zm := range s.zones {
+		if strings.HasPrefix(geohash, prefix) && len(prefix) > len(best) {
+			best = prefix
+			m = zm
+		}
+	}
+
+	return m
+}
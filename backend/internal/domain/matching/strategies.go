@@ -0,0 +1,68 @@
+package matching
+
+import (
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// NearestCab is the original greedy policy: the closest cab wins
+type NearestCab struct {
+	router routing.Router
+}
+
+func (NearestCab) Name() string { return StrategyGreedy }
+
+func (m NearestCab) Rank(rider ride.Rider, cabs []Candidate) []Assignment {
+	out := make([]Assignment, len(cabs))
+	for i, cab := range cabs {
+		d := pickupKm(m.router, rider, cab)
+		out[i] = Assignment{CabID: cab.ID, Score: d, DistanceKm: d, Plan: cab.Plan}
+	}
+	return sortAssignments(out)
+}
+
+// MinDetour prefers the cab whose route grows the least when the rider's
+// pickup and drop are inserted at their cheapest positions
+type MinDetour struct {
+	router routing.Router
+}
+
+func (MinDetour) Name() string { return StrategyMinDetour }
+
+func (m MinDetour) Rank(rider ride.Rider, cabs []Candidate) []Assignment {
+	out := make([]Assignment, len(cabs))
+	for i, cab := range cabs {
+		d := pickupKm(m.router, rider, cab)
+
+		added := d
+		if cab.Plan != nil {
+			added = cab.Plan.AddedKm
+		}
+
+		out[i] = Assignment{CabID: cab.ID, Score: added, DistanceKm: d, Plan: cab.Plan}
+	}
+	return sortAssignments(out)
+}
+
+// LoadBalance spreads riders across cabs by preferring the emptiest one,
+// measured as the larger of the shares of seats and luggage space taken
+type LoadBalance struct {
+	router routing.Router
+}
+
+func (LoadBalance) Name() string { return StrategyLoadBalance }
+
+func (m LoadBalance) Rank(rider ride.Rider, cabs []Candidate) []Assignment {
+	out := make([]Assignment, len(cabs))
+	for i, cab := range cabs {
+		load := 1.0
+		if cab.Capacity > 0 {
+			load = float64(cab.PassengerCount) / float64(cab.Capacity)
+		}
+		if cab.LuggageCapacity > 0 {
+			load = max(load, float64(cab.LuggageCount)/float64(cab.LuggageCapacity))
+		}
+		out[i] = Assignment{CabID: cab.ID, Score: load, DistanceKm: pickupKm(m.router, rider, cab), Plan: cab.Plan}
+	}
+	return sortAssignments(out)
+}
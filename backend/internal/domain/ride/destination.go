@@ -0,0 +1,66 @@
+package ride
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrUnknownDestination = errors.New("unknown destination")
+
+// Destination is a drop point. Named destinations are hubs from the
+// configured catalogue (airports, stations); ad-hoc drops have no name.
+type Destination struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// Destinations is the catalogue of named hubs riders can be dropped at
+type Destinations struct {
+	hubs        map[string]Destination
+	defaultName string
+}
+
+// NewDestinations builds a catalogue from the given hubs. defaultName is used
+// when a rider does not pick a destination and must be one of the hubs.
+func NewDestinations(hubs []Destination, defaultName string) (Destinations, error) {
+	d := Destinations{
+		hubs:        make(map[string]Destination, len(hubs)),
+		defaultName: defaultName,
+	}
+
+	for _, h := range hubs {
+		d.hubs[h.Name] = h
+	}
+
+	if _, ok := d.hubs[defaultName]; !ok {
+		return Destinations{}, fmt.Errorf("%w: default destination %q is not a configured hub", ErrUnknownDestination, defaultName)
+	}
+
+	return d, nil
+}
+
+// Lookup returns the hub with the given name, or the default hub when name is empty
+func (d Destinations) Lookup(name string) (Destination, error) {
+	if name == "" {
+		name = d.defaultName
+	}
+
+	h, ok := d.hubs[name]
+	if !ok {
+		return Destination{}, fmt.Errorf("%w: %q", ErrUnknownDestination, name)
+	}
+
+	return h, nil
+}
+
+// All returns every configured hub sorted by name
+func (d Destinations) All() []Destination {
+	out := make([]Destination, 0, len(d.hubs))
+	for _, h := range d.hubs {
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
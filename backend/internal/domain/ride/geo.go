@@ -0,0 +1,62 @@
+package ride
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mmcloughlin/geohash"
+)
+
+// CellPrecision is the geohash length used for the cell:{geohash}:cabs and
+// pool:cell:{geohash}:waiting indexes. Six characters is roughly a 1.2km x 0.6km
+// cell, so a cell plus its 8 neighbours covers a few kilometres around a rider.
+const CellPrecision = 6
+
+// ErrInvalidCell is returned for strings that are not a geohash of
+// CellPrecision characters
+var ErrInvalidCell = errors.New("invalid cell geohash")
+
+// CellOf returns the geohash cell that the given coordinates belong to.
+// Riders and cabs must both be indexed with this function so that they
+// land in comparable cells.
+func CellOf(lat, lng float64) string {
+	return geohash.EncodeWithPrecision(lat, lng, CellPrecision)
+}
+
+// ValidateCell returns ErrInvalidCell unless cell is a geohash CellOf could
+// have returned
+func ValidateCell(cell string) error {
+	if len(cell) != CellPrecision || geohash.Validate(cell) != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidCell, cell)
+	}
+	return nil
+}
+
+// Area is a rectangle of the service area
+type Area struct {
+	Name   string
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+func (a Area) Contains(lat, lng float64) bool {
+	return lat >= a.MinLat && lat <= a.MaxLat && lng >= a.MinLng && lng <= a.MaxLng
+}
+
+// GeoFence is the service area riders are picked up and dropped in, the
+// union of its areas. An empty fence lets every point in.
+type GeoFence []Area
+
+func (f GeoFence) Contains(lat, lng float64) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, a := range f {
+		if a.Contains(lat, lng) {
+			return true
+		}
+	}
+	return false
+}
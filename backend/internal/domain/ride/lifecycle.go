@@ -0,0 +1,62 @@
+package ride
+
+import "errors"
+
+// TripStatus is the lifecycle state of a trip persisted in rider_schema.trip
+type TripStatus string
+
+const (
+	TripCreated        TripStatus = "CREATED"
+	TripDriverAssigned TripStatus = "DRIVER_ASSIGNED"
+	TripDriverArrived  TripStatus = "DRIVER_ARRIVED"
+	TripInProgress     TripStatus = "IN_PROGRESS"
+	TripCompleted      TripStatus = "COMPLETED"
+	TripCancelled      TripStatus = "CANCELLED"
+)
+
+var (
+	ErrTripNotFound      = errors.New("trip not found")
+	ErrInvalidTransition = errors.New("invalid trip status transition")
+	// ErrTripConflict is returned when the trip changed status between
+	// reading it and writing the transition.
+	ErrTripConflict = errors.New("trip status changed concurrently")
+	// ErrRideInProgress is returned when a rider requests a ride while still
+	// waiting for a match or riding.
+	ErrRideInProgress = errors.New("rider already has a ride in progress")
+)
+
+// tripTransitions lists the legal next states for every non-terminal state.
+//
+//	CREATED -> DRIVER_ASSIGNED -> DRIVER_ARRIVED -> IN_PROGRESS -> COMPLETED
+//	   \______________\_________________\______________-> CANCELLED
+var tripTransitions = map[TripStatus][]TripStatus{
+	TripCreated:        {TripDriverAssigned, TripCancelled},
+	TripDriverAssigned: {TripDriverArrived, TripCancelled},
+	TripDriverArrived:  {TripInProgress, TripCancelled},
+	TripInProgress:     {TripCompleted},
+}
+
+// CanTransitionTo reports whether a trip in status s may move to next
+func (s TripStatus) CanTransitionTo(next TripStatus) bool {
+	for _, allowed := range tripTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transitions are possible
+func (s TripStatus) IsTerminal() bool {
+	return len(tripTransitions[s]) == 0
+}
+
+// IsValid reports whether s is one of the known trip statuses
+func (s TripStatus) IsValid() bool {
+	switch s {
+	case TripCreated, TripDriverAssigned, TripDriverArrived,
+		TripInProgress, TripCompleted, TripCancelled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package ride
+
+import "testing"
+
+func TestTripStatusCanTransitionTo(t *testing.T) {
+	statuses := []TripStatus{
+		TripCreated, TripDriverAssigned, TripDriverArrived,
+		TripInProgress, TripCompleted, TripCancelled,
+	}
+
+	// every pair not listed here is forbidden
+	allowed := map[TripStatus]map[TripStatus]bool{
+		TripCreated:        {TripDriverAssigned: true, TripCancelled: true},
+		TripDriverAssigned: {TripDriverArrived: true, TripCancelled: true},
+		TripDriverArrived:  {TripInProgress: true, TripCancelled: true},
+		TripInProgress:     {TripCompleted: true},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[from][to]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s: CanTransitionTo = %t, want %t", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTripStatusIsTerminal(t *testing.T) {
+	tests := []struct {
+		status TripStatus
+		want   bool
+	}{
+		{TripCreated, false},
+		{TripDriverAssigned, false},
+		{TripDriverArrived, false},
+		{TripInProgress, false},
+		{TripCompleted, true},
+		{TripCancelled, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.want {
+			t.Errorf("%s: IsTerminal = %t, want %t", tt.status, got, tt.want)
+		}
+		if !tt.status.IsValid() {
+			t.Errorf("%s: IsValid = false", tt.status)
+		}
+	}
+
+	if TripStatus("BOARDING").IsValid() {
+		t.Error("unknown status is valid")
+	}
+}
@@ -1,22 +1,64 @@
 package ride
 
+import "time"
+
 // Rider represents the Rider entity stored in Redis
 type Rider struct {
 	ID        int
+	TripID    int
 	Geohash   string
 	Longitude float64
 	Latitude  float64
 	Luggage   int
 	Tolerance float64
+	// VehicleClass restricts matching to one class, empty accepts any cab
+	VehicleClass VehicleClass
+
+	Destination   string
+	DropLatitude  float64
+	DropLongitude float64
 }
 
 type Trip struct {
-	TripID     int
-	Passengers []Rider
-	Luggage    int
+	TripID      int
+	RiderID     int
+	CabID       string
+	Status      TripStatus
+	PickupLat   float64
+	PickupLng   float64
+	DropLat     float64
+	DropLng     float64
+	CreatedAt   time.Time
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	Events      []TripEvent
+	Passengers  []Rider
+	Luggage     int
+}
+
+// TripEvent records a single state transition of a trip
+type TripEvent struct {
+	From TripStatus
+	To   TripStatus
+	At   time.Time
+}
+
+// Cell is a snapshot of one geohash cell of the matching index
+type Cell struct {
+	Geohash       string
+	WaitingRiders []int
+	Cabs          []CabState
 }
 
 type Fare struct {
-	ID     int
-	Amount float64
+	ID           int
+	Amount       float64
+	VehicleClass VehicleClass
+}
+
+// ETA is how far a cab is from a point along the road and how long it
+// takes to get there
+type ETA struct {
+	DistanceKm float64
+	Duration   time.Duration
 }
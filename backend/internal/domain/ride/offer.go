@@ -0,0 +1,75 @@
+package ride
+
+import (
+	"errors"
+	"time"
+)
+
+// OfferStatus is where the offer of a rider to a cab's driver stands
+type OfferStatus string
+
+const (
+	// OfferOpen holds the rider's seat while the driver decides
+	OfferOpen     OfferStatus = "OFFERED"
+	OfferAccepted OfferStatus = "ACCEPTED"
+	OfferDeclined OfferStatus = "DECLINED"
+	// OfferExpired is an offer the driver did not answer in time
+	OfferExpired OfferStatus = "EXPIRED"
+	// OfferWithdrawn is an offer whose rider left, e.g. cancelled, before
+	// the driver answered
+	OfferWithdrawn OfferStatus = "WITHDRAWN"
+)
+
+// OfferRetention is how long an offer is kept after it was made. It is well
+// beyond any answer deadline so a job handed back to the queue finds the
+// offer it left behind.
+const OfferRetention = time.Hour
+
+var (
+	// ErrOfferNotFound is returned when the rider has no offer with the cab,
+	// e.g. because they cancelled meanwhile
+	ErrOfferNotFound = errors.New("offer not found")
+	// ErrOfferClosed is returned for answers to an offer that was already
+	// answered, expired or withdrawn, and for drivers answering late
+	ErrOfferClosed = errors.New("offer is no longer open")
+)
+
+// Offer is a rider's seat reserved in a cab until the driver accepts or
+// declines it, or ExpiresAt passes
+type Offer struct {
+	RiderID   int
+	CabID     string
+	Status    OfferStatus
+	ExpiresAt time.Time
+	// Request is the ride request the rider was offered for, matched
+	// again once the driver answers
+	Request Rider
+	// Job is the matching job that made the offer
+	Job JobRef
+}
+
+// JobRef identifies the matching job an offer was made from. The job the
+// driver's answer queues carries its retry count and request ID on.
+type JobRef struct {
+	Retries   int
+	RequestID string
+}
+
+// acceptancePrior is counted as accepted offers on top of a driver's own
+// answers, so a new driver starts at a rate of 1 and a single decline does
+// not sink them
+const acceptancePrior = 3
+
+// OfferStats counts a driver's answers to the offers made to their cab
+type OfferStats struct {
+	Offered  int
+	Accepted int
+	Declined int
+	Expired  int
+}
+
+// AcceptanceRate is the share of answered offers the driver accepted
+func (s OfferStats) AcceptanceRate() float64 {
+	answered := s.Accepted + s.Declined + s.Expired
+	return float64(s.Accepted+acceptancePrior) / float64(answered+acceptancePrior)
+}
@@ -3,5 +3,14 @@ package ride
 import "context"
 
 type Repository interface {
-	GetRiderandTripID(ctx context.Context) (int, int, error)
-}
\ No newline at end of file
+	// CreateTrip opens a CREATED trip for the rider and returns its ID
+	CreateTrip(ctx context.Context, riderID int) (int, error)
+
+	GetTrip(ctx context.Context, tripID int) (*Trip, error)
+	// AssignTripCab moves a CREATED trip to DRIVER_ASSIGNED and stores the
+	// matched cab together with the pickup and drop coordinates.
+	AssignTripCab(ctx context.Context, trip Trip) error
+	// TransitionTrip moves the trip from one status to another and records
+	// the transition. It returns ErrTripConflict if the trip is no longer in from.
+	TransitionTrip(ctx context.Context, tripID int, from, to TripStatus) error
+}
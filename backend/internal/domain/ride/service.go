@@ -3,16 +3,16 @@ package ride
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"time"
 
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
 	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
-
-	"github.com/mmcloughlin/geohash"
-	amqp "github.com/rabbitmq/amqp091-go"
-	"github.com/redis/go-redis/v9"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
 	// "github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/worker"
 )
 
@@ -21,9 +21,25 @@ type Service interface {
     AddRiderPresence(ctx context.Context, req Rider) error
     GetRiderStatus(ctx context.Context, riderID int) (status string, cabID string, err error)
 
-	GetRiderandTripID(ctx context.Context) (int, int, error)
+	CreateTrip(ctx context.Context, riderID int) (int, error)
     RequestRide(ctx context.Context, ride Rider) (*Trip, error)
-    CalculateFare(ctx context.Context, lat, lng float64 )(*Fare, error)
+    CalculateFare(ctx context.Context, pickup, drop Destination, class string)(*Fare, error)
+    ResolveDestination(name string) (Destination, error)
+    ListDestinations() []Destination
+    EstimateETA(from, to Destination) (*ETA, error)
+
+    GetTrip(ctx context.Context, tripID int) (*Trip, error)
+    AdvanceTrip(ctx context.Context, tripID int, to TripStatus) (*Trip, error)
+    ForceCancelTrip(ctx context.Context, tripID int) (*Trip, error)
+    InspectCell(ctx context.Context, geohash string) (*Cell, error)
+    LocateCab(ctx context.Context, cabID string) (*CabState, error)
+
+    // OpenSession keeps the ride request alive across sockets
+    OpenSession(ctx context.Context, req Rider) (*Session, error)
+    // ResumeSession attaches a new socket of the rider to the session
+    ResumeSession(ctx context.Context, token string, riderID int) (*Session, error)
+    SessionEpoch(ctx context.Context, token string) (int64, error)
+    CloseSession(ctx context.Context, token string) error
 
     // SaveTripDetails(ctx context.Context, trip Trip, rider Rider) error
     // MarkFareInGeohash(ctx cont, geohash string, fare float64) error
@@ -31,89 +47,86 @@ type Service interface {
     RemoveFromWaitingPool(ctx context.Context, riderID int, geohash string) error
     GetAssignedCabIfAny(ctx context.Context, riderID int) (string, error)
     ReleaseCabSeat(ctx context.Context, cabID string, riderID int) error
-    NotifyDriverCancellation(ctx context.Context, cabID string, riderID int) error
+    NotifyDriverCancellation(ctx context.Context, cabID string, riderID, tripID int) error
     DeleteRiderRedisKeys(ctx context.Context, riderID int) error
 }
 
 type service struct {
-    redisClient *redis.Client
-    mqChannel *queue.MQChannel
+    jobs queue.JobQueue
+    locations LocationStore
+    cabs CabStore
+    publisher events.Publisher
+    drivers events.DriverPublisher
 	repo Repository
+	destinations Destinations
+	router routing.Router
+	logger *slog.Logger
 }
 
 // NewRideService function initialises a new ride service 
-func NewRideService(mqChannel *queue.MQChannel, redisClient *redis.Client, repo Repository) Service{
+func NewRideService(jobs queue.JobQueue, locations LocationStore, cabs CabStore, publisher events.Publisher, drivers events.DriverPublisher, repo Repository, destinations Destinations, router routing.Router, logger *slog.Logger) Service{
     return &service{
-        mqChannel: mqChannel,
-        redisClient: redisClient,
+        jobs: jobs,
+        locations: locations,
+        cabs: cabs,
+        publisher: publisher,
+        drivers: drivers,
 		repo: repo,
+		destinations: destinations,
+		router: router,
+		logger: logger,
     }
 }
 
-
-func(s *service)GetRiderandTripID(ctx context.Context) (int, int,error){
-	return s.repo.GetRiderandTripID(ctx)
+// ResolveDestination looks up a named hub, falling back to the default hub
+func (s *service) ResolveDestination(name string) (Destination, error) {
+	return s.destinations.Lookup(name)
 }
-func (s *service) AddRiderPresence(ctx context.Context, req Rider) error {
-	riderKey := fmt.Sprintf("rider:%d", req.ID)
 
-	pipe := s.redisClient.TxPipeline()
+func (s *service) ListDestinations() []Destination {
+	return s.destinations.All()
+}
 
-    // Add rider key value 
-	pipe.HSet(ctx, riderKey, map[string]interface{}{
-		"lat":            req.Latitude,
-		"lng":            req.Longitude,
-		"geohash":        req.Geohash,
-		"status":         "PENDING",
-		"last_update_ts": time.Now().Unix(),
-	})
 
-    // add rider to geohash set
-	pipe.SAdd(ctx, fmt.Sprintf("pool:cell:%s:waiting", req.Geohash), req.ID)
+// CreateTrip opens a trip for the rider, unless they are already waiting
+// for a match or riding
+func (s *service) CreateTrip(ctx context.Context, riderID int) (int, error) {
+	status, _, err := s.locations.RiderStatus(ctx, riderID)
+	switch {
+	case errors.Is(err, ErrRiderNotFound):
+	case err != nil:
+		return 0, err
+	case status == "PENDING" || status == "MATCHED" || status == string(OfferOpen):
+		return 0, ErrRideInProgress
+	}
 
-	_, err := pipe.Exec(ctx)
-	return err
+	return s.repo.CreateTrip(ctx, riderID)
+}
+func (s *service) AddRiderPresence(ctx context.Context, req Rider) error {
+    // add rider to the live store and their cell's waiting pool
+	return s.locations.AddRider(ctx, req)
 }
 
 
 func (s *service) GetRiderStatus(ctx context.Context, riderID int) (string, string, error) {
-	riderKey := fmt.Sprintf("rider:%d", riderID)
-
-    // get status from rider key value
-	status, err := s.redisClient.HGet(ctx, riderKey, "status").Result()
-	if err != nil {
-		return "", "", err
-	}
-
-    // get cab details from rider key value
-	cabID, err := s.redisClient.HGet(ctx, riderKey, "cab_id").Result()
-	if err == redis.Nil {
-		return status, "", nil
-	}
-	if err != nil {
-		return "", "", err
-	}
-
-	return status, cabID, nil
+	return s.locations.RiderStatus(ctx, riderID)
 }
 
 func (s *service) MarkRiderCancelled(ctx context.Context, riderID int) error {
-	riderKey := fmt.Sprintf("rider:%d", riderID)
-    // set rider key value as cancelled
-	return s.redisClient.HSet(ctx, riderKey, "status", "CANCELLED").Err()
+    // set rider status as cancelled
+	return s.locations.SetRiderStatus(ctx, riderID, "CANCELLED")
 }
 
 
 func (s *service) RemoveFromWaitingPool(ctx context.Context, riderID int, geohash string) error {
-    // remove from geohahs set
-	return s.redisClient.SRem(ctx, fmt.Sprintf("pool:cell:%s:waiting", geohash), riderID).Err()
+    // remove from geohash set
+	return s.locations.RemoveFromWaitingPool(ctx, riderID, geohash)
 }
 
 
 func (s *service) GetAssignedCabIfAny(ctx context.Context, riderID int) (string, error) {
-	riderKey := fmt.Sprintf("rider:%d", riderID)
-	cabID, err := s.redisClient.HGet(ctx, riderKey, "cab_id").Result()
-	if err == redis.Nil {
+	_, cabID, err := s.locations.RiderStatus(ctx, riderID)
+	if errors.Is(err, ErrRiderNotFound) {
 		return "", nil
 	}
 	return cabID, err
@@ -121,48 +134,23 @@ func (s *service) GetAssignedCabIfAny(ctx context.Context, riderID int) (string,
 
 
 func (s *service) ReleaseCabSeat(ctx context.Context, cabID string, riderID int) error {
-	lua := `
-    
-    -- KEYS[1] = cab:{id}
-    -- KEYS[2] = cab:{id}:riders
-    -- ARGV[1] = riderID
-
-    redis.call("SREM", KEYS[2], ARGV[1])
-    redis.call("HINCRBY", KEYS[1], "passenger_count", -1)
-
-    local capacity = tonumber(redis.call("HGET", KEYS[1], "capacity"))
-    local pc = tonumber(redis.call("HGET", KEYS[1], "passenger_count"))
-
-    if pc < capacity then
-    redis.call("HSET", KEYS[1], "status", "AVAILABLE")
-    end
-
-    return 1
-
-    `
-
-	cabKey := fmt.Sprintf("cab:%s", cabID)
-	cabRidersKey := fmt.Sprintf("cab:%s:riders", cabID)
-
-	_, err := s.redisClient.Eval(ctx, lua, []string{cabKey, cabRidersKey}, riderID).Result()
-	return err
+	return s.cabs.ReleaseSeat(ctx, cabID, riderID)
 }
 
-
-func (s *service) NotifyDriverCancellation(ctx context.Context, cabID string, riderID int) error {
-    message := map[string]interface{}{
-        "cabID": cabID,
-        "riderID": riderID,
-        "event": "RIDER_CANCELLED",
-    }
-    body, _ := json.Marshal(message)
-    return s.publishMessage(body)
+// NotifyDriverCancellation tells the cab's driver that the rider left their
+// route, the seat has to be released before
+func (s *service) NotifyDriverCancellation(ctx context.Context, cabID string, riderID, tripID int) error {
+	return s.drivers.PublishDriverEvent(ctx, events.DriverEvent{
+		Type:    events.TypeRiderCancelled,
+		CabID:   cabID,
+		RiderID: riderID,
+		TripID:  tripID,
+	})
 }
 
 func (s *service) DeleteRiderRedisKeys(ctx context.Context, riderID int) error {
     // delete rider key
-	riderKey := fmt.Sprintf("rider:%d", riderID)
-	return s.redisClient.Del(ctx, riderKey).Err()
+	return s.locations.DeleteRider(ctx, riderID)
 }
 
 
@@ -170,63 +158,65 @@ func (s *service) DeleteRiderRedisKeys(ctx context.Context, riderID int) error {
 
 func (s *service) RequestRide(ctx context.Context, req Rider) (*Trip, error) {
 	if req.ID == 0 {
-		log.Println("Invalid rider ID")
 		return nil, fmt.Errorf("invalid rider ID")
 	}
 
-	geohash := geohash.Encode(req.Latitude, req.Longitude)
+	logger := s.logger.With(logging.RiderID(req.ID), logging.TripID(req.TripID))
 
-	riderKey := fmt.Sprintf("rider:%d", req.ID)
-
-	err := s.redisClient.HSet(ctx, riderKey, map[string]interface{}{
-		"lat":     req.Latitude,
-		"lng":     req.Longitude,
-		"geohash": req.Geohash,
-		"status":  "PENDING",
-	}).Err()
+	geohash := CellOf(req.Latitude, req.Longitude)
 
+	err := s.locations.SetRiderStatus(ctx, req.ID, "PENDING")
 	if err != nil {
-		log.Printf("failed to store ride request in redis: %v", err)
+		logger.ErrorContext(ctx, "failed to store ride request", logging.Err(err))
 		return nil, err
 	}
 
-    rider := Rider{
-        ID: req.ID,
-        Geohash: geohash,
-        Longitude: req.Longitude,
-        Latitude: req.Latitude,
-    }
+    rider := req
+    rider.Geohash = geohash
 	
 	body, err := json.Marshal(rider)
 	if err != nil {
-		log.Printf("failed to marshal ride request: %v", err)
+		logger.ErrorContext(ctx, "failed to marshal ride request", logging.Err(err))
 		return nil, err
 	}
 
-	if err := s.publishMessage(body); err != nil {
-		log.Printf("failed to publish ride request: %v", err)
+	if err := s.jobs.Publish(ctx, body); err != nil {
+		logger.ErrorContext(ctx, "failed to publish ride request", logging.Err(err))
 		return nil, err
 	}
 
+	logger.InfoContext(ctx, "ride request published", "geohash", geohash)
+
 	trip := &Trip{
-		
+		TripID:    req.TripID,
+		RiderID:   req.ID,
+		Status:    TripCreated,
+		PickupLat: req.Latitude,
+		PickupLng: req.Longitude,
+		DropLat:   req.DropLatitude,
+		DropLng:   req.DropLongitude,
 	}
 
 	return trip, nil
 }
 
-func (s *service) CalculateFare(ctx context.Context, lat, lng float64) (*Fare, error) {
-	gh := geohash.Encode(lat, lng)
+func (s *service) CalculateFare(ctx context.Context, pickup, drop Destination, class string) (*Fare, error) {
+	vehicle, err := LookupVehicleClass(class)
+	if err != nil {
+		return nil, err
+	}
 
-	distanceKm := haversineKmToAirport(lat, lng)
+	gh := CellOf(pickup.Latitude, pickup.Longitude)
 
-	const basePerKm = 12.0 // tweak as needed
-	baseFare := distanceKm * basePerKm
+	// fares are priced on the road distance, straight line if it cannot be routed
+	distanceKm := routing.DistanceKm(s.router,
+		routing.Point{Lat: pickup.Latitude, Lng: pickup.Longitude},
+		routing.Point{Lat: drop.Latitude, Lng: drop.Longitude})
 
-	waitingKey := fmt.Sprintf("pool:cell:%s:waiting", gh)
+	const basePerKm = 12.0 // tweak as needed
+	baseFare := distanceKm * basePerKm * vehicle.FareMultiplier
 
-	log.Println("hii rediis")
-	demand, err := s.redisClient.SCard(ctx, waitingKey).Result()
+	demand, err := s.locations.WaitingCount(ctx, gh)
 	if err != nil {
 		return nil, err
 	}
@@ -238,7 +228,7 @@ func (s *service) CalculateFare(ctx context.Context, lat, lng float64) (*Fare, e
 
 	finalFare := baseFare * multiplier
 
-	const minFare = 50.0
+	minFare := 50.0 * vehicle.FareMultiplier
 	if finalFare < minFare {
 		finalFare = minFare
 	}
@@ -246,42 +236,224 @@ func (s *service) CalculateFare(ctx context.Context, lat, lng float64) (*Fare, e
 	f := &Fare{
 		ID:     int(time.Now().Unix()), // or some generator
 		Amount: math.Round(finalFare*100) / 100, // round to 2 decimals
+		VehicleClass: vehicle.Class,
 	}
 
-	cacheKey := fmt.Sprintf("fare:%s:%f:%f", gh, lat, lng)
-	_ = s.redisClient.Set(ctx, cacheKey, f.Amount, 30*time.Second).Err()
+	cacheKey := fmt.Sprintf("fare:%s:%s:%f:%f:%f:%f", gh, vehicle.Class, pickup.Latitude, pickup.Longitude, drop.Latitude, drop.Longitude)
+	_ = s.locations.CacheFare(ctx, cacheKey, f.Amount, 30*time.Second)
 
 	return f, nil
 }
 
+// EstimateETA returns the road distance and driving time between the points
+func (s *service) EstimateETA(from, to Destination) (*ETA, error) {
+	a := routing.Point{Lat: from.Latitude, Lng: from.Longitude}
+	b := routing.Point{Lat: to.Latitude, Lng: to.Longitude}
+
+	d, err := s.router.Duration(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ETA{DistanceKm: routing.DistanceKm(s.router, a, b), Duration: d}, nil
+}
+
+func (s *service) GetTrip(ctx context.Context, tripID int) (*Trip, error) {
+	return s.repo.GetTrip(ctx, tripID)
+}
+
+// AdvanceTrip moves the trip to the next lifecycle state if the transition is
+// legal. DRIVER_ASSIGNED is reserved for the matcher since it needs a cab.
+// Once the trip is completed or cancelled the rider's seat in the cab is freed.
+func (s *service) AdvanceTrip(ctx context.Context, tripID int, to TripStatus) (*Trip, error) {
+	trip, err := s.repo.GetTrip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	if to == TripDriverAssigned || !trip.Status.CanTransitionTo(to) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, trip.Status, to)
+	}
 
-func(s *service) publishMessage(rider []byte) error{
-    err := s.mqChannel.Channel.Publish(
-        "",
-        s.mqChannel.QueueName,
-        true,
-        false,
-        amqp.Publishing{
-            ContentType: "text/plain",
-            Body: rider,
-        },
-    )
+	if err := s.transition(ctx, trip, to); err != nil {
+		return nil, err
+	}
 
-    return err
+	return s.repo.GetTrip(ctx, tripID)
 }
 
-func haversineKmToAirport(lat1, lon1 float64) float64 {
-	const R = 6371.0 // Earth radius in km
+// ForceCancelTrip cancels the trip from any state but the terminal ones,
+// for operators. The rider's socket is told and their seat, waiting pool
+// entry and live state are cleared.
+func (s *service) ForceCancelTrip(ctx context.Context, tripID int) (*Trip, error) {
+	trip, err := s.repo.GetTrip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
 
-    lat2 := 23.263567
-    lon2 := 77.363717
-	dLat := (lat2 - lat1) * math.Pi / 180
-	dLon := (lon2 - lon1) * math.Pi / 180
+	if trip.Status.IsTerminal() {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, trip.Status, TripCancelled)
+	}
+
+	// the job may still be queued, the rider is no longer waiting for it
+	if err := s.MarkRiderCancelled(ctx, trip.RiderID); err != nil {
+		s.logger.WarnContext(ctx, "failed to mark rider cancelled", logging.RiderID(trip.RiderID), logging.TripID(tripID), logging.Err(err))
+	}
+
+	if err := s.transition(ctx, trip, TripCancelled); err != nil {
+		return nil, err
+	}
+
+	if trip.CabID == "" {
+		// matched after the trip was read, or not matched at all
+		cabID, err := s.GetAssignedCabIfAny(ctx, trip.RiderID)
+		if err == nil && cabID != "" {
+			_ = s.ReleaseCabSeat(ctx, cabID, trip.RiderID)
+			s.notifyDriverCancellation(ctx, cabID, trip)
+		}
+		if err := s.DeleteRiderRedisKeys(ctx, trip.RiderID); err != nil {
+			s.logger.ErrorContext(ctx, "failed to delete rider state", logging.RiderID(trip.RiderID), logging.TripID(tripID), logging.Err(err))
+		}
+	}
 
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
+	s.logger.WarnContext(ctx, "trip force-cancelled", logging.TripID(tripID), logging.RiderID(trip.RiderID), "from", trip.Status)
+
+	return s.repo.GetTrip(ctx, tripID)
+}
+
+// transition writes the trip's move to status to, tells the rider and
+// updates the cab it rides in
+func (s *service) transition(ctx context.Context, trip *Trip, to TripStatus) error {
+	tripID := trip.TripID
+
+	if err := s.repo.TransitionTrip(ctx, tripID, trip.Status, to); err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "trip advanced",
+		logging.TripID(tripID), logging.RiderID(trip.RiderID), logging.CabID(trip.CabID),
+		"from", trip.Status, "to", to)
+
+	err := s.publisher.PublishRiderEvent(ctx, events.RiderEvent{
+		Type:    events.TypeStatus,
+		RiderID: trip.RiderID,
+		TripID:  tripID,
+		Status:  string(to),
+		CabID:   trip.CabID,
+	})
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to publish trip status", logging.TripID(tripID), "status", to, logging.Err(err))
+	}
+
+	if to == TripInProgress && trip.CabID != "" {
+		// from now on their detour is measured from wherever the cab is
+		if err := s.cabs.MarkPickedUp(ctx, trip.CabID, trip.RiderID); err != nil {
+			s.logger.ErrorContext(ctx, "failed to update route of cab", logging.TripID(tripID), logging.CabID(trip.CabID), logging.Err(err))
+		}
+	}
+
+	if to.IsTerminal() && trip.CabID != "" {
+		if err := s.ReleaseCabSeat(ctx, trip.CabID, trip.RiderID); err != nil {
+			s.logger.ErrorContext(ctx, "failed to release seat", logging.TripID(tripID), logging.CabID(trip.CabID), logging.Err(err))
+		}
+		if err := s.DeleteRiderRedisKeys(ctx, trip.RiderID); err != nil {
+			s.logger.ErrorContext(ctx, "failed to delete rider state", logging.RiderID(trip.RiderID), logging.TripID(tripID), logging.Err(err))
+		}
+		if to == TripCancelled {
+			s.notifyDriverCancellation(ctx, trip.CabID, trip)
+		}
+	}
+
+	return nil
+}
+
+// notifyDriverCancellation tells the driver about a cancelled trip, a
+// failure is only logged since the driver's route is already updated
+func (s *service) notifyDriverCancellation(ctx context.Context, cabID string, trip *Trip) {
+	if err := s.NotifyDriverCancellation(ctx, cabID, trip.RiderID, trip.TripID); err != nil {
+		s.logger.WarnContext(ctx, "failed to notify driver of cancellation", logging.TripID(trip.TripID), logging.CabID(cabID), logging.Err(err))
+	}
+}
+
+// InspectCell returns the riders waiting in the geohash cell and the cabs
+// indexed in it
+func (s *service) InspectCell(ctx context.Context, geohash string) (*Cell, error) {
+	if err := ValidateCell(geohash); err != nil {
+		return nil, err
+	}
+
+	waiting, err := s.locations.WaitingRiders(ctx, geohash)
+	if err != nil {
+		return nil, err
+	}
+
+	cabIDs, err := s.cabs.CabsInCells(ctx, []string{geohash})
+	if err != nil {
+		return nil, err
+	}
+
+	cell := &Cell{Geohash: geohash, WaitingRiders: waiting}
+	for _, id := range cabIDs {
+		cab, err := s.cabs.Cab(ctx, id)
+		if errors.Is(err, ErrCabNotFound) {
+			// went away since the index was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cell.Cabs = append(cell.Cabs, *cab)
+	}
+
+	return cell, nil
+}
+
+// LocateCab returns the live state of the cab, its position included
+func (s *service) LocateCab(ctx context.Context, cabID string) (*CabState, error) {
+	return s.cabs.Cab(ctx, cabID)
+}
+
+func (s *service) OpenSession(ctx context.Context, req Rider) (*Session, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{Token: token, Rider: req, Epoch: 1}
+	if err := s.locations.SaveSession(ctx, *session, SessionTTL); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ResumeSession returns the session with the epoch of the new socket. The
+// sessions of other riders are reported as not found.
+func (s *service) ResumeSession(ctx context.Context, token string, riderID int) (*Session, error) {
+	session, err := s.locations.Session(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if session.Rider.ID != riderID {
+		return nil, ErrSessionNotFound
+	}
+
+	session.Epoch, err = s.locations.AttachSession(ctx, token, SessionTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *service) SessionEpoch(ctx context.Context, token string) (int64, error) {
+	session, err := s.locations.Session(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	return session.Epoch, nil
+}
 
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
+func (s *service) CloseSession(ctx context.Context, token string) error {
+	return s.locations.DeleteSession(ctx, token)
 }
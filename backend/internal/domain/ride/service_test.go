@@ -0,0 +1,160 @@
+package ride_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/database/memory"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/store"
+)
+
+const (
+	testCab  = "cab-1"
+	testCell = "tsp9d2"
+)
+
+// assignedTrip returns a service with one rider in testCab and their trip
+// in DRIVER_ASSIGNED, the way the matcher leaves it
+func assignedTrip(t *testing.T) (ride.Service, *store.Memory, *ride.Trip) {
+	t.Helper()
+	ctx := context.Background()
+
+	cabs := store.NewMemoryStore()
+	repo := memory.NewRideRepository()
+	hub := events.NewLocalHub()
+
+	svc := ride.NewRideService(nil, cabs, cabs, hub, events.NewLocalDriverHub(), repo,
+		ride.Destinations{}, routing.NewHaversineRouter(0), slog.New(slog.DiscardHandler))
+
+	err := cabs.GoOnline(ctx, ride.CabState{ID: testCab, DriverID: 1, Geohash: testCell, Capacity: 4, LuggageCapacity: 2, VehicleClass: ride.VehicleSedan})
+	if err != nil {
+		t.Fatalf("GoOnline: %v", err)
+	}
+
+	tripID, err := repo.CreateTrip(ctx, 7)
+	if err != nil {
+		t.Fatalf("CreateTrip: %v", err)
+	}
+
+	rider := ride.Rider{ID: 7, TripID: tripID, Geohash: testCell, Luggage: 1}
+	if err := cabs.AddRider(ctx, rider); err != nil {
+		t.Fatalf("AddRider: %v", err)
+	}
+
+	cab, _ := cabs.Cab(ctx, testCab)
+	stops := []ride.Stop{
+		{RiderID: rider.ID, TripID: tripID, Kind: ride.StopPickup, Seats: 1, Luggage: 1},
+		{RiderID: rider.ID, TripID: tripID, Kind: ride.StopDrop, Seats: 1, Luggage: 1},
+	}
+	if result, err := cabs.AssignRider(ctx, testCab, rider, cab.StopsVersion, stops); err != nil || result != ride.AssignOK {
+		t.Fatalf("AssignRider = %v, %v", result, err)
+	}
+
+	if err := repo.AssignTripCab(ctx, ride.Trip{TripID: tripID, CabID: testCab}); err != nil {
+		t.Fatalf("AssignTripCab: %v", err)
+	}
+
+	trip, err := repo.GetTrip(ctx, tripID)
+	if err != nil {
+		t.Fatalf("GetTrip: %v", err)
+	}
+
+	return svc, cabs, trip
+}
+
+func TestAdvanceTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		path []ride.TripStatus
+		// seated is whether the rider still holds their seat at the end
+		seated bool
+		stops  int
+	}{
+		{name: "arrived", path: []ride.TripStatus{ride.TripDriverArrived}, seated: true, stops: 2},
+		{name: "picked up", path: []ride.TripStatus{ride.TripDriverArrived, ride.TripInProgress}, seated: true, stops: 1},
+		{name: "completed", path: []ride.TripStatus{ride.TripDriverArrived, ride.TripInProgress, ride.TripCompleted}},
+		{name: "cancelled before pickup", path: []ride.TripStatus{ride.TripCancelled}},
+		{name: "cancelled at pickup", path: []ride.TripStatus{ride.TripDriverArrived, ride.TripCancelled}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc, cabs, trip := assignedTrip(t)
+
+			for _, status := range tt.path {
+				advanced, err := svc.AdvanceTrip(ctx, trip.TripID, status)
+				if err != nil {
+					t.Fatalf("AdvanceTrip(%s): %v", status, err)
+				}
+				if advanced.Status != status {
+					t.Fatalf("status = %s, want %s", advanced.Status, status)
+				}
+			}
+
+			cab, err := cabs.Cab(ctx, testCab)
+			if err != nil {
+				t.Fatalf("Cab: %v", err)
+			}
+			stops, _ := cabs.Stops(ctx, testCab)
+
+			wantPassengers, wantLuggage := 0, 0
+			if tt.seated {
+				wantPassengers, wantLuggage = 1, 1
+			}
+			if cab.PassengerCount != wantPassengers || cab.LuggageCount != wantLuggage {
+				t.Errorf("cab holds %d riders and %d luggage, want %d and %d", cab.PassengerCount, cab.LuggageCount, wantPassengers, wantLuggage)
+			}
+			if len(stops) != tt.stops {
+				t.Errorf("cab has %d stops, want %d", len(stops), tt.stops)
+			}
+
+			_, _, err = cabs.RiderStatus(ctx, trip.RiderID)
+			if tt.seated == errors.Is(err, ride.ErrRiderNotFound) {
+				t.Errorf("RiderStatus err = %v, want live state only while seated", err)
+			}
+		})
+	}
+}
+
+func TestAdvanceTripRejectsForbiddenTransitions(t *testing.T) {
+	tests := []struct {
+		name string
+		path []ride.TripStatus
+		next ride.TripStatus
+	}{
+		{name: "assigned again", next: ride.TripDriverAssigned},
+		{name: "skip arrival", next: ride.TripInProgress},
+		{name: "complete before pickup", next: ride.TripCompleted},
+		{name: "cancel in progress", path: []ride.TripStatus{ride.TripDriverArrived, ride.TripInProgress}, next: ride.TripCancelled},
+		{name: "leave completed", path: []ride.TripStatus{ride.TripDriverArrived, ride.TripInProgress, ride.TripCompleted}, next: ride.TripCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc, cabs, trip := assignedTrip(t)
+
+			for _, status := range tt.path {
+				if _, err := svc.AdvanceTrip(ctx, trip.TripID, status); err != nil {
+					t.Fatalf("AdvanceTrip(%s): %v", status, err)
+				}
+			}
+			before, _ := cabs.Cab(ctx, testCab)
+
+			if _, err := svc.AdvanceTrip(ctx, trip.TripID, tt.next); !errors.Is(err, ride.ErrInvalidTransition) {
+				t.Fatalf("AdvanceTrip(%s) err = %v, want ErrInvalidTransition", tt.next, err)
+			}
+
+			after, _ := cabs.Cab(ctx, testCab)
+			if *after != *before {
+				t.Errorf("cab changed on a rejected transition: %+v, was %+v", after, before)
+			}
+		})
+	}
+}
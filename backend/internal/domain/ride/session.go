@@ -0,0 +1,34 @@
+package ride
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// SessionTTL bounds how long a ride session is kept without being closed,
+// it is refreshed whenever a socket attaches
+const SessionTTL = 12 * time.Hour
+
+var ErrSessionNotFound = errors.New("ride session not found or expired")
+
+// Session keeps a rider's ride request alive across sockets. The rider
+// gets the token with the request and reattaches with it after the socket
+// dropped.
+type Session struct {
+	Token string
+	Rider Rider
+	// Epoch counts the sockets attached so far, the latest one owns the
+	// session and a socket that sees a newer epoch leaves the ride to it
+	Epoch int64
+}
+
+// newSessionToken returns a random, unguessable session token
+func newSessionToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,27 @@
+package ride
+
+// StopKind tells whether the cab picks a rider up or drops them off
+type StopKind string
+
+const (
+	StopPickup StopKind = "PICKUP"
+	StopDrop   StopKind = "DROP"
+)
+
+// Stop is one entry of a cab's ordered route, kept in cab:{id}:stops.
+// A rider whose pickup is no longer listed is on board.
+type Stop struct {
+	RiderID int `json:"rider_id"`
+	// TripID is the rider's trip, drivers advance it at the stop
+	TripID int      `json:"trip_id"`
+	Kind   StopKind `json:"kind"`
+	Lat    float64  `json:"lat"`
+	Lng    float64  `json:"lng"`
+	// Seats and Luggage are taken by the rider between pickup and drop
+	Seats   int `json:"seats"`
+	Luggage int `json:"luggage"`
+	// DirectKm is the rider's own pickup to drop distance
+	DirectKm float64 `json:"direct_km"`
+	// ToleranceKm is the extra distance the rider accepts on top of DirectKm
+	ToleranceKm float64 `json:"tolerance_km"`
+}
@@ -0,0 +1,135 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrRiderNotFound    = errors.New("rider not found")
+	ErrCabNotFound      = errors.New("cab not found")
+	ErrCabOffline       = errors.New("cab is offline")
+	ErrCabHasPassengers = errors.New("cab still has passengers on board")
+)
+
+// Cab statuses as kept by the CabStore
+const (
+	CabAvailable = "AVAILABLE"
+	CabFull      = "FULL"
+	CabOffline   = "OFFLINE"
+)
+
+// AssignResult is the outcome of CabStore.AssignRider
+type AssignResult int
+
+const (
+	// AssignRaceLost means the cab's route changed since the plan was made
+	AssignRaceLost AssignResult = iota
+	AssignOK
+	// AssignFull means the cab has no seat or luggage space left
+	AssignFull
+	// AssignUnavailable means the cab is offline, gone or of another class
+	AssignUnavailable
+	// AssignStale means the rider no longer waits for this ride request:
+	// they cancelled, asked again or were matched already
+	AssignStale
+)
+
+// LocationStore keeps the live state of riders: the rider:{id} hashes and
+// the pool:cell:{geohash}:waiting sets of riders waiting for a cab
+type LocationStore interface {
+	// AddRider stores the rider as PENDING on their trip and adds them to
+	// their cell's waiting pool, offers of an earlier request are forgotten
+	AddRider(ctx context.Context, rider Rider) error
+	// RiderStatus returns ErrRiderNotFound for unknown riders; cabID is empty until matched
+	RiderStatus(ctx context.Context, riderID int) (status string, cabID string, err error)
+	SetRiderStatus(ctx context.Context, riderID int, status string) error
+	RemoveFromWaitingPool(ctx context.Context, riderID int, geohash string) error
+	WaitingCount(ctx context.Context, geohash string) (int64, error)
+	// WaitingRiders returns the ids of the riders in the cell's waiting pool
+	WaitingRiders(ctx context.Context, geohash string) ([]int, error)
+	DeleteRider(ctx context.Context, riderID int) error
+	// CacheFare keeps a quoted fare around for ttl
+	CacheFare(ctx context.Context, key string, amount float64, ttl time.Duration) error
+
+	// SaveSession stores the ride session with epoch 1 for ttl
+	SaveSession(ctx context.Context, session Session, ttl time.Duration) error
+	// Session returns ErrSessionNotFound for unknown or expired tokens
+	Session(ctx context.Context, token string) (*Session, error)
+	// AttachSession bumps the session's epoch, returns the new one and
+	// keeps the session for another ttl
+	AttachSession(ctx context.Context, token string, ttl time.Duration) (int64, error)
+	DeleteSession(ctx context.Context, token string) error
+}
+
+// CabState is the live state of a cab, the cab:{id} hash
+type CabState struct {
+	ID              string
+	DriverID        int
+	Latitude        float64
+	Longitude       float64
+	Geohash         string
+	Status          string
+	PassengerCount  int
+	LuggageCount    int
+	Capacity        int
+	LuggageCapacity int
+	VehicleClass    VehicleClass
+	StopsVersion    int64
+	LastUpdate      int64
+}
+
+// CabStore keeps the live state of cabs: the cab:{id} hashes, their riders
+// and stop lists and the cell:{geohash}:cabs index. Every method that
+// changes more than one key does so atomically.
+type CabStore interface {
+	// CabsInCells returns the ids of all cabs indexed in the given cells
+	CabsInCells(ctx context.Context, cells []string) ([]string, error)
+	// Cab returns ErrCabNotFound for cabs that never went online
+	Cab(ctx context.Context, cabID string) (*CabState, error)
+	Stops(ctx context.Context, cabID string) ([]Stop, error)
+	Riders(ctx context.Context, cabID string) ([]int, error)
+
+	// AssignRider adds the rider to the cab, replaces its stop list and
+	// takes the rider out of their cell's waiting pool. It reports why, without error, if the rider is no longer PENDING on the
+	// request's trip, or the cab is no longer AVAILABLE, of the requested
+	// class, has no room or its stops version moved.
+	AssignRider(ctx context.Context, cabID string, rider Rider, version int64, stops []Stop) (AssignResult, error)
+	// OfferRider reserves the rider's seat and stops like AssignRider, but
+	// the rider stays OFFERED until the driver accepts the offer. The offer
+	// remembers the job it was made from.
+	OfferRider(ctx context.Context, cabID string, rider Rider, version int64, stops []Stop, expiresAt time.Time, job JobRef) (AssignResult, error)
+	// Offer returns the rider's latest offer, ErrOfferNotFound if there is
+	// none since their ride request
+	Offer(ctx context.Context, riderID int) (*Offer, error)
+	// AnswerOffer closes the rider's open offer with the cab. Accepting it
+	// marks the rider MATCHED and takes them out of the waiting pool;
+	// declining or expiring it releases the seat and keeps the cab out of
+	// the rider's matching. Only the call that closes the offer gets it
+	// back, answers to an offer that is no longer open and drivers
+	// answering after the deadline get ErrOfferClosed.
+	AnswerOffer(ctx context.Context, cabID string, riderID int, status OfferStatus, now time.Time) (*Offer, error)
+	// DeclinedCabs returns the cabs that declined or let expire an offer of
+	// the rider since their ride request
+	DeclinedCabs(ctx context.Context, riderID int) ([]string, error)
+	// OfferStats returns how the cab's driver answered its offers
+	OfferStats(ctx context.Context, cabID string) (OfferStats, error)
+	// ReleaseSeat frees the rider's seat and luggage space, drops their
+	// stops and marks an open offer with the cab WITHDRAWN. Releasing a
+	// rider twice is a no-op.
+	ReleaseSeat(ctx context.Context, cabID string, riderID int) error
+	// MarkPickedUp drops the rider's pickup from the stop list
+	MarkPickedUp(ctx context.Context, cabID string, riderID int) error
+
+	// GoOnline puts the cab into its cell. A cab coming back from OFFLINE
+	// starts empty, an online cab only has its position refreshed.
+	GoOnline(ctx context.Context, cab CabState) error
+	// GoOffline returns ErrCabHasPassengers while riders are assigned
+	GoOffline(ctx context.Context, cabID string) error
+	// UpdateLocation moves the cab between cells, ErrCabOffline if it is offline
+	UpdateLocation(ctx context.Context, cabID string, lat, lng float64, geohash string, now time.Time) error
+
+	// CountByStatus walks every cab, it is meant for periodic metrics
+	CountByStatus(ctx context.Context) (map[string]int, error)
+}
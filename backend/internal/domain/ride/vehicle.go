@@ -0,0 +1,69 @@
+package ride
+
+import (
+	"errors"
+	"sort"
+)
+
+// VehicleClass is the kind of cab a driver operates or a rider asks for
+type VehicleClass string
+
+const (
+	VehicleHatchback VehicleClass = "hatchback"
+	VehicleSedan     VehicleClass = "sedan"
+	VehicleSUV       VehicleClass = "suv"
+	VehicleVan       VehicleClass = "van"
+)
+
+// DefaultVehicleClass is used for drivers registered without a class
+const DefaultVehicleClass = VehicleSedan
+
+var ErrUnknownVehicleClass = errors.New("unknown vehicle class")
+
+// VehicleSpec holds the limits and pricing of a vehicle class. Seats and
+// luggage space are separate: a bag never takes a passenger seat.
+type VehicleSpec struct {
+	Class          VehicleClass
+	Seats          int
+	Luggage        int
+	FareMultiplier float64
+}
+
+var vehicleSpecs = map[VehicleClass]VehicleSpec{
+	VehicleHatchback: {Class: VehicleHatchback, Seats: 4, Luggage: 1, FareMultiplier: 0.9},
+	VehicleSedan:     {Class: VehicleSedan, Seats: 4, Luggage: 2, FareMultiplier: 1.0},
+	VehicleSUV:       {Class: VehicleSUV, Seats: 6, Luggage: 4, FareMultiplier: 1.3},
+	VehicleVan:       {Class: VehicleVan, Seats: 8, Luggage: 6, FareMultiplier: 1.6},
+}
+
+// LookupVehicleClass returns the spec of a class, the default class for an
+// empty name
+func LookupVehicleClass(name string) (VehicleSpec, error) {
+	if name == "" {
+		return vehicleSpecs[DefaultVehicleClass], nil
+	}
+
+	spec, ok := vehicleSpecs[VehicleClass(name)]
+	if !ok {
+		return VehicleSpec{}, ErrUnknownVehicleClass
+	}
+
+	return spec, nil
+}
+
+// VehicleClasses lists every class from the smallest to the largest
+func VehicleClasses() []VehicleSpec {
+	out := make([]VehicleSpec, 0, len(vehicleSpecs))
+	for _, spec := range vehicleSpecs {
+		out = append(out, spec)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Seats != out[j].Seats {
+			return out[i].Seats < out[j].Seats
+		}
+		return out[i].Luggage < out[j].Luggage
+	})
+
+	return out
+}
@@ -0,0 +1,15 @@
+package rider
+
+import "time"
+
+// Rider is a rider account. Trips, and later ratings and payments, hang
+// off its ID.
+type Rider struct {
+	ID    int
+	Name  string
+	Email string
+	Phone string
+	// PasswordHash is the bcrypt hash of the rider's password
+	PasswordHash string
+	CreatedAt    time.Time
+}
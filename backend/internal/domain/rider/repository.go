@@ -0,0 +1,17 @@
+package rider
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrRiderNotFound = errors.New("rider not found")
+	ErrRiderExists   = errors.New("rider with this email or phone already exists")
+)
+
+type Repository interface {
+	CreateRider(ctx context.Context, r Rider) (*Rider, error)
+	GetRiderByEmail(ctx context.Context, email string) (*Rider, error)
+	GetRiderByID(ctx context.Context, id int) (*Rider, error)
+}
@@ -0,0 +1,89 @@
+package rider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password Signup accepts
+const MinPasswordLength = 8
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+type Service interface {
+	Signup(ctx context.Context, r Rider, password string) (*Rider, error)
+	Login(ctx context.Context, email, password string) (*Rider, error)
+	GetRider(ctx context.Context, id int) (*Rider, error)
+}
+
+type service struct {
+	repo   Repository
+	logger *slog.Logger
+}
+
+// NewRiderService function initialises a new rider service
+func NewRiderService(repo Repository, logger *slog.Logger) Service {
+	return &service{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Signup creates a rider account. Emails are compared case-insensitively.
+func (s *service) Signup(ctx context.Context, r Rider, password string) (*Rider, error) {
+	if len(password) < MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Email = normalizeEmail(r.Email)
+	r.PasswordHash = string(hash)
+
+	created, err := s.repo.CreateRider(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "rider signed up", logging.RiderID(created.ID))
+
+	return created, nil
+}
+
+// Login returns the rider the email and password belong to. Unknown emails
+// and wrong passwords fail alike.
+func (s *service) Login(ctx context.Context, email, password string) (*Rider, error) {
+	r, err := s.repo.GetRiderByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrRiderNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(r.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return r, nil
+}
+
+func (s *service) GetRider(ctx context.Context, id int) (*Rider, error) {
+	return s.repo.GetRiderByID(ctx, id)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
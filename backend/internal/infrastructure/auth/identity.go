@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+)
+
+// Role is what an identity is allowed to do
+type Role string
+
+const (
+	RoleRider  Role = "rider"
+	RoleDriver Role = "driver"
+	// RoleAdmin is an operator of the system
+	RoleAdmin Role = "admin"
+)
+
+// adminSubject is the token subject of the operator identity
+const adminSubject = "admin"
+
+// Identity is who a request was authenticated as. RiderID is set for
+// riders, DriverID and CabID for drivers.
+type Identity struct {
+	Role     Role
+	RiderID  int
+	DriverID int
+	CabID    string
+}
+
+// Rider returns the identity of a rider
+func Rider(riderID int) Identity {
+	return Identity{Role: RoleRider, RiderID: riderID}
+}
+
+// Driver returns the identity of a driver operating the cab
+func Driver(driverID int, cabID string) Identity {
+	return Identity{Role: RoleDriver, DriverID: driverID, CabID: cabID}
+}
+
+// Admin returns the operator identity
+func Admin() Identity {
+	return Identity{Role: RoleAdmin}
+}
+
+// Subject is the token subject naming the identity
+func (i Identity) Subject() string {
+	switch i.Role {
+	case RoleDriver:
+		return strconv.Itoa(i.DriverID)
+	case RoleAdmin:
+		return adminSubject
+	default:
+		return strconv.Itoa(i.RiderID)
+	}
+}
+
+// Is reports whether the identity has one of the roles
+func (i Identity) Is(roles ...Role) bool {
+	for _, r := range roles {
+		if i.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnsCab reports whether the identity may act for the cab, operators may
+// act for every cab
+func (i Identity) OwnsCab(cabID string) bool {
+	switch i.Role {
+	case RoleAdmin:
+		return true
+	case RoleDriver:
+		return cabID != "" && i.CabID == cabID
+	default:
+		return false
+	}
+}
+
+// IdentityFromClaims returns the identity the token's claims name. Tokens
+// issued before roles existed carry no role and name a rider.
+func IdentityFromClaims(c Claims) (Identity, error) {
+	switch Role(c.Role) {
+	case RoleAdmin:
+		if c.Subject != adminSubject {
+			return Identity{}, ErrInvalidToken
+		}
+		return Admin(), nil
+
+	case RoleDriver:
+		id, err := strconv.Atoi(c.Subject)
+		if err != nil || id <= 0 || c.CabID == "" {
+			return Identity{}, ErrInvalidToken
+		}
+		return Driver(id, c.CabID), nil
+
+	case RoleRider, "":
+		id, err := strconv.Atoi(c.Subject)
+		if err != nil || id <= 0 {
+			return Identity{}, ErrInvalidToken
+		}
+		return Rider(id), nil
+
+	default:
+		return Identity{}, ErrInvalidToken
+	}
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying the identity
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the identity carried by ctx, false if the request
+// was not authenticated
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,103 @@
+// Package auth issues and verifies the access tokens clients send as
+// bearer tokens, and carries the authenticated identity in the request
+// context.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrTokenExpired = errors.New("access token expired")
+)
+
+// Claims are the claims of an access token
+type Claims struct {
+	Subject string `json:"sub"`
+	Role    string `json:"role,omitempty"`
+	// CabID is the cab a driver token may act for
+	CabID     string `json:"cab_id,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// jwtHeader is the only header Tokens issues and accepts
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Tokens issues and verifies HS256 signed JWTs
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokens function initialises a token issuer signing with secret,
+// tokens are valid for ttl
+func NewTokens(secret []byte, ttl time.Duration) *Tokens {
+	return &Tokens{
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// Issue returns a token naming the identity and when it expires
+func (t *Tokens) Issue(id Identity) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.ttl)
+
+	payload, err := json.Marshal(Claims{
+		Subject:   id.Subject(),
+		Role:      string(id.Role),
+		CabID:     id.CabID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return unsigned + "." + t.sign(unsigned), expiresAt, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims
+func (t *Tokens) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Claims{}, ErrInvalidToken
+	}
+
+	unsigned := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(unsigned))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+func (t *Tokens) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+)
+
+type driverRepository struct {
+	mu      sync.Mutex
+	drivers map[string]driver.Driver // by cab id
+	nextID  int
+}
+
+// NewDriverRepository keeps drivers in process, for tests and local development
+func NewDriverRepository() driver.Repository {
+	return &driverRepository{
+		drivers: make(map[string]driver.Driver),
+	}
+}
+
+func (r *driverRepository) CreateDriver(ctx context.Context, d driver.Driver) (*driver.Driver, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// same unique constraints as driver_schema.driver
+	for _, existing := range r.drivers {
+		if existing.Phone == d.Phone || existing.VehicleNumber == d.VehicleNumber || existing.CabID == d.CabID {
+			return nil, driver.ErrDriverExists
+		}
+	}
+
+	r.nextID++
+	d.ID = r.nextID
+	d.CreatedAt = time.Now()
+	r.drivers[d.CabID] = d
+
+	return &d, nil
+}
+
+func (r *driverRepository) GetDriverByCabID(ctx context.Context, cabID string) (*driver.Driver, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.drivers[cabID]
+	if !ok {
+		return nil, driver.ErrDriverNotFound
+	}
+
+	return &d, nil
+}
+
+func (r *driverRepository) GetDriverByPhone(ctx context.Context, phone string) (*driver.Driver, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.drivers {
+		if d.Phone == phone {
+			return &d, nil
+		}
+	}
+
+	return nil, driver.ErrDriverNotFound
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+type rideRepository struct {
+	mu     sync.Mutex
+	trips  map[int]*ride.Trip
+	nextID int
+}
+
+// NewRideRepository keeps trips in process, for tests and local development
+func NewRideRepository() ride.Repository {
+	return &rideRepository{
+		trips: make(map[int]*ride.Trip),
+	}
+}
+
+func (r *rideRepository) CreateTrip(ctx context.Context, riderID int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	now := time.Now()
+
+	r.trips[r.nextID] = &ride.Trip{
+		TripID:    r.nextID,
+		RiderID:   riderID,
+		Status:    ride.TripCreated,
+		CreatedAt: now,
+		Events:    []ride.TripEvent{{To: ride.TripCreated, At: now}},
+	}
+
+	return r.nextID, nil
+}
+
+func (r *rideRepository) GetTrip(ctx context.Context, tripID int) (*ride.Trip, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.trips[tripID]
+	if !ok {
+		return nil, ride.ErrTripNotFound
+	}
+
+	trip := *t
+	trip.Events = append([]ride.TripEvent(nil), t.Events...)
+
+	return &trip, nil
+}
+
+func (r *rideRepository) AssignTripCab(ctx context.Context, trip ride.Trip) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.trips[trip.TripID]
+	if !ok || t.Status != ride.TripCreated {
+		return ride.ErrTripConflict
+	}
+
+	t.CabID = trip.CabID
+	t.PickupLat, t.PickupLng = trip.PickupLat, trip.PickupLng
+	t.DropLat, t.DropLng = trip.DropLat, trip.DropLng
+	t.Status = ride.TripDriverAssigned
+	t.Events = append(t.Events, ride.TripEvent{From: ride.TripCreated, To: ride.TripDriverAssigned, At: time.Now()})
+
+	return nil
+}
+
+func (r *rideRepository) TransitionTrip(ctx context.Context, tripID int, from, to ride.TripStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.trips[tripID]
+	if !ok || t.Status != from {
+		return ride.ErrTripConflict
+	}
+
+	now := time.Now()
+
+	t.Status = to
+	if to == ride.TripInProgress {
+		t.StartedAt = &now
+	}
+	if to.IsTerminal() {
+		t.CompletedAt = &now
+	}
+	t.Events = append(t.Events, ride.TripEvent{From: from, To: to, At: now})
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/rider"
+)
+
+type riderRepository struct {
+	mu     sync.Mutex
+	riders map[int]rider.Rider
+	nextID int
+}
+
+// NewRiderRepository keeps rider accounts in process, for tests and local development
+func NewRiderRepository() rider.Repository {
+	return &riderRepository{
+		riders: make(map[int]rider.Rider),
+	}
+}
+
+func (r *riderRepository) CreateRider(ctx context.Context, rd rider.Rider) (*rider.Rider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// same unique constraints as rider_schema.rider
+	for _, existing := range r.riders {
+		if existing.Email == rd.Email || existing.Phone == rd.Phone {
+			return nil, rider.ErrRiderExists
+		}
+	}
+
+	r.nextID++
+	rd.ID = r.nextID
+	rd.CreatedAt = time.Now()
+	r.riders[rd.ID] = rd
+
+	return &rd, nil
+}
+
+func (r *riderRepository) GetRiderByEmail(ctx context.Context, email string) (*rider.Rider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rd := range r.riders {
+		if rd.Email == email {
+			return &rd, nil
+		}
+	}
+
+	return nil, rider.ErrRiderNotFound
+}
+
+func (r *riderRepository) GetRiderByID(ctx context.Context, id int) (*rider.Rider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rd, ok := r.riders[id]
+	if !ok {
+		return nil, rider.ErrRiderNotFound
+	}
+
+	return &rd, nil
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+)
+
+// pgUniqueViolation is the Postgres error code for unique constraint violations
+const pgUniqueViolation = "23505"
+
+type driverRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewDriverRepository(pool *pgxpool.Pool) driver.Repository {
+	return &driverRepository{
+		pool: pool,
+	}
+}
+
+func (r *driverRepository) CreateDriver(ctx context.Context, d driver.Driver) (*driver.Driver, error) {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO driver_schema.driver (cab_id, name, phone, vehicle_number, vehicle_class, capacity, password_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`,
+		d.CabID,
+		d.Name,
+		d.Phone,
+		d.VehicleNumber,
+		string(d.VehicleClass),
+		d.Capacity,
+		d.PasswordHash,
+	).Scan(&d.ID, &d.CreatedAt)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return nil, driver.ErrDriverExists
+		}
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (r *driverRepository) GetDriverByCabID(ctx context.Context, cabID string) (*driver.Driver, error) {
+	return r.getDriver(ctx, `
+		SELECT id, cab_id, name, phone, vehicle_number, vehicle_class, capacity, COALESCE(password_hash, ''), created_at
+		FROM driver_schema.driver
+		WHERE cab_id = $1
+	`, cabID)
+}
+
+func (r *driverRepository) GetDriverByPhone(ctx context.Context, phone string) (*driver.Driver, error) {
+	return r.getDriver(ctx, `
+		SELECT id, cab_id, name, phone, vehicle_number, vehicle_class, capacity, COALESCE(password_hash, ''), created_at
+		FROM driver_schema.driver
+		WHERE phone = $1
+	`, phone)
+}
+
+func (r *driverRepository) getDriver(ctx context.Context, query string, arg any) (*driver.Driver, error) {
+	var d driver.Driver
+
+	err := r.pool.QueryRow(ctx, query, arg).Scan(
+		&d.ID,
+		&d.CabID,
+		&d.Name,
+		&d.Phone,
+		&d.VehicleNumber,
+		&d.VehicleClass,
+		&d.Capacity,
+		&d.PasswordHash,
+		&d.CreatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, driver.ErrDriverNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
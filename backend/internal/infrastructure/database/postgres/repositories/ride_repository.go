@@ -2,9 +2,12 @@ package repositories
 
 import (
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
 )
 
 type repository struct {
@@ -17,48 +20,213 @@ func NewRideRepository(pool *pgxpool.Pool) ride.Repository{
     }
 }
 
-func(r *repository) GetRiderandTripID(ctx context.Context) (int, int, error){
+// CreateTrip opens a CREATED trip for the rider
+func(r *repository) CreateTrip(ctx context.Context, riderID int) (int, error){
+	ctx, span := startTx(ctx, "CreateTrip")
+	defer span.End()
+
     tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return 0, 0, err
+		tracing.RecordError(span, err)
+		return 0, err
 	}
 	defer func() {
 		if err != nil {
 			_ = tx.Rollback(ctx)
+			tracing.RecordError(span, err)
 		}
 	}()
 
 	var tripID int
-	var riderTripID int
 
 	err = tx.QueryRow(ctx, `
-		INSERT INTO rider_schema.trip (cab_id, status, pickup_lat, pickup_lng, drop_lat, drop_lng)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO rider_schema.trip (cab_id, status, pickup_lat, pickup_lng, drop_lat, drop_lng, rider_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id
 	`,
 		"",           
 		"CREATED",     
 		0.0, 0.0,      
 		0.0, 0.0,      
+		riderID,
 	).Scan(&tripID)
 
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
 
-	err = tx.QueryRow(ctx, `
+	err = recordTripEvent(ctx, tx, tripID, "", ride.TripCreated)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
 		INSERT INTO rider_schema.rider_trip (trip_id)
 		VALUES ($1)
-		RETURNING id
-	`, tripID).Scan(&riderTripID)
+	`, tripID)
 
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return 0, 0, err
+		return 0, err
 	}
 
-	return tripID, riderTripID, nil
-}
\ No newline at end of file
+	return tripID, nil
+}
+
+func (r *repository) GetTrip(ctx context.Context, tripID int) (*ride.Trip, error) {
+	var t ride.Trip
+	var riderID *int
+
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, rider_id, cab_id, status, pickup_lat, pickup_lng, drop_lat, drop_lng,
+		       created_at, started_at, completed_at
+		FROM rider_schema.trip
+		WHERE id = $1
+	`, tripID).Scan(
+		&t.TripID,
+		&riderID,
+		&t.CabID,
+		&t.Status,
+		&t.PickupLat,
+		&t.PickupLng,
+		&t.DropLat,
+		&t.DropLng,
+		&t.CreatedAt,
+		&t.StartedAt,
+		&t.CompletedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ride.ErrTripNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if riderID != nil {
+		t.RiderID = *riderID
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT from_status, to_status, created_at
+		FROM rider_schema.trip_event
+		WHERE trip_id = $1
+		ORDER BY id
+	`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e ride.TripEvent
+		if err := rows.Scan(&e.From, &e.To, &e.At); err != nil {
+			return nil, err
+		}
+		t.Events = append(t.Events, e)
+	}
+
+	return &t, rows.Err()
+}
+
+func (r *repository) AssignTripCab(ctx context.Context, trip ride.Trip) error {
+	ctx, span := startTx(ctx, "AssignTripCab")
+	defer span.End()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			tracing.RecordError(span, err)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE rider_schema.trip
+		SET cab_id = $2, status = $3,
+		    pickup_lat = $4, pickup_lng = $5,
+		    drop_lat = $6, drop_lng = $7
+		WHERE id = $1 AND status = $8
+	`,
+		trip.TripID,
+		trip.CabID,
+		ride.TripDriverAssigned,
+		trip.PickupLat, trip.PickupLng,
+		trip.DropLat, trip.DropLng,
+		ride.TripCreated,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		err = ride.ErrTripConflict
+		return err
+	}
+
+	err = recordTripEvent(ctx, tx, trip.TripID, ride.TripCreated, ride.TripDriverAssigned)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	return err
+}
+
+func (r *repository) TransitionTrip(ctx context.Context, tripID int, from, to ride.TripStatus) error {
+	ctx, span := startTx(ctx, "TransitionTrip")
+	defer span.End()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			tracing.RecordError(span, err)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE rider_schema.trip
+		SET status = $3,
+		    started_at = CASE WHEN $3 = 'IN_PROGRESS' THEN now() ELSE started_at END,
+		    completed_at = CASE WHEN $3 IN ('COMPLETED', 'CANCELLED') THEN now() ELSE completed_at END
+		WHERE id = $1 AND status = $2
+	`, tripID, from, to)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		err = ride.ErrTripConflict
+		return err
+	}
+
+	err = recordTripEvent(ctx, tx, tripID, from, to)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	return err
+}
+
+// recordTripEvent appends a transition to the trip's audit trail
+func recordTripEvent(ctx context.Context, tx pgx.Tx, tripID int, from, to ride.TripStatus) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO rider_schema.trip_event (trip_id, from_status, to_status)
+		VALUES ($1, $2, $3)
+	`, tripID, from, to)
+
+	return err
+}
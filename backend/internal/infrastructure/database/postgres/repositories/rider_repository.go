@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/rider"
+)
+
+type riderRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRiderRepository(pool *pgxpool.Pool) rider.Repository {
+	return &riderRepository{
+		pool: pool,
+	}
+}
+
+func (r *riderRepository) CreateRider(ctx context.Context, rd rider.Rider) (*rider.Rider, error) {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO rider_schema.rider (name, email, phone, password_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`,
+		rd.Name,
+		rd.Email,
+		rd.Phone,
+		rd.PasswordHash,
+	).Scan(&rd.ID, &rd.CreatedAt)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return nil, rider.ErrRiderExists
+		}
+		return nil, err
+	}
+
+	return &rd, nil
+}
+
+func (r *riderRepository) GetRiderByEmail(ctx context.Context, email string) (*rider.Rider, error) {
+	return r.getRider(ctx, `
+		SELECT id, name, email, phone, password_hash, created_at
+		FROM rider_schema.rider
+		WHERE email = $1
+	`, email)
+}
+
+func (r *riderRepository) GetRiderByID(ctx context.Context, id int) (*rider.Rider, error) {
+	return r.getRider(ctx, `
+		SELECT id, name, email, phone, password_hash, created_at
+		FROM rider_schema.rider
+		WHERE id = $1
+	`, id)
+}
+
+func (r *riderRepository) getRider(ctx context.Context, query string, arg any) (*rider.Rider, error) {
+	var rd rider.Rider
+
+	err := r.pool.QueryRow(ctx, query, arg).Scan(
+		&rd.ID,
+		&rd.Name,
+		&rd.Email,
+		&rd.Phone,
+		&rd.PasswordHash,
+		&rd.CreatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, rider.ErrRiderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &rd, nil
+}
@@ -0,0 +1,18 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startTx starts the span of a transaction, named after the repository
+// method running it
+func startTx(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "postgres.tx "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(name)),
+	)
+}
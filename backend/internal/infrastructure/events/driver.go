@@ -0,0 +1,171 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+)
+
+// Driver event types
+const (
+	// TypeAssigned is a rider added to the cab's route
+	TypeAssigned = "ASSIGNED"
+	// TypeRiderCancelled is a rider of the cab who gave up their trip
+	TypeRiderCancelled = "RIDER_CANCELLED"
+	// TypePoolFull is sent once the cab has no seat left
+	TypePoolFull = "POOL_FULL"
+	// TypeOffered is a rider the driver may accept until ExpiresAt
+	TypeOffered = "OFFER"
+	// TypeOfferExpired is an offer the driver did not answer in time
+	TypeOfferExpired = "OFFER_EXPIRED"
+)
+
+// DriverBinding matches the routing key of every cab, see DriverRoutingKey
+const DriverBinding = "cab.*"
+
+// DriverEvent is published whenever the route or load of a cab changes
+type DriverEvent struct {
+	Type           string `json:"type"`
+	CabID          string `json:"cab_id"`
+	RiderID        int    `json:"rider_id,omitempty"`
+	TripID         int    `json:"trip_id,omitempty"`
+	PassengerCount int    `json:"passenger_count,omitempty"`
+	Capacity       int    `json:"capacity,omitempty"`
+	// ExpiresAt is the deadline of an offer, unix seconds
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	At        int64 `json:"at"`
+}
+
+// DriverRoutingKey returns the routing key of a cab's events
+func DriverRoutingKey(cabID string) string {
+	return "cab." + cabID
+}
+
+// DriverPublisher delivers driver events to the API process holding the
+// driver's socket
+type DriverPublisher interface {
+	PublishDriverEvent(ctx context.Context, e DriverEvent) error
+}
+
+// DriverTopic is the exchange driver events travel through, every API
+// process receives all of them
+type DriverTopic interface {
+	Publish(ctx context.Context, key string, body []byte) error
+	Messages() <-chan []byte
+}
+
+// DriverHub fans the driver events received from the topic out to the
+// driver sockets of this process. A hub without a topic is itself the
+// transport for a single process.
+type DriverHub struct {
+	topic DriverTopic
+
+	mu   sync.RWMutex
+	subs map[string]map[chan DriverEvent]struct{}
+}
+
+// NewDriverHub function initialises a driver hub publishing on and
+// consuming from the topic
+func NewDriverHub(topic DriverTopic) *DriverHub {
+	return &DriverHub{
+		topic: topic,
+		subs:  make(map[string]map[chan DriverEvent]struct{}),
+	}
+}
+
+// NewLocalDriverHub returns a driver hub for a single process, events
+// published on it are dispatched directly
+func NewLocalDriverHub() *DriverHub {
+	return NewDriverHub(nil)
+}
+
+// PublishDriverEvent publishes the event under the cab's routing key.
+// Delivery is best effort: drivers that are not connected miss the event
+// and read their cab's route instead.
+func (h *DriverHub) PublishDriverEvent(ctx context.Context, e DriverEvent) error {
+	stampDriver(&e)
+
+	if h.topic == nil {
+		h.dispatch(e)
+		return nil
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return h.topic.Publish(ctx, DriverRoutingKey(e.CabID), body)
+}
+
+// Run consumes driver events until ctx is cancelled
+func (h *DriverHub) Run(ctx context.Context) {
+	if h.topic == nil {
+		<-ctx.Done()
+		return
+	}
+
+	messages := h.topic.Messages()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body := <-messages:
+			var e DriverEvent
+			if err := json.Unmarshal(body, &e); err != nil {
+				slog.Warn("Driver hub dropped malformed event", logging.Err(err))
+				continue
+			}
+
+			h.dispatch(e)
+		}
+	}
+}
+
+// Subscribe registers interest in a cab's events. The returned function
+// must be called to unsubscribe once the caller stops reading.
+func (h *DriverHub) Subscribe(cabID string) (<-chan DriverEvent, func()) {
+	ch := make(chan DriverEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[cabID] == nil {
+		h.subs[cabID] = make(map[chan DriverEvent]struct{})
+	}
+	h.subs[cabID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[cabID], ch)
+		if len(h.subs[cabID]) == 0 {
+			delete(h.subs, cabID)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+func (h *DriverHub) dispatch(e DriverEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subs[e.CabID] {
+		select {
+		case ch <- e:
+		default:
+			slog.Warn("Driver hub dropped event for slow driver", "type", e.Type, logging.CabID(e.CabID))
+		}
+	}
+}
+
+func stampDriver(e *DriverEvent) {
+	if e.At == 0 {
+		e.At = time.Now().Unix()
+	}
+}
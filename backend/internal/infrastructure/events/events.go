@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Rider event types
+const (
+	// TypeStatus is a change of the rider's matching or trip status
+	TypeStatus = "STATUS"
+	// TypeCabLocation is a location ping of the cab the rider is assigned to
+	TypeCabLocation = "CAB_LOCATION"
+)
+
+// StatusNoCab is the status of a rider no cab took in time, their trip is
+// cancelled
+const StatusNoCab = "NO_CAB"
+
+// riderChannelPattern matches every per-rider channel, see RiderChannel
+const riderChannelPattern = "rider:*:events"
+
+// RiderEvent is published whenever something the rider is waiting on changes
+type RiderEvent struct {
+	Type    string  `json:"type"`
+	RiderID int     `json:"rider_id"`
+	Status  string  `json:"status,omitempty"`
+	CabID   string  `json:"cab_id,omitempty"`
+	TripID  int     `json:"trip_id,omitempty"`
+	Lat     float64 `json:"lat,omitempty"`
+	Lng     float64 `json:"lng,omitempty"`
+	At      int64   `json:"at"`
+}
+
+// RiderChannel returns the pub/sub channel for a rider's events
+func RiderChannel(riderID int) string {
+	return fmt.Sprintf("rider:%d:events", riderID)
+}
+
+// Publisher delivers rider events to the API process holding the rider's socket
+type Publisher interface {
+	PublishRiderEvent(ctx context.Context, e RiderEvent) error
+}
+
+type redisPublisher struct {
+	redisClient *redis.Client
+}
+
+// NewRedisPublisher publishes rider events on Redis pub/sub, where the Hub
+// of every API process picks them up
+func NewRedisPublisher(redisClient *redis.Client) Publisher {
+	return &redisPublisher{redisClient: redisClient}
+}
+
+// PublishRiderEvent publishes the event on the rider's channel.
+// Delivery is best effort: subscribers that are not connected miss the
+// event and rely on polling the rider:{id} hash instead.
+func (p *redisPublisher) PublishRiderEvent(ctx context.Context, e RiderEvent) error {
+	stamp(&e)
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return p.redisClient.Publish(ctx, RiderChannel(e.RiderID), body).Err()
+}
+
+func stamp(e *RiderEvent) {
+	if e.At == 0 {
+		e.At = time.Now().Unix()
+	}
+}
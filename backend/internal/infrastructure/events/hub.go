@@ -0,0 +1,120 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// subscriberBuffer is how many events a slow subscriber may lag behind
+// before further events for it are dropped
+const subscriberBuffer = 16
+
+// Hub holds a single pattern subscription on Redis for the whole API process
+// and fans rider events out to the WebSocket handlers waiting on them.
+// A hub without Redis is itself the Publisher for a single process.
+type Hub struct {
+	redisClient *redis.Client
+
+	mu   sync.RWMutex
+	subs map[int]map[chan RiderEvent]struct{}
+}
+
+// NewHub function initialises a new event hub
+func NewHub(redisClient *redis.Client) *Hub {
+	return &Hub{
+		redisClient: redisClient,
+		subs:        make(map[int]map[chan RiderEvent]struct{}),
+	}
+}
+
+// NewLocalHub returns a hub for a single process, events published on it
+// are dispatched directly
+func NewLocalHub() *Hub {
+	return &Hub{
+		subs: make(map[int]map[chan RiderEvent]struct{}),
+	}
+}
+
+// PublishRiderEvent hands the event straight to this process's subscribers
+func (h *Hub) PublishRiderEvent(ctx context.Context, e RiderEvent) error {
+	stamp(&e)
+	h.dispatch(e)
+	return nil
+}
+
+// Run consumes rider events until ctx is cancelled
+func (h *Hub) Run(ctx context.Context) {
+	if h.redisClient == nil {
+		<-ctx.Done()
+		return
+	}
+
+	ps := h.redisClient.PSubscribe(ctx, riderChannelPattern)
+	defer ps.Close()
+
+	slog.Info("Event hub subscribed", "pattern", riderChannelPattern)
+
+	ch := ps.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				slog.Warn("Event hub subscription closed")
+				return
+			}
+
+			var e RiderEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				slog.Warn("Event hub dropped malformed event", "channel", msg.Channel, logging.Err(err))
+				continue
+			}
+
+			h.dispatch(e)
+		}
+	}
+}
+
+// Subscribe registers interest in a rider's events. The returned function
+// must be called to unsubscribe once the caller stops reading.
+func (h *Hub) Subscribe(riderID int) (<-chan RiderEvent, func()) {
+	ch := make(chan RiderEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[riderID] == nil {
+		h.subs[riderID] = make(map[chan RiderEvent]struct{})
+	}
+	h.subs[riderID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[riderID], ch)
+		if len(h.subs[riderID]) == 0 {
+			delete(h.subs, riderID)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+func (h *Hub) dispatch(e RiderEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subs[e.RiderID] {
+		select {
+		case ch <- e:
+		default:
+			slog.Warn("Event hub dropped event for slow rider", "type", e.Type, logging.RiderID(e.RiderID))
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package logging builds the structured logger handed to the handlers,
+// services, queue and workers. Records logged with a context pick up the
+// request ID and the trace and span IDs stored in it, so a ride request can
+// be followed from the HTTP request into the worker that matched it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys shared by every package
+const (
+	KeyRequestID = "request_id"
+	KeyRiderID   = "rider_id"
+	KeyCabID     = "cab_id"
+	KeyTripID    = "trip_id"
+	KeyTraceID   = "trace_id"
+	KeySpanID    = "span_id"
+	KeyError     = "error"
+)
+
+// Formats New accepts
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New returns a logger writing records of at least level ("debug", "info",
+// "warn" or "error") to w in the given format
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON, "":
+		h = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(contextHandler{h}), nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RiderID is the rider_id attribute
+func RiderID(id int) slog.Attr {
+	return slog.Int(KeyRiderID, id)
+}
+
+// CabID is the cab_id attribute
+func CabID(id string) slog.Attr {
+	return slog.String(KeyCabID, id)
+}
+
+// TripID is the trip_id attribute
+func TripID(id int) slog.Attr {
+	return slog.Int(KeyTripID, id)
+}
+
+// Err is the error attribute
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// contextHandler adds the request, trace and span IDs found in the
+// record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyRequestID, id))
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String(KeyTraceID, sc.TraceID().String()),
+			slog.String(KeySpanID, sc.SpanID().String()),
+		)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
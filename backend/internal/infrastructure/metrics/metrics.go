@@ -0,0 +1,135 @@
+// Package metrics holds the Prometheus collectors of the API, the worker
+// pool and the job queue. Everything registers with the default registry
+// served on /metrics.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes of an assignment attempt, see ride.AssignResult
+const (
+	OutcomeAssigned    = "assigned"
+	OutcomeRaceLost    = "race_lost"
+	OutcomeFull        = "full"
+	OutcomeUnavailable = "unavailable"
+	OutcomeStale       = "stale"
+)
+
+var (
+	// HTTPRequestDuration is labelled with the gin route, not the raw path,
+	// to keep the label set bounded
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests per route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	WebSocketsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "websockets_active",
+		Help: "Open WebSocket connections.",
+	}, []string{"kind"})
+
+	MatchLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ride_match_latency_seconds",
+		Help:    "Time from publishing a ride request to the rider being MATCHED.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60, 120},
+	})
+
+	WorkerBusySeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_busy_seconds_total",
+		Help: "Time each matching worker spent on jobs.",
+	}, []string{"worker"})
+
+	WorkerIdleSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_idle_seconds_total",
+		Help: "Time each matching worker waited on the pool's worker channel.",
+	}, []string{"worker"})
+
+	WorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "workers_busy",
+		Help: "Matching workers currently processing a job.",
+	})
+
+	QueueDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "queue_deliveries_total",
+		Help: "Jobs taken off the work queue, by whether the broker redelivered them.",
+	}, []string{"redelivered"})
+
+	QueueRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "queue_retries_total",
+		Help: "Jobs scheduled for another attempt after a failure.",
+	})
+
+	QueueDeadLetters = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "queue_dead_letters_total",
+		Help: "Jobs moved to the dead-letter queue.",
+	})
+
+	AssignAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "match_assign_attempts_total",
+		Help: "Attempts to place a rider in an existing cab, by outcome.",
+	}, []string{"outcome"})
+
+	NoCab = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "match_no_cab_total",
+		Help: "Trips cancelled because no cab took the rider in time.",
+	})
+
+	OfferAnswers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "match_offer_answers_total",
+		Help: "Offers of riders to drivers, by how they ended: accepted, declined, expired or withdrawn.",
+	}, []string{"answer"})
+
+	Cabs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cabs",
+		Help: "Cabs known to the cab store, by status.",
+	}, []string{"status"})
+)
+
+// WatchQueueDepth exposes the number of jobs waiting in the work queue. It
+// is read on every scrape.
+func WatchQueueDepth(depth func() (int, error)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "queue_depth",
+		Help: "Jobs waiting in the work queue.",
+	}, func() float64 {
+		n, err := depth()
+		if err != nil {
+			slog.Error("Failed to read queue depth", logging.Err(err))
+			return -1
+		}
+		return float64(n)
+	})
+}
+
+// WatchCabs refreshes the cabs gauge every interval until ctx is done.
+// Counting walks every cab, so it is not done on each scrape.
+func WatchCabs(ctx context.Context, interval time.Duration, count func(ctx context.Context) (map[string]int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		counts, err := count(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to count cabs", logging.Err(err))
+		} else {
+			Cabs.Reset()
+			for status, n := range counts {
+				Cabs.WithLabelValues(status).Set(float64(n))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
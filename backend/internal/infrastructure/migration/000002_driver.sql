@@ -0,0 +1,14 @@
+CREATE SCHEMA IF NOT EXISTS driver_schema;
+
+CREATE TABLE driver_schema.driver (
+    id SERIAL PRIMARY KEY,
+    cab_id TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL UNIQUE,
+    vehicle_number TEXT NOT NULL UNIQUE,
+    capacity INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_driver_created_at
+ON driver_schema.driver (created_at);
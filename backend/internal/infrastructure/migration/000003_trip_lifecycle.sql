@@ -0,0 +1,21 @@
+ALTER TABLE rider_schema.trip
+ADD COLUMN rider_id INT;
+
+CREATE INDEX idx_trip_rider_id
+ON rider_schema.trip (rider_id);
+
+CREATE TABLE rider_schema.trip_event (
+    id SERIAL PRIMARY KEY,
+    trip_id INT NOT NULL,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+
+    CONSTRAINT fk_trip_event_trip
+        FOREIGN KEY (trip_id)
+        REFERENCES rider_schema.trip(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_trip_event_trip_id
+ON rider_schema.trip_event (trip_id);
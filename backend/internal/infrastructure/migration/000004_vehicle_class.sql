@@ -0,0 +1,2 @@
+ALTER TABLE driver_schema.driver
+ADD COLUMN vehicle_class TEXT NOT NULL DEFAULT 'sedan';
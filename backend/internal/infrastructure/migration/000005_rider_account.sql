@@ -0,0 +1,19 @@
+CREATE TABLE rider_schema.rider (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    phone TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_rider_created_at
+ON rider_schema.rider (created_at);
+
+-- trips created before rider accounts carry their own id as rider_id,
+-- only new trips are checked against the rider table
+ALTER TABLE rider_schema.trip
+ADD CONSTRAINT fk_trip_rider
+    FOREIGN KEY (rider_id)
+    REFERENCES rider_schema.rider(id)
+    NOT VALID;
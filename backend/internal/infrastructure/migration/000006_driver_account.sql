@@ -0,0 +1,4 @@
+-- drivers registered before accounts have no password and cannot log in
+-- until one is set
+ALTER TABLE driver_schema.driver
+ADD COLUMN password_hash TEXT;
@@ -0,0 +1,301 @@
+package queue
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/config"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// State is the state of the connection to RabbitMQ
+type State string
+
+const (
+	StateConnected  State = "connected"
+	StateConnecting State = "connecting"
+	StateClosed     State = "closed"
+)
+
+// ErrDisconnected is returned while the connection to RabbitMQ is down and
+// being re-established
+var ErrDisconnected = errors.New("not connected to RabbitMQ, try again later")
+
+// Connection is a RabbitMQ connection that is re-established with backoff
+// whenever it is lost. Every (re)connect declares the topology first and
+// then reopens the channels handed out by Channel, running their setup
+// again, so consumers are registered on the new connection.
+type Connection struct {
+	config config.RabbitMQConfig
+	queues []QueueOptions
+	logger *slog.Logger
+
+	mu       sync.RWMutex
+	conn     *amqp.Connection
+	state    State
+	lastErr  error
+	channels []*Channel
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Connect dials RabbitMQ and declares the given queues. Only the first
+// attempt has to succeed, later losses are recovered in the background.
+func Connect(cfg config.RabbitMQConfig, logger *slog.Logger, queues ...QueueOptions) (*Connection, error) {
+	c := &Connection{
+		config: cfg,
+		queues: queues,
+		logger: logger.With("component", "rabbitmq"),
+		state:  StateConnecting,
+		done:   make(chan struct{}),
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	go c.watch()
+
+	return c, nil
+}
+
+// State returns the connection state, and the reason while it is not connected
+func (c *Connection) State() (State, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.state == StateConnected {
+		return c.state, nil
+	}
+	if c.lastErr != nil {
+		return c.state, c.lastErr
+	}
+	return c.state, ErrDisconnected
+}
+
+// Channel returns a channel that is reopened, and set up again, whenever it
+// or the connection closes. setup may be nil.
+func (c *Connection) Channel(setup func(ch *amqp.Channel) error) (*Channel, error) {
+	ch := &Channel{conn: c, setup: setup}
+
+	c.mu.Lock()
+	c.channels = append(c.channels, ch)
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn != nil && !conn.IsClosed() {
+		if err := ch.open(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	return ch, nil
+}
+
+// Close stops reconnecting and closes the connection along with its channels
+func (c *Connection) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.mu.Lock()
+		conn := c.conn
+		c.state = StateClosed
+		c.lastErr = nil
+		c.mu.Unlock()
+
+		if conn != nil && !conn.IsClosed() {
+			err = conn.Close()
+		}
+	})
+	return err
+}
+
+// closing reports whether Close was called
+func (c *Connection) closing() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// connect dials, declares the topology and reopens the channels
+func (c *Connection) connect() error {
+	conn, err := ConnectRabbitMQ(c.config)
+	if err != nil {
+		return err
+	}
+
+	if err := c.declare(conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	channels := slices.Clone(c.channels)
+	c.mu.Unlock()
+
+	for _, ch := range channels {
+		if err := ch.open(conn); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.state = StateConnected
+	c.lastErr = nil
+	c.mu.Unlock()
+
+	return nil
+}
+
+// declare declares the queues on a channel of their own, a failed
+// declaration closes the channel it ran on
+func (c *Connection) declare(conn *amqp.Connection) error {
+	if len(c.queues) == 0 {
+		return nil
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, opt := range c.queues {
+		if err := DeclareQueue(ch, opt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watch waits for the connection to close and reconnects until Close is called
+func (c *Connection) watch() {
+	for {
+		c.mu.RLock()
+		conn := c.conn
+		c.mu.RUnlock()
+
+		var reason error = ErrDisconnected
+		select {
+		case <-c.done:
+			return
+		case err := <-conn.NotifyClose(make(chan *amqp.Error, 1)):
+			if c.closing() {
+				return
+			}
+			if err != nil {
+				reason = err
+			}
+		}
+
+		c.mu.Lock()
+		c.state = StateConnecting
+		c.lastErr = reason
+		c.mu.Unlock()
+
+		c.logger.Warn("Lost connection to RabbitMQ, reconnecting", logging.Err(reason))
+
+		if !c.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect retries connect with exponential backoff, false once Close is called
+func (c *Connection) reconnect() bool {
+	delay := c.config.ReconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := c.connect()
+		if err == nil {
+			c.logger.Info("Reconnected to RabbitMQ", "attempt", attempt)
+			return true
+		}
+
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+
+		delay = min(delay*2, c.config.ReconnectMaxDelay)
+		c.logger.Warn("Failed to reconnect to RabbitMQ", "attempt", attempt, "retry_in", delay, logging.Err(err))
+	}
+}
+
+// Channel is an AMQP channel kept open by its Connection
+type Channel struct {
+	conn  *Connection
+	setup func(ch *amqp.Channel) error
+
+	mu sync.RWMutex
+	ch *amqp.Channel
+}
+
+// Get returns the open channel, ErrDisconnected while it is being reopened
+func (c *Channel) Get() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ch == nil || c.ch.IsClosed() {
+		return nil, ErrDisconnected
+	}
+	return c.ch, nil
+}
+
+// open opens the channel on conn and runs its setup
+func (c *Channel) open(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	if c.setup != nil {
+		if err := c.setup(ch); err != nil {
+			_ = ch.Close()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.ch = ch
+	c.mu.Unlock()
+
+	go c.watch(conn, closed)
+
+	return nil
+}
+
+// watch reopens the channel when the broker closes it on a live
+// connection, e.g. after a channel exception. When the connection itself
+// is lost the Connection reopens it after reconnecting.
+func (c *Channel) watch(conn *amqp.Connection, closed <-chan *amqp.Error) {
+	err := <-closed
+	if conn.IsClosed() || c.conn.closing() {
+		return
+	}
+
+	c.conn.logger.Warn("RabbitMQ channel closed, reopening", logging.Err(err))
+
+	if err := c.open(conn); err != nil {
+		// start over on a fresh connection
+		c.conn.logger.Error("Failed to reopen RabbitMQ channel, reconnecting", logging.Err(err))
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,441 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ErrNotEnqueued is returned by Publish when the job cannot be shown to be
+// stored by the queue, wrapping the reason
+var ErrNotEnqueued = errors.New("job was not enqueued")
+
+// JobQueue is the work queue ride requests travel through, including the
+// delayed retries and the dead-letter queue
+type JobQueue interface {
+	// Publish sends the request ID and trace context of ctx along with the
+	// job. It returns once the queue has stored the job, or an error
+	// wrapping ErrNotEnqueued.
+	Publish(ctx context.Context, body []byte) error
+	// Requeue publishes a job taken off the queue before again, like
+	// Publish, keeping its retry count
+	Requeue(ctx context.Context, body []byte, retries int) error
+	// Consume returns the stream of jobs, it outlives reconnects to the broker
+	Consume() (<-chan Message, error)
+	// Cancel stops the delivery of new jobs. Jobs handed out and not yet
+	// acked stay with the consumer, the broker redelivers them once the
+	// connection closes.
+	Cancel() error
+	// Retry schedules a copy of the message for the given attempt, the
+	// original still has to be acked
+	Retry(m Message, attempt int) error
+	// Delay schedules a copy of the message, marked Delayed, to come back
+	// after the delay without counting as a retry. The original still has
+	// to be acked. A shorter delay queued behind a longer one comes back
+	// late, RabbitMQ only expires the message at the head of the queue.
+	Delay(m Message, after time.Duration) error
+	// Postpone schedules a copy of the message like Delay, but not marked
+	// Delayed, e.g. for a job waiting for something other than an offer
+	Postpone(m Message, after time.Duration) error
+	// DeadLetter moves a copy of the message to the dead-letter queue, the
+	// original still has to be acked
+	DeadLetter(m Message, reason error) error
+	// Depth is the number of jobs waiting to be consumed
+	Depth() (int, error)
+}
+
+// Message is a job taken off a JobQueue. It must be acked or nacked once.
+type Message struct {
+	ID   string
+	Body []byte
+	// Retries is how often the job has been retried so far
+	Retries int
+	// Redelivered is set when the message was handed out before and not acked
+	Redelivered bool
+	// Delayed is set on copies scheduled with Delay, retries clear it
+	Delayed bool
+	// RequestID is the ID of the request that published the job
+	RequestID string
+
+	delivery *amqp.Delivery
+	acker    acker
+	carrier  propagation.TextMapCarrier
+}
+
+// Context returns parent carrying the request ID and trace context the job
+// was published with
+func (m Message) Context(parent context.Context) context.Context {
+	ctx := parent
+	if m.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, m.RequestID)
+	}
+	if m.carrier == nil {
+		return ctx
+	}
+	return tracing.Extract(ctx, m.carrier)
+}
+
+type acker interface {
+	ack(m Message) error
+	nack(m Message, requeue bool) error
+}
+
+// Ack removes the message from the queue
+func (m Message) Ack() error {
+	if m.acker == nil {
+		return nil
+	}
+	return m.acker.ack(m)
+}
+
+// Nack hands the message back to the queue, or dead-letters it
+// when requeue is false
+func (m Message) Nack(requeue bool) error {
+	if m.acker == nil {
+		return nil
+	}
+	return m.acker.nack(m, requeue)
+}
+
+// amqpJobQueue is the RabbitMQ JobQueue using the topology of DeclareQueue
+type amqpJobQueue struct {
+	ch          *Channel
+	queueName   string
+	consumerTag string
+	logger      *slog.Logger
+	out         chan Message
+
+	// confirmTimeout bounds the wait for the broker to confirm a publish
+	confirmTimeout time.Duration
+
+	// returned tracks the message IDs of publishes waiting for their
+	// confirm, set when the broker returns the message as unroutable
+	returnsMu sync.Mutex
+	returned  map[string]bool
+
+	// mu orders registering the consumer in Consume and Cancel with the
+	// re-registration after a reconnect
+	mu        sync.Mutex
+	consuming bool
+
+	cancelled  chan struct{}
+	cancelOnce sync.Once
+}
+
+// NewAMQPJobQueue function initialises a job queue on a queue declared by
+// conn. Retries and dead letters are published on the consuming channel,
+// the consumer is registered again whenever the channel is reopened.
+func NewAMQPJobQueue(conn *Connection, queueName string, logger *slog.Logger) (JobQueue, error) {
+	q := &amqpJobQueue{
+		queueName:   queueName,
+		consumerTag: queueName + "-" + uuid.NewString(),
+		logger:      logger.With("queue", queueName),
+		out:         make(chan Message),
+		cancelled:   make(chan struct{}),
+
+		confirmTimeout: conn.config.ConfirmTimeout,
+		returned:       map[string]bool{},
+	}
+
+	ch, err := conn.Channel(q.register)
+	if err != nil {
+		return nil, err
+	}
+	q.ch = ch
+
+	return q, nil
+}
+
+func (q *amqpJobQueue) Publish(ctx context.Context, body []byte) error {
+	return q.Requeue(ctx, body, 0)
+}
+
+func (q *amqpJobQueue) Requeue(ctx context.Context, body []byte, retries int) error {
+	ctx, span := startPublish(ctx, semconv.MessagingSystemRabbitmq, q.queueName, body)
+	defer span.End()
+
+	id := uuid.NewString()
+	span.SetAttributes(semconv.MessagingMessageID(id))
+
+	err := q.publish(ctx, id, body, retries)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotEnqueued, err)
+	}
+
+	q.logger.DebugContext(ctx, "Published job", "message_id", id, "bytes", len(body))
+	return nil
+}
+
+// publish publishes a persistent, mandatory message and waits for the
+// broker to confirm it
+func (q *amqpJobQueue) publish(ctx context.Context, id string, body []byte, retries int) error {
+	ch, err := q.ch.Get()
+	if err != nil {
+		return err
+	}
+
+	headers := amqp.Table{}
+	if retries > 0 {
+		headers[RetryCountHeader] = int32(retries)
+	}
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		headers[RequestIDHeader] = requestID
+	}
+	tracing.Inject(ctx, headerCarrier(headers))
+
+	return q.confirmed(ctx, id, func() (*amqp.DeferredConfirmation, error) {
+		return ch.PublishWithDeferredConfirmWithContext(
+			ctx,
+			"",
+			q.queueName,
+			true,
+			false,
+			amqp.Publishing{
+				Headers:      headers,
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				MessageId:    id,
+				Timestamp:    time.Now(),
+				Body:         body,
+			},
+		)
+	})
+}
+
+// confirmed runs the publish of message id and waits for the broker to
+// confirm it. A mandatory message the broker could not route to a queue
+// is returned before its confirm arrives.
+func (q *amqpJobQueue) confirmed(ctx context.Context, id string, publish func() (*amqp.DeferredConfirmation, error)) error {
+	q.returnsMu.Lock()
+	q.returned[id] = false
+	q.returnsMu.Unlock()
+
+	defer func() {
+		q.returnsMu.Lock()
+		delete(q.returned, id)
+		q.returnsMu.Unlock()
+	}()
+
+	confirm, err := publish()
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, q.confirmTimeout)
+	defer cancel()
+
+	acked, err := confirm.WaitContext(waitCtx)
+	if err != nil {
+		return fmt.Errorf("no publisher confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("broker nacked the publish")
+	}
+
+	q.returnsMu.Lock()
+	returned := q.returned[id]
+	q.returnsMu.Unlock()
+
+	if returned {
+		return errors.New("broker returned the publish, no queue to route it to")
+	}
+
+	return nil
+}
+
+// watchReturns records the unroutable publishes the broker returns on ch,
+// until ch closes
+func (q *amqpJobQueue) watchReturns(returns <-chan amqp.Return) {
+	for r := range returns {
+		q.returnsMu.Lock()
+		if _, waiting := q.returned[r.MessageId]; waiting {
+			q.returned[r.MessageId] = true
+		}
+		q.returnsMu.Unlock()
+
+		q.logger.Warn("Broker returned job", "message_id", r.MessageId, "reply_code", r.ReplyCode, "reply_text", r.ReplyText)
+	}
+}
+
+// Consume registers the consumer. While disconnected it is registered once
+// the channel is reopened.
+func (q *amqpJobQueue) Consume() (<-chan Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.consuming {
+		q.consuming = true
+
+		if ch, err := q.ch.Get(); err == nil {
+			if err := q.consume(ch); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return q.out, nil
+}
+
+// register is the channel setup. It puts the channel in confirm mode and
+// consumes again on a reopened channel.
+func (q *amqpJobQueue) register(ch *amqp.Channel) error {
+	if err := ch.Confirm(false); err != nil {
+		return err
+	}
+	go q.watchReturns(ch.NotifyReturn(make(chan amqp.Return, 1)))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.consuming {
+		return nil
+	}
+
+	q.logger.Info("Registering job consumer on reopened channel")
+	return q.consume(ch)
+}
+
+// consume starts a consumer on ch forwarding its deliveries to q.out
+func (q *amqpJobQueue) consume(ch *amqp.Channel) error {
+	msgs, err := ch.Consume(
+		q.queueName,
+		q.consumerTag,
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		// the channel closed, deliveries not yet acked are redelivered
+		defer q.logger.Debug("Job consumer channel closed")
+
+		for d := range msgs {
+			d := d
+			requestID, _ := d.Headers[RequestIDHeader].(string)
+			m := Message{
+				ID:          d.MessageId,
+				Body:        d.Body,
+				Retries:     RetryCount(d),
+				Redelivered: d.Redelivered,
+				Delayed:     IsDelayed(d),
+				RequestID:   requestID,
+				delivery:    &d,
+				acker:       q,
+				carrier:     headerCarrier(d.Headers),
+			}
+
+			select {
+			case q.out <- m:
+			case <-q.cancelled:
+				// nobody reads anymore, the delivery is redelivered on close
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (q *amqpJobQueue) Cancel() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var err error
+	q.cancelOnce.Do(func() {
+		q.consuming = false
+		close(q.cancelled)
+
+		// without a channel there is no consumer to cancel
+		if ch, chErr := q.ch.Get(); chErr == nil {
+			err = ch.Cancel(q.consumerTag, false)
+		}
+	})
+	return err
+}
+
+// Retry, Delay, Postpone and DeadLetter return once the broker confirmed the copy,
+// the caller acks the original only then
+func (q *amqpJobQueue) Retry(m Message, attempt int) error {
+	ch, err := q.ch.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return q.confirmed(ctx, m.ID, func() (*amqp.DeferredConfirmation, error) {
+		return PublishRetry(ctx, ch, q.queueName, *m.delivery, attempt)
+	})
+}
+
+func (q *amqpJobQueue) Delay(m Message, after time.Duration) error {
+	ch, err := q.ch.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return q.confirmed(ctx, m.ID, func() (*amqp.DeferredConfirmation, error) {
+		return PublishDelay(ctx, ch, q.queueName, *m.delivery, after)
+	})
+}
+
+func (q *amqpJobQueue) Postpone(m Message, after time.Duration) error {
+	ch, err := q.ch.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return q.confirmed(ctx, m.ID, func() (*amqp.DeferredConfirmation, error) {
+		return PublishPostponed(ctx, ch, q.queueName, *m.delivery, after)
+	})
+}
+
+func (q *amqpJobQueue) DeadLetter(m Message, reason error) error {
+	ch, err := q.ch.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return q.confirmed(ctx, m.ID, func() (*amqp.DeferredConfirmation, error) {
+		return PublishDeadLetter(ctx, ch, q.queueName, *m.delivery, reason)
+	})
+}
+
+func (q *amqpJobQueue) Depth() (int, error) {
+	ch, err := q.ch.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := ch.QueueDeclarePassive(q.queueName, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return info.Messages, nil
+}
+
+func (q *amqpJobQueue) ack(m Message) error {
+	return m.delivery.Ack(false)
+}
+
+func (q *amqpJobQueue) nack(m Message, requeue bool) error {
+	return m.delivery.Nack(false, requeue)
+}
@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// memoryQueueName names the in-memory queue in traces and logs
+const memoryQueueName = "memory"
+
+// memoryBuffer is how many jobs the in-memory queue holds before Publish blocks
+const memoryBuffer = 1024
+
+// Memory is an in-process JobQueue with the same retry and dead-letter
+// behaviour as the RabbitMQ topology. Jobs are lost when the process
+// exits, it is meant for tests and local development. It also serves the
+// admin endpoints as a QueueService.
+type Memory struct {
+	retry  RetryOptions
+	jobs   chan Message
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	dead   []DeadLetter
+	nextID int
+}
+
+// NewMemoryQueue function initialises an in-process job queue
+func NewMemoryQueue(retry RetryOptions, logger *slog.Logger) *Memory {
+	return &Memory{
+		retry:  retry,
+		jobs:   make(chan Message, memoryBuffer),
+		logger: logger.With("queue", memoryQueueName),
+	}
+}
+
+func (q *Memory) Publish(ctx context.Context, body []byte) error {
+	return q.Requeue(ctx, body, 0)
+}
+
+func (q *Memory) Requeue(ctx context.Context, body []byte, retries int) error {
+	q.mu.Lock()
+	q.nextID++
+	id := strconv.Itoa(q.nextID)
+	q.mu.Unlock()
+
+	ctx, span := startPublish(ctx, semconv.MessagingSystemKey.String("memory"), memoryQueueName, body)
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	tracing.Inject(ctx, carrier)
+
+	m := Message{
+		ID:        id,
+		Body:      body,
+		Retries:   retries,
+		RequestID: logging.RequestID(ctx),
+		acker:     q,
+		carrier:   carrier,
+	}
+
+	select {
+	case q.jobs <- m:
+		q.logger.DebugContext(ctx, "Published job", "message_id", id, "bytes", len(body))
+		return nil
+	case <-ctx.Done():
+		tracing.RecordError(span, ctx.Err())
+		return fmt.Errorf("%w: %w", ErrNotEnqueued, ctx.Err())
+	}
+}
+
+// Consume returns the job stream. There is a single stream, concurrent
+// consumers share it.
+func (q *Memory) Consume() (<-chan Message, error) {
+	return q.jobs, nil
+}
+
+// Cancel is a no-op, jobs stay in the queue until the process exits
+func (q *Memory) Cancel() error {
+	return nil
+}
+
+// Retry redelivers the message after the attempt's backoff
+func (q *Memory) Retry(m Message, attempt int) error {
+	delay := q.retry.BaseDelay << (attempt - 1)
+
+	m.Retries = attempt
+	m.Delayed = false
+	time.AfterFunc(delay, func() { q.jobs <- m })
+
+	return nil
+}
+
+// Delay redelivers the message after the delay, marked as delayed
+func (q *Memory) Delay(m Message, after time.Duration) error {
+	m.Delayed = true
+	time.AfterFunc(after, func() { q.jobs <- m })
+
+	return nil
+}
+
+// Postpone redelivers the message after the delay, unmarked
+func (q *Memory) Postpone(m Message, after time.Duration) error {
+	m.Delayed = false
+	time.AfterFunc(after, func() { q.jobs <- m })
+
+	return nil
+}
+
+func (q *Memory) DeadLetter(m Message, reason error) error {
+	d := DeadLetter{
+		MessageID:  m.ID,
+		RetryCount: m.Retries,
+		Body:       m.Body,
+	}
+	if reason != nil {
+		d.Error = reason.Error()
+	}
+
+	q.mu.Lock()
+	q.dead = append(q.dead, d)
+	q.mu.Unlock()
+
+	return nil
+}
+
+func (q *Memory) Depth() (int, error) {
+	return len(q.jobs), nil
+}
+
+func (q *Memory) ack(m Message) error {
+	return nil
+}
+
+func (q *Memory) nack(m Message, requeue bool) error {
+	if requeue {
+		m.Redelivered = true
+		go func() { q.jobs <- m }()
+		return nil
+	}
+	return q.DeadLetter(m, nil)
+}
+
+// PublishMessage publishes a job, queueName is ignored as there is only one queue
+func (q *Memory) PublishMessage(queueName, message string) error {
+	return q.Publish(context.Background(), []byte(message))
+}
+
+func (q *Memory) PeekDeadLetters(limit int) ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := min(limit, len(q.dead))
+	out := make([]DeadLetter, n)
+	copy(out, q.dead[:n])
+
+	return out, nil
+}
+
+func (q *Memory) ReplayDeadLetters(limit int) (int, error) {
+	q.mu.Lock()
+	n := min(limit, len(q.dead))
+	replay := q.dead[:n]
+	q.dead = append([]DeadLetter(nil), q.dead[n:]...)
+	q.mu.Unlock()
+
+	for _, d := range replay {
+		q.jobs <- Message{ID: d.MessageID, Body: d.Body, acker: q}
+	}
+
+	return n, nil
+}
+
+func (q *Memory) DrainQueue(limit int) ([][]byte, error) {
+	var drained [][]byte
+	for len(drained) < limit {
+		select {
+		case m := <-q.jobs:
+			drained = append(drained, m.Body)
+		default:
+			return drained, nil
+		}
+	}
+	return drained, nil
+}
@@ -1,15 +1,13 @@
 package queue
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/mahimapatel13/ride-sharing-system/internal/config"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-type MQChannel struct {
-	QueueName  string
-	Channel *amqp.Channel
-}
-
 // QueueOptions Represents the configuration options to declare a queue.
 type QueueOptions struct {
 	Name       string
@@ -17,6 +15,36 @@ type QueueOptions struct {
 	AutoDelete bool
 	Exclusive  bool
 	NoWait     bool
+	Retry      RetryOptions
+}
+
+// RetryOptions controls how failed jobs are retried before being dead-lettered.
+// Attempt n waits BaseDelay * 2^(n-1) in its own delay queue.
+type RetryOptions struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+// DeadLetterExchangeName returns the exchange that receives rejected and
+// exhausted messages of the given queue
+func DeadLetterExchangeName(queueName string) string {
+	return queueName + ".dlx"
+}
+
+// DeadLetterQueueName returns the queue bound to the dead-letter exchange
+func DeadLetterQueueName(queueName string) string {
+	return queueName + ".dead"
+}
+
+// DelayQueueName returns the queue holding messages scheduled with Delay
+// until their expiry
+func DelayQueueName(queueName string) string {
+	return queueName + ".delay"
+}
+
+// RetryQueueName returns the delay queue used for the given retry attempt
+func RetryQueueName(queueName string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", queueName, attempt)
 }
 
 // ConnectRabbitMQ connects to RabbitMQ using url stored in config object
@@ -29,35 +57,86 @@ func ConnectRabbitMQ(config config.RabbitMQConfig) (*amqp.Connection, error) {
 	return conn, nil
 }
 
-// CreateChannel creates a channel to communicate with RabbitMQ
-func CreateChannel(conn *amqp.Connection, queueName string) (*MQChannel, error) {
-	ch, err := conn.Channel()
+// QueueDeclare declares a queue to hold messages and deliver to consumers.
+// Declaring creates a queue if it doesn't already exist, or ensures that an
+// existing queue matches the same parameters.
+//
+// Alongside the work queue it declares the retry topology:
+//   - {name}.dlx, a fanout exchange bound to {name}.dead for dead letters
+//   - {name}.retry.{n}, one delay queue per attempt whose messages expire
+//     back into the work queue after the attempt's backoff
+//   - {name}.delay, holding messages that expire back into the work queue
+//     after the delay they were published with
+//
+// The work queue itself dead-letters into {name}.dlx, so an existing queue
+// declared without these arguments has to be deleted once before upgrading.
+func DeclareQueue(ch *amqp.Channel, opt QueueOptions) error {
+	dlx := DeadLetterExchangeName(opt.Name)
+	dlq := DeadLetterQueueName(opt.Name)
+
+	err := ch.ExchangeDeclare(dlx, amqp.ExchangeFanout, true, false, false, opt.NoWait, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	channel := MQChannel{
-		Channel: ch,
-		QueueName: queueName,
+	_, err = ch.QueueDeclare(dlq, true, false, false, opt.NoWait, nil)
+	if err != nil {
+		return err
 	}
-	return &channel, nil
-}
 
-// QueueDeclare declares a queue to hold messages and deliver to consumers.
-// Declaring creates a queue if it doesn't already exist, or ensures that an
-// existing queue matches the same parameters.
-func DeclareQueue(ch *amqp.Channel, opt QueueOptions) error {
-	_, err := ch.QueueDeclare(
+	err = ch.QueueBind(dlq, "", dlx, opt.NoWait, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(
 		opt.Name,
 		opt.Durable,
 		opt.AutoDelete,
 		opt.Exclusive,
 		opt.NoWait,
-		nil,
+		amqp.Table{
+			"x-dead-letter-exchange": dlx,
+		},
 	)
+	if err != nil {
+		return err
+	}
 
+	_, err = ch.QueueDeclare(
+		DelayQueueName(opt.Name),
+		true,
+		false,
+		false,
+		opt.NoWait,
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": opt.Name,
+		},
+	)
 	if err != nil {
 		return err
 	}
+
+	for attempt := 1; attempt <= opt.Retry.MaxRetries; attempt++ {
+		delay := opt.Retry.BaseDelay << (attempt - 1)
+
+		_, err = ch.QueueDeclare(
+			RetryQueueName(opt.Name, attempt),
+			true,
+			false,
+			false,
+			opt.NoWait,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": opt.Name,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// RetryCountHeader carries how many times a message has been retried
+	RetryCountHeader = "x-retry-count"
+	// ErrorHeader carries the last processing error of a dead-lettered message
+	ErrorHeader = "x-last-error"
+	// RequestIDHeader carries the ID of the request that published the job
+	RequestIDHeader = "x-request-id"
+	// DelayedHeader marks a message scheduled with PublishDelay
+	DelayedHeader = "x-delayed"
+)
+
+// RetryCount reads the retry counter from the delivery headers
+func RetryCount(d amqp.Delivery) int {
+	switch v := d.Headers[RetryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// IsDelayed reports whether the delivery was scheduled with PublishDelay
+func IsDelayed(d amqp.Delivery) bool {
+	delayed, _ := d.Headers[DelayedHeader].(bool)
+	return delayed
+}
+
+// PublishRetry republishes the delivery into the delay queue of the given
+// attempt. Once the delay expires the broker routes it back to queueName.
+// Like every Publish function here it returns the broker's confirmation,
+// nil unless ch is in confirm mode.
+func PublishRetry(ctx context.Context, ch *amqp.Channel, queueName string, d amqp.Delivery, attempt int) (*amqp.DeferredConfirmation, error) {
+	headers := copyHeaders(d.Headers)
+	headers[RetryCountHeader] = int32(attempt)
+	delete(headers, DelayedHeader)
+
+	return ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		RetryQueueName(queueName, attempt),
+		true,
+		false,
+		republishing(d, headers),
+	)
+}
+
+// PublishDelay republishes the delivery into the delay queue of queueName,
+// marked as delayed. The message expires after the delay and the broker
+// routes it back to queueName, its retry count is kept.
+func PublishDelay(ctx context.Context, ch *amqp.Channel, queueName string, d amqp.Delivery, after time.Duration) (*amqp.DeferredConfirmation, error) {
+	headers := copyHeaders(d.Headers)
+	headers[DelayedHeader] = true
+
+	return publishAfter(ctx, ch, queueName, d, headers, after)
+}
+
+// PublishPostponed republishes the delivery into the delay queue of
+// queueName like PublishDelay, but unmarked
+func PublishPostponed(ctx context.Context, ch *amqp.Channel, queueName string, d amqp.Delivery, after time.Duration) (*amqp.DeferredConfirmation, error) {
+	headers := copyHeaders(d.Headers)
+	delete(headers, DelayedHeader)
+
+	return publishAfter(ctx, ch, queueName, d, headers, after)
+}
+
+func publishAfter(ctx context.Context, ch *amqp.Channel, queueName string, d amqp.Delivery, headers amqp.Table, after time.Duration) (*amqp.DeferredConfirmation, error) {
+	msg := republishing(d, headers)
+	msg.Expiration = strconv.FormatInt(after.Milliseconds(), 10)
+
+	return ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		DelayQueueName(queueName),
+		true,
+		false,
+		msg,
+	)
+}
+
+// PublishDeadLetter moves the delivery to the dead-letter exchange of
+// queueName, recording why it could not be processed.
+func PublishDeadLetter(ctx context.Context, ch *amqp.Channel, queueName string, d amqp.Delivery, reason error) (*amqp.DeferredConfirmation, error) {
+	headers := copyHeaders(d.Headers)
+	headers[RetryCountHeader] = int32(RetryCount(d))
+	if reason != nil {
+		headers[ErrorHeader] = reason.Error()
+	}
+
+	return ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		DeadLetterExchangeName(queueName),
+		"",
+		false,
+		false,
+		republishing(d, headers),
+	)
+}
+
+func republishing(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: d.DeliveryMode,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Body:         d.Body,
+	}
+}
+
+func copyHeaders(h amqp.Table) amqp.Table {
+	out := make(amqp.Table, len(h)+2)
+	for k, v := range h {
+		// x-death is maintained by the broker and grows on every expiry
+		if k == "x-death" {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -1,21 +1,46 @@
 package queue
 
-import amqp "github.com/rabbitmq/amqp091-go"
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
 
 // QueueService interface representes the methods
 // any queue service should implement
 type QueueService interface {
 	PublishMessage(queueName, message string) error
+	PeekDeadLetters(limit int) ([]DeadLetter, error)
+	ReplayDeadLetters(limit int) (int, error)
+	// DrainQueue removes up to limit jobs waiting on the work queue and
+	// returns their bodies. Jobs already handed to a worker are not affected.
+	DrainQueue(limit int) ([][]byte, error)
+}
+
+// DeadLetter is a message that exhausted its retries or could not be processed
+type DeadLetter struct {
+	MessageID  string
+	RetryCount int
+	Error      string
+	Body       []byte
 }
 
 // service struct implements QueueService interface
 type service struct{
-    mqChannel *amqp.Channel
+    mqChannel *Channel
     queueName string
+
+    // dead letters are read with basic.get on mqChannel, concurrent
+    // peeks/replays would ack or requeue each other's deliveries
+    mu sync.Mutex
 }
 
-// NewQueueService function initialises a new queue service 
-func NewQueueService(ch *amqp.Channel, queueName string) QueueService{
+// NewQueueService function initialises a new queue service.
+// The channel must not be shared with a consumer since dead letters are
+// acknowledged in bulk on it.
+func NewQueueService(ch *Channel, queueName string) QueueService{
     return &service{
         mqChannel: ch,
         queueName: queueName,
@@ -24,17 +49,142 @@ func NewQueueService(ch *amqp.Channel, queueName string) QueueService{
 
 // PublishMessage publishes persistent message via queue channel.
 func(s *service) PublishMessage(queueName, message string) error{
+    ch, err := s.mqChannel.Get()
+    if err != nil {
+        return err
+    }
 
-    err := s.mqChannel.Publish(
+    err = ch.Publish(
         "",
         s.queueName,
         true,
         false,
         amqp.Publishing{
-            ContentType: "text/plain",
-            Body: []byte(message),
+            ContentType:  "application/json",
+            DeliveryMode: amqp.Persistent,
+            MessageId:    uuid.NewString(),
+            Timestamp:    time.Now(),
+            Body:         []byte(message),
         },
     )
 
     return err
-}
\ No newline at end of file
+}
+
+// PeekDeadLetters returns up to limit dead letters without removing them
+func (s *service) PeekDeadLetters(limit int) ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, err := s.mqChannel.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []DeadLetter
+	var lastTag uint64
+
+	// hold every message unacked so the next get returns a new one,
+	// then hand them all back in one go
+	for len(out) < limit {
+		d, ok, err := ch.Get(DeadLetterQueueName(s.queueName), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		lastTag = d.DeliveryTag
+		out = append(out, toDeadLetter(d))
+	}
+
+	if lastTag != 0 {
+		if err := ch.Nack(lastTag, true, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// ReplayDeadLetters moves up to limit dead letters back onto the work queue
+// with a fresh retry budget and returns how many were replayed
+func (s *service) ReplayDeadLetters(limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, err := s.mqChannel.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+
+	for replayed < limit {
+		d, ok, err := ch.Get(DeadLetterQueueName(s.queueName), false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := copyHeaders(d.Headers)
+		delete(headers, RetryCountHeader)
+		delete(headers, ErrorHeader)
+
+		err = ch.Publish("", s.queueName, true, false, republishing(d, headers))
+		if err != nil {
+			_ = d.Nack(false, true)
+			return replayed, err
+		}
+
+		if err := d.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+func (s *service) DrainQueue(limit int) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, err := s.mqChannel.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	var drained [][]byte
+
+	for len(drained) < limit {
+		d, ok, err := ch.Get(s.queueName, false)
+		if err != nil {
+			return drained, err
+		}
+		if !ok {
+			break
+		}
+
+		if err := d.Ack(false); err != nil {
+			return drained, err
+		}
+		drained = append(drained, d.Body)
+	}
+
+	return drained, nil
+}
+
+func toDeadLetter(d amqp.Delivery) DeadLetter {
+	reason, _ := d.Headers[ErrorHeader].(string)
+
+	return DeadLetter{
+		MessageID:  d.MessageId,
+		RetryCount: RetryCount(d),
+		Error:      reason,
+		Body:       d.Body,
+	}
+}
@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// topicBuffer is how many messages a topic holds for a slow reader before
+// further ones are dropped
+const topicBuffer = 256
+
+// Topic is a topic exchange every process receives the messages of through
+// an exclusive queue of its own. Messages are transient and delivery is
+// best effort, a process misses what is published while it is disconnected.
+type Topic struct {
+	ch       *Channel
+	exchange string
+	binding  string
+	logger   *slog.Logger
+	out      chan []byte
+}
+
+// NewTopic function declares the exchange and a queue of this process
+// bound to it with the binding key. Both are declared again, and the
+// consumer registered again, whenever the channel is reopened.
+func NewTopic(conn *Connection, exchange, binding string, logger *slog.Logger) (*Topic, error) {
+	t := &Topic{
+		exchange: exchange,
+		binding:  binding,
+		logger:   logger.With("exchange", exchange),
+		out:      make(chan []byte, topicBuffer),
+	}
+
+	ch, err := conn.Channel(t.register)
+	if err != nil {
+		return nil, err
+	}
+	t.ch = ch
+
+	return t, nil
+}
+
+// Publish publishes the message under the routing key, nobody has to be
+// listening
+func (t *Topic) Publish(ctx context.Context, key string, body []byte) error {
+	ch, err := t.ch.Get()
+	if err != nil {
+		return err
+	}
+
+	headers := amqp.Table{}
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		headers[RequestIDHeader] = requestID
+	}
+
+	return ch.PublishWithContext(ctx, t.exchange, key, false, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Transient,
+		Timestamp:    time.Now(),
+		Body:         body,
+	})
+}
+
+// Messages returns the bodies of the messages received, it outlives
+// reconnects to the broker
+func (t *Topic) Messages() <-chan []byte {
+	return t.out
+}
+
+// register is the channel setup, the queue is server-named and goes away
+// with the channel
+func (t *Topic) register(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(t.exchange, amqp.ExchangeTopic, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := ch.QueueBind(q.Name, t.binding, t.exchange, false, nil); err != nil {
+		return err
+	}
+
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	t.logger.Info("Consuming topic", "queue", q.Name, "binding", t.binding)
+
+	go func() {
+		for d := range msgs {
+			select {
+			case t.out <- d.Body:
+			default:
+				t.logger.Warn("Topic dropped message for slow reader", "routing_key", d.RoutingKey)
+			}
+		}
+	}()
+
+	return nil
+}
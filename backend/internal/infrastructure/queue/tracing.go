@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier lets the propagator read and write the trace context in
+// AMQP message headers. Retries and dead letters copy the headers, so a
+// retried job stays in the trace of the request that published it.
+type headerCarrier amqp.Table
+
+func (h headerCarrier) Get(key string) string {
+	v, _ := h[key].(string)
+	return v
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startPublish starts the producer span of a job published to queueName
+func startPublish(ctx context.Context, system attribute.KeyValue, queueName string, body []byte) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "publish "+queueName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			system,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(queueName),
+			semconv.MessagingMessageBodySize(len(body)),
+		),
+	)
+}
@@ -0,0 +1,362 @@
+package routing
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// gridDegrees is the size of the spatial index cells used to snap points
+	// to the nearest graph node, roughly 1.1km
+	gridDegrees = 0.01
+	// maxSnapKm is how far a point may be from the nearest node
+	maxSnapKm = 1.0
+	// cacheSize bounds the number of node pairs whose shortest path is kept
+	cacheSize = 100_000
+)
+
+// Graph is an in-memory road network answering shortest-path queries with A*.
+// It is loaded from a preprocessed graph file, see ParseGraph for the format
+// and cmd/graphbuild for converting an OpenStreetMap extract.
+type Graph struct {
+	lat []float64
+	lng []float64
+	adj [][]edge
+
+	grid map[gridCell][]int32
+	// snapSpeedKmh is driven on the straight legs to and from the graph
+	snapSpeedKmh float64
+
+	mu sync.Mutex
+	// cache keeps shortest paths and, with nil nodes, pairs without one
+	cache map[[2]int32]path
+}
+
+type edge struct {
+	to      int32
+	metres  float64
+	seconds float64
+}
+
+type gridCell struct {
+	x int32
+	y int32
+}
+
+type path struct {
+	nodes   []int32
+	metres  float64
+	seconds float64
+}
+
+// LoadGraph reads a graph file from disk, see ParseGraph for speedKmh
+func LoadGraph(filename string, speedKmh float64) (*Graph, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseGraph(f, speedKmh)
+}
+
+// ParseGraph reads a graph in the preprocessed text format. One record per
+// line, fields separated by whitespace, lines starting with '#' are comments:
+//
+//	N <id> <lat> <lng>                  a node
+//	E <from> <to> <metres> <speed_kmh>  a one-way edge
+//	B <from> <to> <metres> <speed_kmh>  an edge usable in both directions
+//
+// Nodes must appear before the edges that reference them. speedKmh is
+// assumed between a point and its nearest node, DefaultSpeedKmh if not
+// positive.
+func ParseGraph(r io.Reader, speedKmh float64) (*Graph, error) {
+	if speedKmh <= 0 {
+		speedKmh = DefaultSpeedKmh
+	}
+
+	g := &Graph{
+		grid:         make(map[gridCell][]int32),
+		snapSpeedKmh: speedKmh,
+		cache:        make(map[[2]int32]path),
+	}
+
+	ids := make(map[int64]int32)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+
+		switch fields[0] {
+		case "N":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("line %d: node needs id, lat and lng", line)
+			}
+
+			id, err1 := strconv.ParseInt(fields[1], 10, 64)
+			lat, err2 := strconv.ParseFloat(fields[2], 64)
+			lng, err3 := strconv.ParseFloat(fields[3], 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				return nil, fmt.Errorf("line %d: malformed node", line)
+			}
+
+			idx := int32(len(g.lat))
+			ids[id] = idx
+			g.lat = append(g.lat, lat)
+			g.lng = append(g.lng, lng)
+			g.adj = append(g.adj, nil)
+
+			cell := cellOf(lat, lng)
+			g.grid[cell] = append(g.grid[cell], idx)
+
+		case "E", "B":
+			if len(fields) != 5 {
+				return nil, fmt.Errorf("line %d: edge needs from, to, metres and speed", line)
+			}
+
+			fromID, err1 := strconv.ParseInt(fields[1], 10, 64)
+			toID, err2 := strconv.ParseInt(fields[2], 10, 64)
+			metres, err3 := strconv.ParseFloat(fields[3], 64)
+			speed, err4 := strconv.ParseFloat(fields[4], 64)
+			if err1 != nil || err2 != nil || err3 != nil || err4 != nil || speed <= 0 {
+				return nil, fmt.Errorf("line %d: malformed edge", line)
+			}
+
+			from, ok1 := ids[fromID]
+			to, ok2 := ids[toID]
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("line %d: edge references unknown node", line)
+			}
+
+			seconds := metres / (speed * 1000 / 3600)
+
+			g.adj[from] = append(g.adj[from], edge{to: to, metres: metres, seconds: seconds})
+			if fields[0] == "B" {
+				g.adj[to] = append(g.adj[to], edge{to: from, metres: metres, seconds: seconds})
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: unknown record %q", line, fields[0])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(g.lat) == 0 {
+		return nil, fmt.Errorf("graph has no nodes")
+	}
+
+	return g, nil
+}
+
+// Nodes returns the number of nodes in the graph
+func (g *Graph) Nodes() int {
+	return len(g.lat)
+}
+
+func (g *Graph) Distance(from, to Point) (float64, error) {
+	r, err := g.Route(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return r.DistanceKm, nil
+}
+
+func (g *Graph) Duration(from, to Point) (time.Duration, error) {
+	r, err := g.Route(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return r.Duration, nil
+}
+
+// Route snaps both points to their nearest nodes and returns the shortest
+// path between them. The legs between the points and the snapped nodes are
+// added as straight lines.
+func (g *Graph) Route(from, to Point) (*Route, error) {
+	src, srcKm, ok := g.nearest(from)
+	if !ok {
+		return nil, ErrOutsideGraph
+	}
+
+	dst, dstKm, ok := g.nearest(to)
+	if !ok {
+		return nil, ErrOutsideGraph
+	}
+
+	p, ok := g.shortestPath(src, dst)
+	if !ok {
+		return nil, ErrNoRoute
+	}
+
+	points := make([]Point, 0, len(p.nodes)+2)
+	points = append(points, from)
+	for _, n := range p.nodes {
+		points = append(points, Point{Lat: g.lat[n], Lng: g.lng[n]})
+	}
+	points = append(points, to)
+
+	snapKm := srcKm + dstKm
+	seconds := p.seconds + snapKm/g.snapSpeedKmh*3600
+
+	return &Route{
+		Points:     points,
+		DistanceKm: p.metres/1000 + snapKm,
+		Duration:   time.Duration(seconds * float64(time.Second)),
+	}, nil
+}
+
+// nearest returns the closest node within maxSnapKm of p
+func (g *Graph) nearest(p Point) (int32, float64, bool) {
+	c := cellOf(p.Lat, p.Lng)
+
+	best := int32(-1)
+	bestKm := math.MaxFloat64
+
+	for dx := int32(-1); dx <= 1; dx++ {
+		for dy := int32(-1); dy <= 1; dy++ {
+			for _, n := range g.grid[gridCell{x: c.x + dx, y: c.y + dy}] {
+				d := HaversineKm(p.Lat, p.Lng, g.lat[n], g.lng[n])
+				if d < bestKm {
+					best, bestKm = n, d
+				}
+			}
+		}
+	}
+
+	if best < 0 || bestKm > maxSnapKm {
+		return 0, 0, false
+	}
+
+	return best, bestKm, true
+}
+
+// shortestPath runs A* by distance with the straight-line distance to the
+// target as the (admissible) heuristic. Unreachable pairs are cached as
+// well, they cost a search of everything reachable from src.
+func (g *Graph) shortestPath(src, dst int32) (path, bool) {
+	key := [2]int32{src, dst}
+
+	g.mu.Lock()
+	if p, ok := g.cache[key]; ok {
+		g.mu.Unlock()
+		return p, p.nodes != nil
+	}
+	g.mu.Unlock()
+
+	if src == dst {
+		return path{nodes: []int32{src}}, true
+	}
+
+	h := func(n int32) float64 {
+		return HaversineKm(g.lat[n], g.lng[n], g.lat[dst], g.lng[dst]) * 1000
+	}
+
+	dist := map[int32]float64{src: 0}
+	secs := map[int32]float64{src: 0}
+	prev := map[int32]int32{}
+	done := map[int32]bool{}
+
+	open := &nodeHeap{{node: src, f: h(src)}}
+
+	for open.Len() > 0 {
+		cur := heap.Pop(open).(heapItem).node
+		if done[cur] {
+			continue
+		}
+		done[cur] = true
+
+		if cur == dst {
+			break
+		}
+
+		for _, e := range g.adj[cur] {
+			nd := dist[cur] + e.metres
+			if old, seen := dist[e.to]; seen && nd >= old {
+				continue
+			}
+
+			dist[e.to] = nd
+			secs[e.to] = secs[cur] + e.seconds
+			prev[e.to] = cur
+			heap.Push(open, heapItem{node: e.to, f: nd + h(e.to)})
+		}
+	}
+
+	if !done[dst] {
+		g.remember(key, path{})
+		return path{}, false
+	}
+
+	var nodes []int32
+	for n := dst; ; n = prev[n] {
+		nodes = append(nodes, n)
+		if n == src {
+			break
+		}
+	}
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+
+	p := path{nodes: nodes, metres: dist[dst], seconds: secs[dst]}
+	g.remember(key, p)
+
+	return p, true
+}
+
+// remember caches the path of a node pair, starting over once the cache is full
+func (g *Graph) remember(key [2]int32, p path) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.cache) >= cacheSize {
+		g.cache = make(map[[2]int32]path)
+	}
+	g.cache[key] = p
+}
+
+func cellOf(lat, lng float64) gridCell {
+	return gridCell{
+		x: int32(math.Floor(lng / gridDegrees)),
+		y: int32(math.Floor(lat / gridDegrees)),
+	}
+}
+
+type heapItem struct {
+	node int32
+	f    float64
+}
+
+type nodeHeap []heapItem
+
+func (h nodeHeap) Len() int           { return len(h) }
+func (h nodeHeap) Less(i, j int) bool { return h[i].f < h[j].f }
+func (h nodeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x any)        { *h = append(*h, x.(heapItem)) }
+func (h *nodeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,147 @@
+package routing
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGraph is a square of four nodes about 110m apart and a node without
+// edges. The direct edge 1-2 is longer than the way round, 1->4 is one-way.
+const testGraph = `
+# id lat lng
+N 1 23.2500 77.4000
+N 2 23.2500 77.4010
+N 3 23.2510 77.4010
+N 4 23.2510 77.4000
+N 5 23.2550 77.4050
+
+B 1 2 400 36
+B 2 3 100 36
+E 1 4 100 36
+B 4 3 150 36
+`
+
+func parseTestGraph(t *testing.T, speedKmh float64) *Graph {
+	t.Helper()
+
+	g, err := ParseGraph(strings.NewReader(testGraph), speedKmh)
+	if err != nil {
+		t.Fatalf("ParseGraph: %v", err)
+	}
+	return g
+}
+
+func node(g *Graph, n int32) Point {
+	return Point{Lat: g.lat[n], Lng: g.lng[n]}
+}
+
+func TestGraphRoute(t *testing.T) {
+	g := parseTestGraph(t, 0)
+
+	tests := []struct {
+		name     string
+		from, to int32
+		want     []int32
+		metres   float64
+	}{
+		{name: "same node", from: 0, to: 0, want: []int32{0}, metres: 0},
+		{name: "detour beats the long direct edge", from: 0, to: 1, want: []int32{0, 3, 2, 1}, metres: 350},
+		{name: "across the square", from: 0, to: 2, want: []int32{0, 3, 2}, metres: 250},
+		{name: "one-way edge is not driven backwards", from: 2, to: 0, want: []int32{2, 1, 0}, metres: 500},
+		{name: "single edge", from: 1, to: 2, want: []int32{1, 2}, metres: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := g.Route(node(g, tt.from), node(g, tt.to))
+			if err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+
+			var want []Point
+			want = append(want, node(g, tt.from))
+			for _, n := range tt.want {
+				want = append(want, node(g, n))
+			}
+			want = append(want, node(g, tt.to))
+
+			if !slices.Equal(r.Points, want) {
+				t.Errorf("points = %v, want %v", r.Points, want)
+			}
+			if math.Abs(r.DistanceKm-tt.metres/1000) > 1e-9 {
+				t.Errorf("distance = %.3fkm, want %.3fkm", r.DistanceKm, tt.metres/1000)
+			}
+			// 36km/h is 10m/s on every edge
+			if want := time.Duration(tt.metres/10) * time.Second; r.Duration.Round(time.Millisecond) != want {
+				t.Errorf("duration = %s, want %s", r.Duration, want)
+			}
+		})
+	}
+}
+
+func TestGraphRouteErrors(t *testing.T) {
+	g := parseTestGraph(t, 0)
+
+	tests := []struct {
+		name     string
+		from, to Point
+		want     error
+	}{
+		{name: "no path to an isolated node", from: node(g, 0), to: node(g, 4), want: ErrNoRoute},
+		{name: "point far from every node", from: node(g, 0), to: Point{Lat: 23.4, Lng: 77.6}, want: ErrOutsideGraph},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := g.Route(tt.from, tt.to); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphCachesUnreachablePairs(t *testing.T) {
+	g := parseTestGraph(t, 0)
+
+	if _, err := g.Route(node(g, 0), node(g, 4)); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("err = %v, want ErrNoRoute", err)
+	}
+
+	p, ok := g.cache[[2]int32{0, 4}]
+	if !ok || p.nodes != nil {
+		t.Fatalf("cache entry = %v, %t, want an entry without nodes", p, ok)
+	}
+
+	// a second query is answered from the cache, even once the edge exists
+	g.adj[0] = append(g.adj[0], edge{to: 4, metres: 10, seconds: 1})
+	if _, err := g.Route(node(g, 0), node(g, 4)); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("err = %v, want the cached ErrNoRoute", err)
+	}
+}
+
+func TestGraphSnapLegsUseConfiguredSpeed(t *testing.T) {
+	const speedKmh = 18
+
+	g := parseTestGraph(t, speedKmh)
+
+	// 0.001 degrees of latitude south of node 1, about 111m
+	from := Point{Lat: 23.2490, Lng: 77.4000}
+	snapKm := HaversineKm(from.Lat, from.Lng, g.lat[0], g.lng[0])
+
+	r, err := g.Route(from, node(g, 1))
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+
+	want := 35*time.Second + time.Duration(snapKm/speedKmh*float64(time.Hour))
+	if r.Duration.Round(time.Millisecond) != want.Round(time.Millisecond) {
+		t.Errorf("duration = %s, want %s", r.Duration, want)
+	}
+	if math.Abs(r.DistanceKm-(0.35+snapKm)) > 1e-9 {
+		t.Errorf("distance = %.4fkm, want %.4fkm", r.DistanceKm, 0.35+snapKm)
+	}
+}
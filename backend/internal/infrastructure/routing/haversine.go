@@ -0,0 +1,57 @@
+package routing
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultSpeedKmh is the average city speed assumed for straight-line durations
+const DefaultSpeedKmh = 25.0
+
+// Haversine routes along the great circle between two points. It is the
+// fallback when no road graph is configured and underestimates real
+// driving distance.
+type Haversine struct {
+	SpeedKmh float64
+}
+
+// NewHaversineRouter function initialises a straight-line router
+func NewHaversineRouter(speedKmh float64) Haversine {
+	if speedKmh <= 0 {
+		speedKmh = DefaultSpeedKmh
+	}
+	return Haversine{SpeedKmh: speedKmh}
+}
+
+func (h Haversine) Distance(from, to Point) (float64, error) {
+	return HaversineKm(from.Lat, from.Lng, to.Lat, to.Lng), nil
+}
+
+func (h Haversine) Duration(from, to Point) (time.Duration, error) {
+	d := HaversineKm(from.Lat, from.Lng, to.Lat, to.Lng)
+	return time.Duration(d / h.SpeedKmh * float64(time.Hour)), nil
+}
+
+func (h Haversine) Route(from, to Point) (*Route, error) {
+	d := HaversineKm(from.Lat, from.Lng, to.Lat, to.Lng)
+	return &Route{
+		Points:     []Point{from, to},
+		DistanceKm: d,
+		Duration:   time.Duration(d / h.SpeedKmh * float64(time.Hour)),
+	}, nil
+}
+
+// HaversineKm returns the great-circle distance between two coordinates in km
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371.0 // Earth radius in km
+
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return R * c
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrOutsideGraph is returned when a point is too far from any road in the graph
+	ErrOutsideGraph = errors.New("point is outside the routing graph")
+	// ErrNoRoute is returned when the graph has no path between two points
+	ErrNoRoute = errors.New("no route between points")
+)
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// Route is a path between two points along the road network
+type Route struct {
+	Points     []Point
+	DistanceKm float64
+	Duration   time.Duration
+}
+
+// Router answers distance and travel time queries between two points.
+// Distances are in kilometres.
+type Router interface {
+	Distance(from, to Point) (float64, error)
+	Duration(from, to Point) (time.Duration, error)
+	Route(from, to Point) (*Route, error)
+}
+
+// DistanceKm returns the router's distance between the points, or the
+// straight-line distance if the router cannot route the pair
+func DistanceKm(r Router, from, to Point) float64 {
+	if r != nil {
+		if d, err := r.Distance(from, to); err == nil {
+			return d
+		}
+	}
+	return HaversineKm(from.Lat, from.Lng, to.Lat, to.Lng)
+}
+
+// fallback answers with primary and retries with secondary whenever
+// primary fails, e.g. for points outside the loaded graph
+type fallback struct {
+	primary   Router
+	secondary Router
+}
+
+// WithFallback returns a router that uses secondary when primary fails
+func WithFallback(primary, secondary Router) Router {
+	return &fallback{primary: primary, secondary: secondary}
+}
+
+func (f *fallback) Distance(from, to Point) (float64, error) {
+	if d, err := f.primary.Distance(from, to); err == nil {
+		return d, nil
+	}
+	return f.secondary.Distance(from, to)
+}
+
+func (f *fallback) Duration(from, to Point) (time.Duration, error) {
+	if d, err := f.primary.Duration(from, to); err == nil {
+		return d, nil
+	}
+	return f.secondary.Duration(from, to)
+}
+
+func (f *fallback) Route(from, to Point) (*Route, error) {
+	if r, err := f.primary.Route(from, to); err == nil {
+		return r, nil
+	}
+	return f.secondary.Route(from, to)
+}
@@ -0,0 +1,646 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+)
+
+type memoryRider struct {
+	rider  ride.Rider
+	status string
+	cabID  string
+	offer  *ride.Offer
+	// declined are the cabs that declined or let expire an offer
+	declined map[string]struct{}
+}
+
+type memorySession struct {
+	session ride.Session
+	expires time.Time
+}
+
+type memoryCab struct {
+	state  ride.CabState
+	riders map[int]struct{}
+	stops  []ride.Stop
+}
+
+// Memory implements ride.LocationStore and ride.CabStore in process with
+// the same semantics as the Redis store. A single lock stands in for the
+// Lua scripts, so every method is atomic. State is lost on exit; it is
+// meant for tests and local development.
+type Memory struct {
+	mu       sync.Mutex
+	riders   map[int]*memoryRider
+	waiting  map[string]map[int]struct{}
+	cabs     map[string]*memoryCab
+	cells    map[string]map[string]struct{}
+	fares    map[string]float64
+	sessions map[string]*memorySession
+	offers   map[string]*ride.OfferStats
+}
+
+// NewMemoryStore function initialises the in-process stores
+func NewMemoryStore() *Memory {
+	return &Memory{
+		riders:   make(map[int]*memoryRider),
+		waiting:  make(map[string]map[int]struct{}),
+		cabs:     make(map[string]*memoryCab),
+		cells:    make(map[string]map[string]struct{}),
+		fares:    make(map[string]float64),
+		sessions: make(map[string]*memorySession),
+		offers:   make(map[string]*ride.OfferStats),
+	}
+}
+
+func (s *Memory) AddRider(ctx context.Context, rider ride.Rider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.rider(rider.ID)
+	r.rider = rider
+	r.status = "PENDING"
+	r.offer = nil
+	r.declined = nil
+
+	addTo(s.waiting, rider.Geohash, rider.ID)
+
+	return nil
+}
+
+func (s *Memory) RiderStatus(ctx context.Context, riderID int) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.riders[riderID]
+	if !ok {
+		return "", "", ride.ErrRiderNotFound
+	}
+
+	return r.status, r.cabID, nil
+}
+
+func (s *Memory) SetRiderStatus(ctx context.Context, riderID int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rider(riderID).status = status
+
+	return nil
+}
+
+func (s *Memory) RemoveFromWaitingPool(ctx context.Context, riderID int, geohash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removeFrom(s.waiting, geohash, riderID)
+
+	return nil
+}
+
+func (s *Memory) WaitingCount(ctx context.Context, geohash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.waiting[geohash])), nil
+}
+
+func (s *Memory) WaitingRiders(ctx context.Context, geohash string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.waiting[geohash]))
+	for id := range s.waiting[geohash] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (s *Memory) DeleteRider(ctx context.Context, riderID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.riders, riderID)
+
+	return nil
+}
+
+// CacheFare keeps the fare until ttl passes, like the Redis key expiring
+func (s *Memory) CacheFare(ctx context.Context, key string, amount float64, ttl time.Duration) error {
+	s.mu.Lock()
+	s.fares[key] = amount
+	s.mu.Unlock()
+
+	time.AfterFunc(ttl, func() {
+		s.mu.Lock()
+		delete(s.fares, key)
+		s.mu.Unlock()
+	})
+
+	return nil
+}
+
+func (s *Memory) SaveSession(ctx context.Context, session ride.Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.Epoch = 1
+	s.sessions[session.Token] = &memorySession{session: session, expires: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (s *Memory) Session(ctx context.Context, token string) (*ride.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.session(token)
+	if !ok {
+		return nil, ride.ErrSessionNotFound
+	}
+
+	session := m.session
+	return &session, nil
+}
+
+func (s *Memory) AttachSession(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.session(token)
+	if !ok {
+		return 0, ride.ErrSessionNotFound
+	}
+
+	m.session.Epoch++
+	m.expires = time.Now().Add(ttl)
+
+	return m.session.Epoch, nil
+}
+
+func (s *Memory) DeleteSession(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, token)
+
+	return nil
+}
+
+func (s *Memory) CabsInCells(ctx context.Context, cells []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var out []string
+
+	for _, cell := range cells {
+		for id := range s.cells[cell] {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			out = append(out, id)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
+
+func (s *Memory) Cab(ctx context.Context, cabID string) (*ride.CabState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cabs[cabID]
+	if !ok {
+		return nil, ride.ErrCabNotFound
+	}
+
+	state := c.state
+	return &state, nil
+}
+
+func (s *Memory) Stops(ctx context.Context, cabID string) ([]ride.Stop, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cabs[cabID]
+	if !ok || len(c.stops) == 0 {
+		return nil, nil
+	}
+
+	return append([]ride.Stop(nil), c.stops...), nil
+}
+
+func (s *Memory) Riders(ctx context.Context, cabID string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cabs[cabID]
+	if !ok {
+		return nil, nil
+	}
+
+	out := make([]int, 0, len(c.riders))
+	for id := range c.riders {
+		out = append(out, id)
+	}
+	sort.Ints(out)
+
+	return out, nil
+}
+
+func (s *Memory) AssignRider(ctx context.Context, cabID string, rider ride.Rider, version int64, stops []ride.Stop) (ride.AssignResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.assign(cabID, rider, version, stops, "MATCHED"), nil
+}
+
+func (s *Memory) OfferRider(ctx context.Context, cabID string, rider ride.Rider, version int64, stops []ride.Stop, expiresAt time.Time, job ride.JobRef) (ride.AssignResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := s.assign(cabID, rider, version, stops, string(ride.OfferOpen))
+	if result != ride.AssignOK {
+		return result, nil
+	}
+
+	s.rider(rider.ID).offer = &ride.Offer{
+		RiderID:   rider.ID,
+		CabID:     cabID,
+		Status:    ride.OfferOpen,
+		ExpiresAt: expiresAt,
+		Request:   rider,
+		Job:       job,
+	}
+	s.offerStats(cabID).Offered++
+
+	return result, nil
+}
+
+// assign adds the rider to the cab in the given status, the caller holds
+// the lock
+func (s *Memory) assign(cabID string, rider ride.Rider, version int64, stops []ride.Stop, status string) ride.AssignResult {
+	if r, ok := s.riders[rider.ID]; !ok || r.status != "PENDING" || r.rider.TripID != rider.TripID {
+		return ride.AssignStale
+	}
+
+	c, ok := s.cabs[cabID]
+	if ok && c.state.Status == ride.CabFull {
+		return ride.AssignFull
+	}
+	if !ok || c.state.Status != ride.CabAvailable {
+		return ride.AssignUnavailable
+	}
+
+	if rider.VehicleClass != "" && c.state.VehicleClass != rider.VehicleClass {
+		return ride.AssignUnavailable
+	}
+
+	if c.state.StopsVersion != version {
+		return ride.AssignRaceLost
+	}
+
+	// seats and luggage space are separate limits
+	if c.state.PassengerCount >= c.state.Capacity || c.state.LuggageCount+rider.Luggage > c.state.LuggageCapacity {
+		return ride.AssignFull
+	}
+
+	c.state.PassengerCount++
+	c.state.LuggageCount += rider.Luggage
+	c.stops = append([]ride.Stop(nil), stops...)
+	c.state.StopsVersion++
+	c.riders[rider.ID] = struct{}{}
+
+	r := s.rider(rider.ID)
+	r.status = status
+	r.cabID = cabID
+	r.rider.Luggage = rider.Luggage
+
+	// a matched rider no longer waits, an offered one until the driver accepts
+	if status == "MATCHED" {
+		removeFrom(s.waiting, r.rider.Geohash, rider.ID)
+	}
+
+	if c.state.PassengerCount >= c.state.Capacity {
+		c.state.Status = ride.CabFull
+	}
+
+	return ride.AssignOK
+}
+
+func (s *Memory) Offer(ctx context.Context, riderID int) (*ride.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.riders[riderID]
+	if !ok || r.offer == nil {
+		return nil, ride.ErrOfferNotFound
+	}
+
+	offer := *r.offer
+	return &offer, nil
+}
+
+func (s *Memory) AnswerOffer(ctx context.Context, cabID string, riderID int, status ride.OfferStatus, now time.Time) (*ride.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.riders[riderID]
+	if !ok || r.offer == nil || r.offer.CabID != cabID {
+		return nil, ride.ErrOfferNotFound
+	}
+
+	offer := r.offer
+	// drivers answering too late leave the offer to expire
+	if offer.Status != ride.OfferOpen || (status != ride.OfferExpired && now.After(offer.ExpiresAt)) {
+		return nil, ride.ErrOfferClosed
+	}
+
+	offer.Status = status
+
+	stats := s.offerStats(cabID)
+	switch status {
+	case ride.OfferAccepted:
+		stats.Accepted++
+		r.status = "MATCHED"
+		removeFrom(s.waiting, r.rider.Geohash, riderID)
+	case ride.OfferDeclined:
+		stats.Declined++
+	case ride.OfferExpired:
+		stats.Expired++
+	}
+
+	if status != ride.OfferAccepted {
+		// the rider waits for a match again, without this cab
+		s.releaseSeat(cabID, riderID)
+		r.status = "PENDING"
+		r.cabID = ""
+		if r.declined == nil {
+			r.declined = make(map[string]struct{})
+		}
+		r.declined[cabID] = struct{}{}
+	}
+
+	answered := *offer
+	return &answered, nil
+}
+
+func (s *Memory) DeclinedCabs(ctx context.Context, riderID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.riders[riderID]
+	if !ok {
+		return nil, nil
+	}
+
+	out := make([]string, 0, len(r.declined))
+	for id := range r.declined {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
+
+func (s *Memory) OfferStats(ctx context.Context, cabID string) (ride.OfferStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stats, ok := s.offers[cabID]; ok {
+		return *stats, nil
+	}
+	return ride.OfferStats{}, nil
+}
+
+func (s *Memory) ReleaseSeat(ctx context.Context, cabID string, riderID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// an offer still waiting for the driver is withdrawn
+	if r, ok := s.riders[riderID]; ok && r.offer != nil && r.offer.CabID == cabID && r.offer.Status == ride.OfferOpen {
+		r.offer.Status = ride.OfferWithdrawn
+	}
+
+	s.releaseSeat(cabID, riderID)
+
+	return nil
+}
+
+// releaseSeat frees the rider's seat, luggage space and stops, the caller
+// holds the lock
+func (s *Memory) releaseSeat(cabID string, riderID int) {
+	c, ok := s.cabs[cabID]
+	if !ok {
+		return
+	}
+
+	// releasing twice (e.g. cancel after drop-off) must not free a second seat
+	if _, ok := c.riders[riderID]; !ok {
+		return
+	}
+	delete(c.riders, riderID)
+	c.state.PassengerCount--
+
+	if r, ok := s.riders[riderID]; ok {
+		c.state.LuggageCount -= r.rider.Luggage
+	}
+
+	c.removeStops(riderID, "")
+
+	if c.state.PassengerCount < c.state.Capacity && c.state.Status == ride.CabFull {
+		c.state.Status = ride.CabAvailable
+	}
+}
+
+func (s *Memory) MarkPickedUp(ctx context.Context, cabID string, riderID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.cabs[cabID]; ok {
+		c.removeStops(riderID, ride.StopPickup)
+	}
+
+	return nil
+}
+
+func (s *Memory) GoOnline(ctx context.Context, cab ride.CabState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cabs[cab.ID]
+	if !ok {
+		c = &memoryCab{}
+		s.cabs[cab.ID] = c
+	}
+
+	if ok && c.state.Geohash != cab.Geohash {
+		removeFrom(s.cells, c.state.Geohash, cab.ID)
+	}
+
+	if !ok || c.state.Status == ride.CabOffline {
+		c.riders = make(map[int]struct{})
+		c.stops = nil
+		c.state.StopsVersion++
+		c.state.PassengerCount = 0
+		c.state.LuggageCount = 0
+		c.state.Status = ride.CabAvailable
+	}
+
+	c.state.ID = cab.ID
+	c.state.Latitude = cab.Latitude
+	c.state.Longitude = cab.Longitude
+	c.state.Geohash = cab.Geohash
+	c.state.Capacity = cab.Capacity
+	c.state.DriverID = cab.DriverID
+	c.state.LastUpdate = cab.LastUpdate
+	c.state.LuggageCapacity = cab.LuggageCapacity
+	c.state.VehicleClass = cab.VehicleClass
+
+	addTo(s.cells, cab.Geohash, cab.ID)
+
+	return nil
+}
+
+func (s *Memory) GoOffline(ctx context.Context, cabID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cabs[cabID]
+	if !ok || c.state.Status == ride.CabOffline {
+		return nil
+	}
+
+	if c.state.PassengerCount > 0 {
+		return ride.ErrCabHasPassengers
+	}
+
+	removeFrom(s.cells, c.state.Geohash, cabID)
+	c.state.Status = ride.CabOffline
+
+	return nil
+}
+
+func (s *Memory) UpdateLocation(ctx context.Context, cabID string, lat, lng float64, geohash string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cabs[cabID]
+	if !ok || c.state.Status == ride.CabOffline {
+		return ride.ErrCabOffline
+	}
+
+	if c.state.Geohash != geohash {
+		removeFrom(s.cells, c.state.Geohash, cabID)
+		addTo(s.cells, geohash, cabID)
+	}
+
+	c.state.Latitude = lat
+	c.state.Longitude = lng
+	c.state.Geohash = geohash
+	c.state.LastUpdate = now.Unix()
+
+	return nil
+}
+
+func (s *Memory) CountByStatus(ctx context.Context) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, c := range s.cabs {
+		counts[c.state.Status]++
+	}
+
+	return counts, nil
+}
+
+// rider returns the rider's entry, creating it the way HSET creates a hash
+func (s *Memory) rider(riderID int) *memoryRider {
+	r, ok := s.riders[riderID]
+	if !ok {
+		r = &memoryRider{rider: ride.Rider{ID: riderID}}
+		s.riders[riderID] = r
+	}
+	return r
+}
+
+// offerStats returns the cab's offer counters, creating them the way
+// HINCRBY creates a hash
+func (s *Memory) offerStats(cabID string) *ride.OfferStats {
+	stats, ok := s.offers[cabID]
+	if !ok {
+		stats = &ride.OfferStats{}
+		s.offers[cabID] = stats
+	}
+	return stats
+}
+
+// session returns the session unless it expired, expired sessions are
+// dropped the way Redis drops expired keys on access
+func (s *Memory) session(token string) (*memorySession, bool) {
+	m, ok := s.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(m.expires) {
+		delete(s.sessions, token)
+		return nil, false
+	}
+	return m, true
+}
+
+// removeStops drops the rider's stops of the given kind, all when kind is
+// empty, and bumps the stops version
+func (c *memoryCab) removeStops(riderID int, kind ride.StopKind) {
+	if c.stops == nil {
+		return
+	}
+
+	var kept []ride.Stop
+	for _, stop := range c.stops {
+		if stop.RiderID != riderID || (kind != "" && stop.Kind != kind) {
+			kept = append(kept, stop)
+		}
+	}
+
+	c.stops = kept
+	c.state.StopsVersion++
+}
+
+func addTo[K comparable, V comparable](sets map[K]map[V]struct{}, key K, v V) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[V]struct{})
+		sets[key] = set
+	}
+	set[v] = struct{}{}
+}
+
+func removeFrom[K comparable, V comparable](sets map[K]map[V]struct{}, key K, v V) {
+	set, ok := sets[key]
+	if !ok {
+		return
+	}
+	delete(set, v)
+	if len(set) == 0 {
+		delete(sets, key)
+	}
+}
+
+var (
+	_ ride.LocationStore = (*Memory)(nil)
+	_ ride.CabStore      = (*Memory)(nil)
+	_ ride.LocationStore = (*Redis)(nil)
+	_ ride.CabStore      = (*Redis)(nil)
+)
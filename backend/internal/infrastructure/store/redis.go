@@ -0,0 +1,912 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redis implements ride.LocationStore and ride.CabStore on Redis. Writes
+// that span several keys run as Lua scripts or MULTI pipelines.
+type Redis struct {
+	redisClient *redis.Client
+	logger      *slog.Logger
+}
+
+// NewRedisStore function initialises the Redis backed stores
+func NewRedisStore(redisClient *redis.Client, logger *slog.Logger) *Redis {
+	return &Redis{redisClient: redisClient, logger: logger}
+}
+
+// startSpan starts the span of a multi-key operation, named after the
+// store method it implements
+func startSpan(ctx context.Context, kind, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "redis."+kind+" "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationName(name)),
+	)
+}
+
+// eval runs a Lua script in a span of its own
+func (s *Redis) eval(ctx context.Context, name, script string, keys []string, args ...interface{}) *redis.Cmd {
+	ctx, span := startSpan(ctx, "script", name)
+	defer span.End()
+
+	cmd := s.redisClient.Eval(ctx, script, keys, args...)
+	if err := cmd.Err(); !errors.Is(err, redis.Nil) {
+		tracing.RecordError(span, err)
+	}
+	return cmd
+}
+
+func riderKey(riderID int) string {
+	return fmt.Sprintf("rider:%d", riderID)
+}
+
+func waitingKey(gh string) string {
+	return fmt.Sprintf("pool:cell:%s:waiting", gh)
+}
+
+func cabKey(cabID string) string {
+	return fmt.Sprintf("cab:%s", cabID)
+}
+
+func cabRidersKey(cabID string) string {
+	return fmt.Sprintf("cab:%s:riders", cabID)
+}
+
+func cabStopsKey(cabID string) string {
+	return fmt.Sprintf("cab:%s:stops", cabID)
+}
+
+func cellCabsKey(gh string) string {
+	return fmt.Sprintf("cell:%s:cabs", gh)
+}
+
+func sessionKey(token string) string {
+	return fmt.Sprintf("session:%s", token)
+}
+
+func offerKey(riderID int) string {
+	return fmt.Sprintf("offer:%d", riderID)
+}
+
+func declinedKey(riderID int) string {
+	return fmt.Sprintf("rider:%d:declined", riderID)
+}
+
+func cabOffersKey(cabID string) string {
+	return fmt.Sprintf("cab:%s:offers", cabID)
+}
+
+func (s *Redis) AddRider(ctx context.Context, rider ride.Rider) error {
+	ctx, span := startSpan(ctx, "tx", "AddRider")
+	defer span.End()
+
+	pipe := s.redisClient.TxPipeline()
+
+	pipe.HSet(ctx, riderKey(rider.ID), map[string]interface{}{
+		"lat":            rider.Latitude,
+		"lng":            rider.Longitude,
+		"drop_lat":       rider.DropLatitude,
+		"drop_lng":       rider.DropLongitude,
+		"luggage":        rider.Luggage,
+		"geohash":        rider.Geohash,
+		"trip_id":        rider.TripID,
+		"status":         "PENDING",
+		"last_update_ts": time.Now().Unix(),
+	})
+
+	pipe.SAdd(ctx, waitingKey(rider.Geohash), rider.ID)
+
+	pipe.Del(ctx, offerKey(rider.ID), declinedKey(rider.ID))
+
+	_, err := pipe.Exec(ctx)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (s *Redis) RiderStatus(ctx context.Context, riderID int) (string, string, error) {
+	vals, err := s.redisClient.HMGet(ctx, riderKey(riderID), "status", "cab_id").Result()
+	if err != nil {
+		return "", "", err
+	}
+
+	status, ok := vals[0].(string)
+	if !ok {
+		return "", "", ride.ErrRiderNotFound
+	}
+
+	cabID, _ := vals[1].(string)
+
+	return status, cabID, nil
+}
+
+func (s *Redis) SetRiderStatus(ctx context.Context, riderID int, status string) error {
+	return s.redisClient.HSet(ctx, riderKey(riderID), "status", status).Err()
+}
+
+func (s *Redis) RemoveFromWaitingPool(ctx context.Context, riderID int, geohash string) error {
+	return s.redisClient.SRem(ctx, waitingKey(geohash), riderID).Err()
+}
+
+func (s *Redis) WaitingCount(ctx context.Context, geohash string) (int64, error) {
+	return s.redisClient.SCard(ctx, waitingKey(geohash)).Result()
+}
+
+func (s *Redis) WaitingRiders(ctx context.Context, geohash string) ([]int, error) {
+	members, err := s.redisClient.SMembers(ctx, waitingKey(geohash)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.Atoi(m)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (s *Redis) DeleteRider(ctx context.Context, riderID int) error {
+	return s.redisClient.Del(ctx, riderKey(riderID), offerKey(riderID), declinedKey(riderID)).Err()
+}
+
+func (s *Redis) CacheFare(ctx context.Context, key string, amount float64, ttl time.Duration) error {
+	return s.redisClient.Set(ctx, key, amount, ttl).Err()
+}
+
+func (s *Redis) SaveSession(ctx context.Context, session ride.Session, ttl time.Duration) error {
+	ctx, span := startSpan(ctx, "tx", "SaveSession")
+	defer span.End()
+
+	rider, err := json.Marshal(session.Rider)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.HSet(ctx, sessionKey(session.Token), "rider", rider, "epoch", 1)
+	pipe.Expire(ctx, sessionKey(session.Token), ttl)
+
+	_, err = pipe.Exec(ctx)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (s *Redis) Session(ctx context.Context, token string) (*ride.Session, error) {
+	vals, err := s.redisClient.HMGet(ctx, sessionKey(token), "rider", "epoch").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := vals[0].(string)
+	if !ok {
+		return nil, ride.ErrSessionNotFound
+	}
+
+	session := &ride.Session{Token: token}
+	if err := json.Unmarshal([]byte(raw), &session.Rider); err != nil {
+		return nil, fmt.Errorf("decoding session: %w", err)
+	}
+	epoch, _ := vals[1].(string)
+	session.Epoch, _ = strconv.ParseInt(epoch, 10, 64)
+
+	return session, nil
+}
+
+// attachSessionScript bumps the epoch of an existing session only, HINCRBY
+// alone would create a session without a rider
+const attachSessionScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+local epoch = redis.call('HINCRBY', KEYS[1], 'epoch', 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return epoch
+`
+
+func (s *Redis) AttachSession(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	epoch, err := s.eval(ctx, "AttachSession", attachSessionScript, []string{sessionKey(token)}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if epoch < 0 {
+		return 0, ride.ErrSessionNotFound
+	}
+	return epoch, nil
+}
+
+func (s *Redis) DeleteSession(ctx context.Context, token string) error {
+	return s.redisClient.Del(ctx, sessionKey(token)).Err()
+}
+
+func (s *Redis) CabsInCells(ctx context.Context, cells []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var out []string
+
+	for _, cell := range cells {
+		ids, err := s.redisClient.SMembers(ctx, cellCabsKey(cell)).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			out = append(out, id)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *Redis) Cab(ctx context.Context, cabID string) (*ride.CabState, error) {
+	fields, err := s.redisClient.HGetAll(ctx, cabKey(cabID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, ride.ErrCabNotFound
+	}
+
+	lat, _ := strconv.ParseFloat(fields["lat"], 64)
+	lng, _ := strconv.ParseFloat(fields["lng"], 64)
+	driverID, _ := strconv.Atoi(fields["driver_id"])
+	passengerCount, _ := strconv.Atoi(fields["passenger_count"])
+	luggageCount, _ := strconv.Atoi(fields["luggage_count"])
+	capacity, _ := strconv.Atoi(fields["capacity"])
+	luggageCapacity, _ := strconv.Atoi(fields["luggage_capacity"])
+	stopsVersion, _ := strconv.ParseInt(fields["stops_version"], 10, 64)
+	lastUpdate, _ := strconv.ParseInt(fields["last_update_ts"], 10, 64)
+
+	return &ride.CabState{
+		ID:              cabID,
+		DriverID:        driverID,
+		Latitude:        lat,
+		Longitude:       lng,
+		Geohash:         fields["geohash"],
+		Status:          fields["status"],
+		PassengerCount:  passengerCount,
+		LuggageCount:    luggageCount,
+		Capacity:        capacity,
+		LuggageCapacity: luggageCapacity,
+		VehicleClass:    ride.VehicleClass(fields["vehicle_class"]),
+		StopsVersion:    stopsVersion,
+		LastUpdate:      lastUpdate,
+	}, nil
+}
+
+func (s *Redis) Stops(ctx context.Context, cabID string) ([]ride.Stop, error) {
+	raw, err := s.redisClient.Get(ctx, cabStopsKey(cabID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stops []ride.Stop
+	if err := json.Unmarshal(raw, &stops); err != nil {
+		return nil, err
+	}
+
+	return stops, nil
+}
+
+func (s *Redis) Riders(ctx context.Context, cabID string) ([]int, error) {
+	ids, err := s.redisClient.SMembers(ctx, cabRidersKey(cabID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]int, 0, len(ids))
+	for _, id := range ids {
+		riderID, err := strconv.Atoi(id)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Skipping malformed rider id", "rider_id", id, logging.CabID(cabID))
+			continue
+		}
+		out = append(out, riderID)
+	}
+
+	return out, nil
+}
+
+// assignRiderLua adds the rider to the cab unless it changed since the
+// plan was made or the rider stopped waiting for the request's trip. An
+// OFFERED rider also gets the offer hash, kept for the retention, and
+// counts towards the driver's offers.
+const assignRiderLua = `
+        -- KEYS[1] = cab key
+        -- KEYS[2] = rider key
+        -- KEYS[3] = cab riders set key
+        -- KEYS[4] = cab stops key
+        -- KEYS[5] = offer:{riderID}
+        -- KEYS[6] = cab:{id}:offers
+        -- KEYS[7] = waiting pool of the rider's cell
+        -- ARGV[1] = riderID
+        -- ARGV[2] = stops version the plan was computed from
+        -- ARGV[3] = planned stops (json)
+        -- ARGV[4] = rider's luggage
+        -- ARGV[5] = requested vehicle class, empty for any
+        -- ARGV[6] = rider status, MATCHED or OFFERED
+        -- ARGV[7] = offer deadline (unix ms)
+        -- ARGV[8] = offer retention (ms)
+        -- ARGV[9] = ride request the rider is offered for (json)
+        -- ARGV[10] = trip the ride request is for
+        -- ARGV[11] = retries of the job making the offer
+        -- ARGV[12] = request ID of the job making the offer
+
+        -- returns a ride.AssignResult:
+        -- 0 race lost, 1 assigned, 2 full, 3 unavailable, 4 stale
+
+        -- a cancelled rider's hash is gone, it must not be recreated
+        local rider = redis.call("HMGET", KEYS[2], "status", "trip_id")
+        if rider[1] ~= "PENDING" or rider[2] ~= ARGV[10] then
+            return 4
+        end
+
+        local status = redis.call("HGET", KEYS[1], "status")
+        if status == "FULL" then
+            return 2
+        end
+        if status ~= "AVAILABLE" then
+            return 3
+        end
+
+        if ARGV[5] ~= "" and redis.call("HGET", KEYS[1], "vehicle_class") ~= ARGV[5] then
+            return 3
+        end
+
+        local version = tonumber(redis.call("HGET", KEYS[1], "stops_version") or "0")
+        if version ~= tonumber(ARGV[2]) then
+            return 0
+        end
+
+        local passenger_count = tonumber(redis.call("HGET", KEYS[1], "passenger_count") or "0")
+        local luggage_count = tonumber(redis.call("HGET", KEYS[1], "luggage_count") or "0")
+        local capacity = tonumber(redis.call("HGET", KEYS[1], "capacity") or "4")
+        local luggage_capacity = tonumber(redis.call("HGET", KEYS[1], "luggage_capacity") or "0")
+        local luggage = tonumber(ARGV[4])
+
+        -- seats and luggage space are separate limits
+        if passenger_count >= capacity or (luggage_count + luggage) > luggage_capacity then
+            return 2
+        end
+
+        redis.call("HINCRBY", KEYS[1], "passenger_count", 1)
+        redis.call("HINCRBY", KEYS[1], "luggage_count", luggage)
+
+        redis.call("SET", KEYS[4], ARGV[3])
+        redis.call("HINCRBY", KEYS[1], "stops_version", 1)
+
+        local cab_id = string.sub(KEYS[1], 5)
+        redis.call("HSET", KEYS[2], "cab_id", cab_id)
+        redis.call("HSET", KEYS[2], "status", ARGV[6])
+        redis.call("HSET", KEYS[2], "luggage", luggage)
+
+        redis.call("SADD", KEYS[3], ARGV[1])
+
+        -- a matched rider no longer waits, an offered one until the driver accepts
+        if ARGV[6] == "MATCHED" then
+            redis.call("SREM", KEYS[7], ARGV[1])
+        end
+
+        if (passenger_count + 1) >= capacity then
+            redis.call("HSET", KEYS[1], "status", "FULL")
+        end
+
+        if ARGV[6] == "OFFERED" then
+            redis.call("DEL", KEYS[5])
+            redis.call("HSET", KEYS[5], "cab_id", cab_id, "status", "OFFERED", "expires_at", ARGV[7], "request", ARGV[9],
+                "retries", ARGV[11], "request_id", ARGV[12])
+            redis.call("PEXPIRE", KEYS[5], ARGV[8])
+            redis.call("HINCRBY", KEYS[6], "offered", 1)
+        end
+
+        return 1
+    `
+
+func (s *Redis) AssignRider(ctx context.Context, cabID string, rider ride.Rider, version int64, stops []ride.Stop) (ride.AssignResult, error) {
+	return s.assign(ctx, "AssignRider", cabID, rider, version, stops, "MATCHED", time.Time{}, ride.JobRef{})
+}
+
+func (s *Redis) OfferRider(ctx context.Context, cabID string, rider ride.Rider, version int64, stops []ride.Stop, expiresAt time.Time, job ride.JobRef) (ride.AssignResult, error) {
+	return s.assign(ctx, "OfferRider", cabID, rider, version, stops, string(ride.OfferOpen), expiresAt, job)
+}
+
+// assign runs assignRiderLua, leaving the rider in the given status
+func (s *Redis) assign(ctx context.Context, name, cabID string, rider ride.Rider, version int64, stops []ride.Stop, status string, expiresAt time.Time, job ride.JobRef) (ride.AssignResult, error) {
+	route, err := json.Marshal(stops)
+	if err != nil {
+		return ride.AssignRaceLost, err
+	}
+
+	request, err := json.Marshal(rider)
+	if err != nil {
+		return ride.AssignRaceLost, err
+	}
+
+	res, err := s.eval(
+		ctx,
+		name,
+		assignRiderLua,
+		[]string{cabKey(cabID), riderKey(rider.ID), cabRidersKey(cabID), cabStopsKey(cabID), offerKey(rider.ID), cabOffersKey(cabID), waitingKey(rider.Geohash)},
+		strconv.Itoa(rider.ID),
+		version,
+		route,
+		rider.Luggage,
+		string(rider.VehicleClass),
+		status,
+		expiresAt.UnixMilli(),
+		ride.OfferRetention.Milliseconds(),
+		request,
+		strconv.Itoa(rider.TripID),
+		job.Retries,
+		job.RequestID,
+	).Result()
+
+	if err != nil {
+		return ride.AssignRaceLost, err
+	}
+
+	code, okType := res.(int64)
+	if !okType {
+		return ride.AssignRaceLost, fmt.Errorf("unexpected Lua return type: %T", res)
+	}
+
+	return ride.AssignResult(code), nil
+}
+
+func (s *Redis) Offer(ctx context.Context, riderID int) (*ride.Offer, error) {
+	vals, err := s.redisClient.HMGet(ctx, offerKey(riderID), "cab_id", "status", "expires_at", "request", "retries", "request_id").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cabID, ok := vals[0].(string)
+	if !ok {
+		return nil, ride.ErrOfferNotFound
+	}
+
+	status, _ := vals[1].(string)
+	expiresAt, _ := vals[2].(string)
+	request, _ := vals[3].(string)
+	retries, _ := vals[4].(string)
+	requestID, _ := vals[5].(string)
+
+	return newOffer(riderID, cabID, status, expiresAt, request, retries, requestID), nil
+}
+
+func (s *Redis) AnswerOffer(ctx context.Context, cabID string, riderID int, status ride.OfferStatus, now time.Time) (*ride.Offer, error) {
+	lua := releaseSeatLua + `
+    -- KEYS[1] = offer:{riderID}
+    -- KEYS[2] = cab:{id}
+    -- KEYS[3] = cab:{id}:riders
+    -- KEYS[4] = cab:{id}:stops
+    -- KEYS[5] = rider:{id}
+    -- KEYS[6] = rider:{id}:declined
+    -- KEYS[7] = cab:{id}:offers
+    -- ARGV[1] = riderID
+    -- ARGV[2] = cabID
+    -- ARGV[3] = answer, ACCEPTED, DECLINED or EXPIRED
+    -- ARGV[4] = now (unix ms)
+    -- ARGV[5] = retention (ms)
+
+    -- returns the offer's deadline, request and the retries and request ID
+    -- of its job once closed, nil without an offer with the cab and an
+    -- empty table if the offer is not open
+    if redis.call("HGET", KEYS[1], "cab_id") ~= ARGV[2] then
+        return false
+    end
+
+    local status = redis.call("HGET", KEYS[1], "status")
+    local expires_at = redis.call("HGET", KEYS[1], "expires_at")
+    local request = redis.call("HGET", KEYS[1], "request") or ""
+    local retries = redis.call("HGET", KEYS[1], "retries") or "0"
+    local request_id = redis.call("HGET", KEYS[1], "request_id") or ""
+    if status ~= "OFFERED" then
+        return {}
+    end
+
+    -- drivers answering too late leave the offer to expire
+    if ARGV[3] ~= "EXPIRED" and tonumber(ARGV[4]) > tonumber(expires_at) then
+        return {}
+    end
+
+    redis.call("HSET", KEYS[1], "status", ARGV[3])
+    redis.call("HINCRBY", KEYS[7], string.lower(ARGV[3]), 1)
+
+    if ARGV[3] == "ACCEPTED" then
+        redis.call("HSET", KEYS[5], "status", "MATCHED")
+        local geohash = redis.call("HGET", KEYS[5], "geohash")
+        if geohash then
+            redis.call("SREM", "pool:cell:" .. geohash .. ":waiting", ARGV[1])
+        end
+        return {expires_at, request, retries, request_id}
+    end
+
+    -- the rider waits for a match again, without this cab
+    release_seat(KEYS[2], KEYS[3], KEYS[4], KEYS[5], ARGV[1])
+    redis.call("HSET", KEYS[5], "status", "PENDING")
+    redis.call("HDEL", KEYS[5], "cab_id")
+    redis.call("SADD", KEYS[6], ARGV[2])
+    redis.call("PEXPIRE", KEYS[6], ARGV[5])
+
+    return {expires_at, request, retries, request_id}
+    `
+
+	res, err := s.eval(
+		ctx,
+		"AnswerOffer",
+		lua,
+		[]string{offerKey(riderID), cabKey(cabID), cabRidersKey(cabID), cabStopsKey(cabID), riderKey(riderID), declinedKey(riderID), cabOffersKey(cabID)},
+		riderID,
+		cabID,
+		string(status),
+		now.UnixMilli(),
+		ride.OfferRetention.Milliseconds(),
+	).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return nil, ride.ErrOfferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, ride.ErrOfferClosed
+	}
+	if len(res) != 4 {
+		return nil, fmt.Errorf("unexpected Lua result: %v", res)
+	}
+
+	return newOffer(riderID, cabID, string(status), res[0], res[1], res[2], res[3]), nil
+}
+
+func (s *Redis) DeclinedCabs(ctx context.Context, riderID int) ([]string, error) {
+	return s.redisClient.SMembers(ctx, declinedKey(riderID)).Result()
+}
+
+func (s *Redis) OfferStats(ctx context.Context, cabID string) (ride.OfferStats, error) {
+	fields, err := s.redisClient.HGetAll(ctx, cabOffersKey(cabID)).Result()
+	if err != nil {
+		return ride.OfferStats{}, err
+	}
+
+	offered, _ := strconv.Atoi(fields["offered"])
+	accepted, _ := strconv.Atoi(fields["accepted"])
+	declined, _ := strconv.Atoi(fields["declined"])
+	expired, _ := strconv.Atoi(fields["expired"])
+
+	return ride.OfferStats{
+		Offered:  offered,
+		Accepted: accepted,
+		Declined: declined,
+		Expired:  expired,
+	}, nil
+}
+
+// newOffer reads an offer from the fields of its hash. A request that does
+// not decode leaves Request empty.
+func newOffer(riderID int, cabID, status, expiresAt, request, retries, requestID string) *ride.Offer {
+	ms, _ := strconv.ParseInt(expiresAt, 10, 64)
+	n, _ := strconv.Atoi(retries)
+
+	offer := &ride.Offer{
+		RiderID:   riderID,
+		CabID:     cabID,
+		Status:    ride.OfferStatus(status),
+		ExpiresAt: time.UnixMilli(ms),
+		Job:       ride.JobRef{Retries: n, RequestID: requestID},
+	}
+	_ = json.Unmarshal([]byte(request), &offer.Request)
+
+	return offer
+}
+
+// removeStopsLua drops a rider's stops from a cab's route, every stop when
+// kind is empty. The stops version is bumped so plans computed against the
+// old route fail to commit.
+const removeStopsLua = `
+    local function remove_stops(cab_key, stops_key, rider_id, kind)
+        local raw = redis.call("GET", stops_key)
+        if not raw then
+            return
+        end
+
+        local kept = {}
+        for _, stop in ipairs(cjson.decode(raw)) do
+            if tostring(stop.rider_id) ~= rider_id or (kind ~= "" and stop.kind ~= kind) then
+                table.insert(kept, stop)
+            end
+        end
+
+        -- cjson encodes an empty table as an object, drop the key instead
+        if #kept == 0 then
+            redis.call("DEL", stops_key)
+        else
+            redis.call("SET", stops_key, cjson.encode(kept))
+        end
+        redis.call("HINCRBY", cab_key, "stops_version", 1)
+    end
+`
+
+// releaseSeatLua frees a rider's seat, luggage space and stops. Releasing
+// a rider no longer in the cab does nothing.
+const releaseSeatLua = removeStopsLua + `
+    local function release_seat(cab_key, riders_key, stops_key, rider_key, rider_id)
+        -- releasing twice (e.g. cancel after drop-off) must not free a second seat
+        if redis.call("SREM", riders_key, rider_id) == 0 then
+            return
+        end
+        redis.call("HINCRBY", cab_key, "passenger_count", -1)
+
+        local luggage = tonumber(redis.call("HGET", rider_key, "luggage") or "0")
+        if luggage > 0 then
+            redis.call("HINCRBY", cab_key, "luggage_count", -luggage)
+        end
+
+        remove_stops(cab_key, stops_key, rider_id, "")
+
+        local capacity = tonumber(redis.call("HGET", cab_key, "capacity"))
+        local pc = tonumber(redis.call("HGET", cab_key, "passenger_count"))
+
+        if pc < capacity and redis.call("HGET", cab_key, "status") == "FULL" then
+            redis.call("HSET", cab_key, "status", "AVAILABLE")
+        end
+    end
+`
+
+func (s *Redis) ReleaseSeat(ctx context.Context, cabID string, riderID int) error {
+	lua := releaseSeatLua + `
+    -- KEYS[1] = cab:{id}
+    -- KEYS[2] = cab:{id}:riders
+    -- KEYS[3] = cab:{id}:stops
+    -- KEYS[4] = rider:{id}
+    -- KEYS[5] = offer:{riderID}
+    -- ARGV[1] = riderID
+    -- ARGV[2] = cabID
+
+    -- an offer still waiting for the driver is withdrawn
+    if redis.call("HGET", KEYS[5], "cab_id") == ARGV[2] and redis.call("HGET", KEYS[5], "status") == "OFFERED" then
+        redis.call("HSET", KEYS[5], "status", "WITHDRAWN")
+    end
+
+    release_seat(KEYS[1], KEYS[2], KEYS[3], KEYS[4], ARGV[1])
+
+    return 1
+    `
+
+	return s.eval(
+		ctx,
+		"ReleaseSeat",
+		lua,
+		[]string{cabKey(cabID), cabRidersKey(cabID), cabStopsKey(cabID), riderKey(riderID), offerKey(riderID)},
+		riderID,
+		cabID,
+	).Err()
+}
+
+func (s *Redis) MarkPickedUp(ctx context.Context, cabID string, riderID int) error {
+	lua := removeStopsLua + `
+    -- KEYS[1] = cab:{id}
+    -- KEYS[2] = cab:{id}:stops
+    -- ARGV[1] = riderID
+
+    remove_stops(KEYS[1], KEYS[2], ARGV[1], "PICKUP")
+    return 1
+    `
+
+	return s.eval(ctx, "MarkPickedUp", lua, []string{cabKey(cabID), cabStopsKey(cabID)}, riderID).Err()
+}
+
+func (s *Redis) GoOnline(ctx context.Context, cab ride.CabState) error {
+	lua := `
+    -- KEYS[1] = cab:{id}
+    -- KEYS[2] = cab:{id}:riders
+    -- KEYS[3] = cell:{geohash}:cabs
+    -- KEYS[4] = cab:{id}:stops
+    -- ARGV[1] = cabID
+    -- ARGV[2] = lat
+    -- ARGV[3] = lng
+    -- ARGV[4] = geohash
+    -- ARGV[5] = capacity
+    -- ARGV[6] = driverID
+    -- ARGV[7] = now
+    -- ARGV[8] = luggage capacity
+    -- ARGV[9] = vehicle class
+
+    local status = redis.call("HGET", KEYS[1], "status")
+    local old = redis.call("HGET", KEYS[1], "geohash")
+
+    if old and old ~= ARGV[4] then
+        redis.call("SREM", "cell:" .. old .. ":cabs", ARGV[1])
+    end
+
+    if (not status) or status == "OFFLINE" then
+        redis.call("DEL", KEYS[2], KEYS[4])
+        redis.call("HINCRBY", KEYS[1], "stops_version", 1)
+        redis.call("HSET", KEYS[1],
+            "passenger_count", 0,
+            "luggage_count", 0,
+            "status", "AVAILABLE")
+    end
+
+    redis.call("HSET", KEYS[1],
+        "lat", ARGV[2],
+        "lng", ARGV[3],
+        "geohash", ARGV[4],
+        "capacity", ARGV[5],
+        "driver_id", ARGV[6],
+        "last_update_ts", ARGV[7],
+        "luggage_capacity", ARGV[8],
+        "vehicle_class", ARGV[9])
+
+    redis.call("SADD", KEYS[3], ARGV[1])
+
+    return 1
+    `
+
+	return s.eval(
+		ctx,
+		"GoOnline",
+		lua,
+		[]string{cabKey(cab.ID), cabRidersKey(cab.ID), cellCabsKey(cab.Geohash), cabStopsKey(cab.ID)},
+		cab.ID,
+		cab.Latitude,
+		cab.Longitude,
+		cab.Geohash,
+		cab.Capacity,
+		cab.DriverID,
+		cab.LastUpdate,
+		cab.LuggageCapacity,
+		string(cab.VehicleClass),
+	).Err()
+}
+
+func (s *Redis) GoOffline(ctx context.Context, cabID string) error {
+	lua := `
+    -- KEYS[1] = cab:{id}
+    -- ARGV[1] = cabID
+
+    local status = redis.call("HGET", KEYS[1], "status")
+    if (not status) or status == "OFFLINE" then
+        return 1
+    end
+
+    local pc = tonumber(redis.call("HGET", KEYS[1], "passenger_count") or "0")
+    if pc > 0 then
+        return -1
+    end
+
+    local old = redis.call("HGET", KEYS[1], "geohash")
+    if old then
+        redis.call("SREM", "cell:" .. old .. ":cabs", ARGV[1])
+    end
+
+    redis.call("HSET", KEYS[1], "status", "OFFLINE")
+
+    return 1
+    `
+
+	res, err := s.eval(ctx, "GoOffline", lua, []string{cabKey(cabID)}, cabID).Int()
+	if err != nil {
+		return err
+	}
+
+	if res == -1 {
+		return ride.ErrCabHasPassengers
+	}
+
+	return nil
+}
+
+func (s *Redis) UpdateLocation(ctx context.Context, cabID string, lat, lng float64, geohash string, now time.Time) error {
+	lua := `
+    -- KEYS[1] = cab:{id}
+    -- KEYS[2] = cell:{geohash}:cabs
+    -- ARGV[1] = cabID
+    -- ARGV[2] = lat
+    -- ARGV[3] = lng
+    -- ARGV[4] = geohash
+    -- ARGV[5] = now
+
+    local status = redis.call("HGET", KEYS[1], "status")
+    if (not status) or status == "OFFLINE" then
+        return 0
+    end
+
+    local old = redis.call("HGET", KEYS[1], "geohash")
+    if old ~= ARGV[4] then
+        if old then
+            redis.call("SREM", "cell:" .. old .. ":cabs", ARGV[1])
+        end
+        redis.call("SADD", KEYS[2], ARGV[1])
+    end
+
+    redis.call("HSET", KEYS[1],
+        "lat", ARGV[2],
+        "lng", ARGV[3],
+        "geohash", ARGV[4],
+        "last_update_ts", ARGV[5])
+
+    return 1
+    `
+
+	res, err := s.eval(
+		ctx,
+		"UpdateLocation",
+		lua,
+		[]string{cabKey(cabID), cellCabsKey(geohash)},
+		cabID,
+		lat,
+		lng,
+		geohash,
+		now.Unix(),
+	).Int()
+	if err != nil {
+		return err
+	}
+
+	if res == 0 {
+		return ride.ErrCabOffline
+	}
+
+	return nil
+}
+
+// CountByStatus scans the cab:{id} hashes, skipping the riders and stops keys
+func (s *Redis) CountByStatus(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	iter := s.redisClient.Scan(ctx, 0, "cab:*", 500).Iterator()
+
+	var keys []string
+	for iter.Next(ctx) {
+		if key := iter.Val(); strings.Count(key, ":") == 1 {
+			keys = append(keys, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	pipe := s.redisClient.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGet(ctx, key, "status")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	for _, cmd := range cmds {
+		if status, err := cmd.Result(); err == nil {
+			counts[status]++
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,555 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/store"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testCab  = "cab-1"
+	testCell = "tsp9d2"
+)
+
+// liveStore is what both stores implement
+type liveStore interface {
+	ride.LocationStore
+	ride.CabStore
+}
+
+// eachStore runs the test against the in-memory store and against the
+// Redis store on miniredis, both have to behave the same
+func eachStore(t *testing.T, test func(t *testing.T, s liveStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, store.NewMemoryStore())
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		test(t, store.NewRedisStore(client, slog.New(slog.DiscardHandler)))
+	})
+}
+
+// sedan is an empty online cab with room for capacity riders and two bags
+func sedan(capacity int) ride.CabState {
+	return ride.CabState{ID: testCab, DriverID: 1, Geohash: testCell, Capacity: capacity, LuggageCapacity: 2, VehicleClass: ride.VehicleSedan}
+}
+
+// tripStops are the rider's pickup and drop
+func tripStops(rider ride.Rider) []ride.Stop {
+	return []ride.Stop{
+		{RiderID: rider.ID, TripID: rider.TripID, Kind: ride.StopPickup, Seats: 1, Luggage: rider.Luggage},
+		{RiderID: rider.ID, TripID: rider.TripID, Kind: ride.StopDrop, Seats: 1, Luggage: rider.Luggage},
+	}
+}
+
+// waiting adds the rider to the store as PENDING
+func waiting(t *testing.T, s liveStore, id, luggage int) ride.Rider {
+	t.Helper()
+
+	rider := ride.Rider{ID: id, TripID: 100 + id, Geohash: testCell, Luggage: luggage}
+	if err := s.AddRider(context.Background(), rider); err != nil {
+		t.Fatalf("AddRider: %v", err)
+	}
+	return rider
+}
+
+// seat assigns the rider to testCab at its current stops version
+func seat(t *testing.T, s liveStore, rider ride.Rider, stops []ride.Stop) {
+	t.Helper()
+	ctx := context.Background()
+
+	cab, err := s.Cab(ctx, testCab)
+	if err != nil {
+		t.Fatalf("Cab: %v", err)
+	}
+	if result, err := s.AssignRider(ctx, testCab, rider, cab.StopsVersion, stops); err != nil || result != ride.AssignOK {
+		t.Fatalf("AssignRider = %v, %v", result, err)
+	}
+}
+
+func TestAssignRider(t *testing.T) {
+	tests := []struct {
+		name     string
+		cab      *ride.CabState // nil leaves the cab offline
+		seated   int            // riders already in the cab
+		luggage  int
+		class    ride.VehicleClass
+		stale    bool // plan against an outdated stops version
+		want     ride.AssignResult
+		wantCab  string // cab status afterwards
+		wantSeat int    // passengers afterwards
+	}{
+		{name: "assigned", cab: ptr(sedan(2)), luggage: 1, want: ride.AssignOK, wantCab: ride.CabAvailable, wantSeat: 1},
+		{name: "last seat fills the cab", cab: ptr(sedan(2)), seated: 1, want: ride.AssignOK, wantCab: ride.CabFull, wantSeat: 2},
+		{name: "race lost", cab: ptr(sedan(2)), stale: true, want: ride.AssignRaceLost, wantCab: ride.CabAvailable},
+		{name: "no seat left", cab: ptr(sedan(1)), seated: 1, want: ride.AssignFull, wantCab: ride.CabFull, wantSeat: 1},
+		{name: "no luggage space left", cab: ptr(sedan(2)), luggage: 3, want: ride.AssignFull, wantCab: ride.CabAvailable},
+		{name: "other vehicle class", cab: ptr(sedan(2)), class: ride.VehicleSUV, want: ride.AssignUnavailable, wantCab: ride.CabAvailable},
+		{name: "cab offline", want: ride.AssignUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eachStore(t, func(t *testing.T, s liveStore) {
+				ctx := context.Background()
+
+				if tt.cab != nil {
+					if err := s.GoOnline(ctx, *tt.cab); err != nil {
+						t.Fatalf("GoOnline: %v", err)
+					}
+				}
+
+				var stops []ride.Stop
+				for i := range tt.seated {
+					rider := waiting(t, s, 10+i, 0)
+					stops = append(stops, tripStops(rider)...)
+					seat(t, s, rider, stops)
+				}
+
+				var version int64
+				if cab, err := s.Cab(ctx, testCab); err == nil {
+					version = cab.StopsVersion
+				}
+				if tt.stale {
+					version--
+				}
+
+				rider := waiting(t, s, 1, tt.luggage)
+				rider.VehicleClass = tt.class
+				planned := append(append([]ride.Stop(nil), stops...), tripStops(rider)...)
+
+				got, err := s.AssignRider(ctx, testCab, rider, version, planned)
+				if err != nil {
+					t.Fatalf("AssignRider: %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("AssignRider = %v, want %v", got, tt.want)
+				}
+
+				if tt.cab == nil {
+					return
+				}
+
+				cab, err := s.Cab(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Cab: %v", err)
+				}
+				if cab.Status != tt.wantCab || cab.PassengerCount != tt.wantSeat {
+					t.Errorf("cab is %s with %d passengers, want %s with %d", cab.Status, cab.PassengerCount, tt.wantCab, tt.wantSeat)
+				}
+
+				status, cabID, err := s.RiderStatus(ctx, rider.ID)
+				if err != nil {
+					t.Fatalf("RiderStatus: %v", err)
+				}
+
+				if tt.want != ride.AssignOK {
+					if status != "PENDING" || cabID != "" {
+						t.Errorf("rider is %s in %q, want PENDING", status, cabID)
+					}
+					return
+				}
+
+				if status != "MATCHED" || cabID != testCab {
+					t.Errorf("rider is %s in %q, want MATCHED in %s", status, cabID, testCab)
+				}
+				if cab.LuggageCount != tt.luggage {
+					t.Errorf("cab carries %d bags, want %d", cab.LuggageCount, tt.luggage)
+				}
+
+				route, err := s.Stops(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Stops: %v", err)
+				}
+				if !reflect.DeepEqual(route, planned) {
+					t.Errorf("stops = %+v, want %+v", route, planned)
+				}
+			})
+		})
+	}
+}
+
+func TestAssignRiderStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		before func(ctx context.Context, s liveStore, rider ride.Rider)
+		gone   bool // whether the rider's state must stay deleted
+	}{
+		{
+			name: "rider cancelled",
+			before: func(ctx context.Context, s liveStore, rider ride.Rider) {
+				s.DeleteRider(ctx, rider.ID)
+			},
+			gone: true,
+		},
+		{
+			name: "rider asked again",
+			before: func(ctx context.Context, s liveStore, rider ride.Rider) {
+				rider.TripID++
+				s.AddRider(ctx, rider)
+			},
+		},
+		{
+			name: "rider matched already",
+			before: func(ctx context.Context, s liveStore, rider ride.Rider) {
+				s.SetRiderStatus(ctx, rider.ID, "MATCHED")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eachStore(t, func(t *testing.T, s liveStore) {
+				ctx := context.Background()
+
+				if err := s.GoOnline(ctx, sedan(2)); err != nil {
+					t.Fatalf("GoOnline: %v", err)
+				}
+
+				rider := waiting(t, s, 1, 1)
+				tt.before(ctx, s, rider)
+
+				cab, err := s.Cab(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Cab: %v", err)
+				}
+
+				got, err := s.AssignRider(ctx, testCab, rider, cab.StopsVersion, tripStops(rider))
+				if err != nil || got != ride.AssignStale {
+					t.Fatalf("AssignRider = %v, %v, want stale", got, err)
+				}
+
+				cab, err = s.Cab(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Cab: %v", err)
+				}
+				if cab.PassengerCount != 0 || cab.LuggageCount != 0 {
+					t.Errorf("cab has %d passengers and %d bags, want it empty", cab.PassengerCount, cab.LuggageCount)
+				}
+
+				_, _, err = s.RiderStatus(ctx, rider.ID)
+				if gone := errors.Is(err, ride.ErrRiderNotFound); gone != tt.gone {
+					t.Errorf("RiderStatus err = %v, rider gone = %v", err, tt.gone)
+				}
+			})
+		})
+	}
+}
+
+func TestWaitingPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   func(ctx context.Context, s liveStore, rider ride.Rider, version int64) error
+		waiting int64 // riders left in the cell's waiting pool
+	}{
+		{
+			name: "assigned",
+			match: func(ctx context.Context, s liveStore, rider ride.Rider, version int64) error {
+				_, err := s.AssignRider(ctx, testCab, rider, version, tripStops(rider))
+				return err
+			},
+		},
+		{
+			name: "offered",
+			match: func(ctx context.Context, s liveStore, rider ride.Rider, version int64) error {
+				_, err := s.OfferRider(ctx, testCab, rider, version, tripStops(rider), time.Now().Add(time.Minute), ride.JobRef{})
+				return err
+			},
+			waiting: 1,
+		},
+		{
+			name: "offer accepted",
+			match: func(ctx context.Context, s liveStore, rider ride.Rider, version int64) error {
+				if _, err := s.OfferRider(ctx, testCab, rider, version, tripStops(rider), time.Now().Add(time.Minute), ride.JobRef{}); err != nil {
+					return err
+				}
+				_, err := s.AnswerOffer(ctx, testCab, rider.ID, ride.OfferAccepted, time.Now())
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eachStore(t, func(t *testing.T, s liveStore) {
+				ctx := context.Background()
+
+				if err := s.GoOnline(ctx, sedan(2)); err != nil {
+					t.Fatalf("GoOnline: %v", err)
+				}
+
+				rider := waiting(t, s, 1, 0)
+
+				cab, err := s.Cab(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Cab: %v", err)
+				}
+				if err := tt.match(ctx, s, rider, cab.StopsVersion); err != nil {
+					t.Fatalf("match: %v", err)
+				}
+
+				got, err := s.WaitingCount(ctx, testCell)
+				if err != nil || got != tt.waiting {
+					t.Errorf("WaitingCount = %d, %v, want %d", got, err, tt.waiting)
+				}
+			})
+		})
+	}
+}
+
+func TestAnswerOffer(t *testing.T) {
+	// deadline is when the offers made by the test expire
+	deadline := time.Now().Add(time.Minute).Truncate(time.Second)
+	// job is the matching job making the offers
+	job := ride.JobRef{Retries: 2, RequestID: "req-1"}
+
+	tests := []struct {
+		name      string
+		before    func(ctx context.Context, s liveStore, rider ride.Rider) // runs between offer and answer
+		cabID     string
+		status    ride.OfferStatus
+		now       time.Time
+		wantErr   error
+		wantOffer ride.OfferStatus // the offer afterwards
+		wantRider string
+		seated    bool // whether the rider keeps their seat
+		declined  bool // whether the cab is kept out of the rider's matching
+	}{
+		{
+			name:      "accepted",
+			status:    ride.OfferAccepted,
+			now:       deadline.Add(-time.Second),
+			wantOffer: ride.OfferAccepted,
+			wantRider: "MATCHED",
+			seated:    true,
+		},
+		{
+			name:      "declined",
+			status:    ride.OfferDeclined,
+			now:       deadline.Add(-time.Second),
+			wantOffer: ride.OfferDeclined,
+			wantRider: "PENDING",
+			declined:  true,
+		},
+		{
+			name:      "expired",
+			status:    ride.OfferExpired,
+			now:       deadline.Add(time.Second),
+			wantOffer: ride.OfferExpired,
+			wantRider: "PENDING",
+			declined:  true,
+		},
+		{
+			name:      "accepted after the deadline",
+			status:    ride.OfferAccepted,
+			now:       deadline.Add(time.Second),
+			wantErr:   ride.ErrOfferClosed,
+			wantOffer: ride.OfferOpen,
+			wantRider: string(ride.OfferOpen),
+			seated:    true,
+		},
+		{
+			name: "answered twice",
+			before: func(ctx context.Context, s liveStore, rider ride.Rider) {
+				s.AnswerOffer(ctx, testCab, rider.ID, ride.OfferDeclined, deadline.Add(-time.Second))
+			},
+			status:    ride.OfferAccepted,
+			now:       deadline.Add(-time.Second),
+			wantErr:   ride.ErrOfferClosed,
+			wantOffer: ride.OfferDeclined,
+			wantRider: "PENDING",
+			declined:  true,
+		},
+		{
+			name: "rider cancelled",
+			before: func(ctx context.Context, s liveStore, rider ride.Rider) {
+				s.ReleaseSeat(ctx, testCab, rider.ID)
+			},
+			status:    ride.OfferAccepted,
+			now:       deadline.Add(-time.Second),
+			wantErr:   ride.ErrOfferClosed,
+			wantOffer: ride.OfferWithdrawn,
+			wantRider: string(ride.OfferOpen),
+		},
+		{
+			name:      "another cab",
+			cabID:     "cab-2",
+			status:    ride.OfferAccepted,
+			now:       deadline.Add(-time.Second),
+			wantErr:   ride.ErrOfferNotFound,
+			wantOffer: ride.OfferOpen,
+			wantRider: string(ride.OfferOpen),
+			seated:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eachStore(t, func(t *testing.T, s liveStore) {
+				ctx := context.Background()
+
+				if err := s.GoOnline(ctx, sedan(2)); err != nil {
+					t.Fatalf("GoOnline: %v", err)
+				}
+
+				rider := waiting(t, s, 1, 1)
+				cab, err := s.Cab(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Cab: %v", err)
+				}
+				if result, err := s.OfferRider(ctx, testCab, rider, cab.StopsVersion, tripStops(rider), deadline, job); err != nil || result != ride.AssignOK {
+					t.Fatalf("OfferRider = %v, %v", result, err)
+				}
+
+				if tt.before != nil {
+					tt.before(ctx, s, rider)
+				}
+
+				cabID := tt.cabID
+				if cabID == "" {
+					cabID = testCab
+				}
+
+				answered, err := s.AnswerOffer(ctx, cabID, rider.ID, tt.status, tt.now)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("AnswerOffer err = %v, want %v", err, tt.wantErr)
+				}
+				if err == nil && (answered.Status != tt.status || answered.CabID != testCab || answered.Request.ID != rider.ID || answered.Job != job) {
+					t.Errorf("AnswerOffer = %+v, want a %s offer of rider:%d with %s made by %+v", answered, tt.status, rider.ID, testCab, job)
+				}
+
+				offer, err := s.Offer(ctx, rider.ID)
+				if err != nil {
+					t.Fatalf("Offer: %v", err)
+				}
+				if offer.Status != tt.wantOffer {
+					t.Errorf("offer is %s, want %s", offer.Status, tt.wantOffer)
+				}
+				if !offer.ExpiresAt.Equal(deadline) {
+					t.Errorf("offer expires at %v, want %v", offer.ExpiresAt, deadline)
+				}
+				if offer.Job != job {
+					t.Errorf("offer was made by %+v, want %+v", offer.Job, job)
+				}
+
+				if status, _, err := s.RiderStatus(ctx, rider.ID); err != nil || status != tt.wantRider {
+					t.Errorf("rider is %s (%v), want %s", status, err, tt.wantRider)
+				}
+
+				cab, err = s.Cab(ctx, testCab)
+				if err != nil {
+					t.Fatalf("Cab: %v", err)
+				}
+				if seated := cab.PassengerCount == 1 && cab.LuggageCount == 1; seated != tt.seated {
+					t.Errorf("cab has %d passengers and %d bags, rider seated = %v", cab.PassengerCount, cab.LuggageCount, tt.seated)
+				}
+
+				declined, err := s.DeclinedCabs(ctx, rider.ID)
+				if err != nil {
+					t.Fatalf("DeclinedCabs: %v", err)
+				}
+				if got := len(declined) == 1 && declined[0] == testCab; got != tt.declined {
+					t.Errorf("declined cabs = %v, want %s declined = %v", declined, testCab, tt.declined)
+				}
+			})
+		})
+	}
+}
+
+func TestReleaseSeat(t *testing.T) {
+	eachStore(t, func(t *testing.T, s liveStore) {
+		ctx := context.Background()
+
+		if err := s.GoOnline(ctx, sedan(2)); err != nil {
+			t.Fatalf("GoOnline: %v", err)
+		}
+
+		first := waiting(t, s, 1, 1)
+		second := waiting(t, s, 2, 1)
+		seat(t, s, first, tripStops(first))
+		seat(t, s, second, append(tripStops(first), tripStops(second)...))
+
+		// releasing twice, e.g. a cancel after the drop-off, frees one seat
+		for range 2 {
+			if err := s.ReleaseSeat(ctx, testCab, first.ID); err != nil {
+				t.Fatalf("ReleaseSeat: %v", err)
+			}
+		}
+
+		cab, err := s.Cab(ctx, testCab)
+		if err != nil {
+			t.Fatalf("Cab: %v", err)
+		}
+		if cab.Status != ride.CabAvailable || cab.PassengerCount != 1 || cab.LuggageCount != 1 {
+			t.Errorf("cab is %s with %d passengers and %d bags, want AVAILABLE with 1 and 1", cab.Status, cab.PassengerCount, cab.LuggageCount)
+		}
+
+		stops, err := s.Stops(ctx, testCab)
+		if err != nil {
+			t.Fatalf("Stops: %v", err)
+		}
+		if want := tripStops(second); !reflect.DeepEqual(stops, want) {
+			t.Errorf("stops = %+v, want %+v", stops, want)
+		}
+
+		riders, err := s.Riders(ctx, testCab)
+		if err != nil {
+			t.Fatalf("Riders: %v", err)
+		}
+		if !reflect.DeepEqual(riders, []int{second.ID}) {
+			t.Errorf("riders = %v, want [%d]", riders, second.ID)
+		}
+	})
+}
+
+func TestMarkPickedUp(t *testing.T) {
+	eachStore(t, func(t *testing.T, s liveStore) {
+		ctx := context.Background()
+
+		if err := s.GoOnline(ctx, sedan(2)); err != nil {
+			t.Fatalf("GoOnline: %v", err)
+		}
+
+		first := waiting(t, s, 1, 0)
+		second := waiting(t, s, 2, 0)
+		a, b := tripStops(first), tripStops(second)
+		seat(t, s, first, a)
+		seat(t, s, second, []ride.Stop{a[0], b[0], a[1], b[1]})
+
+		if err := s.MarkPickedUp(ctx, testCab, first.ID); err != nil {
+			t.Fatalf("MarkPickedUp: %v", err)
+		}
+
+		stops, err := s.Stops(ctx, testCab)
+		if err != nil {
+			t.Fatalf("Stops: %v", err)
+		}
+		if want := []ride.Stop{b[0], a[1], b[1]}; !reflect.DeepEqual(stops, want) {
+			t.Errorf("stops = %+v, want %+v", stops, want)
+		}
+
+		cab, err := s.Cab(ctx, testCab)
+		if err != nil {
+			t.Fatalf("Cab: %v", err)
+		}
+		if cab.PassengerCount != 2 {
+			t.Errorf("cab has %d passengers after the pickup, want 2", cab.PassengerCount)
+		}
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
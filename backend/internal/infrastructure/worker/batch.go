@@ -0,0 +1,379 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/matching"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
+	"github.com/mmcloughlin/geohash"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BatchOptions enables windowed matching. Instead of matching every request
+// as it arrives, requests are collected per region for Window and then
+// assigned jointly so that riders appearing together can share a cab.
+type BatchOptions struct {
+	// Window is how long requests of a region are collected, 0 disables batching
+	Window time.Duration
+	// RegionPrecision is the geohash length that defines a region
+	RegionPrecision int
+}
+
+// batcher groups incoming jobs by region. It is owned by the allocator
+// goroutine; only the flush channel is touched by the window timers.
+type batcher struct {
+	opts    BatchOptions
+	pending map[string][]Job
+	flush   chan string
+}
+
+func newBatcher(opts BatchOptions) *batcher {
+	return &batcher{
+		opts:    opts,
+		pending: make(map[string][]Job),
+		flush:   make(chan string, 64),
+	}
+}
+
+// add decodes the job and parks it in its region. Jobs that cannot be
+// decoded are left for matchRide, which dead-letters them.
+func (b *batcher) add(job Job) bool {
+	var rider ride.Rider
+	if err := json.Unmarshal(job.Message.Body, &rider); err != nil || rider.Geohash == "" {
+		return false
+	}
+
+	job.ID = int32(rider.ID)
+	job.Rider = &rider
+
+	region := rider.Geohash[:min(len(rider.Geohash), b.opts.RegionPrecision)]
+
+	if _, ok := b.pending[region]; !ok {
+		time.AfterFunc(b.opts.Window, func() { b.flush <- region })
+	}
+	b.pending[region] = append(b.pending[region], job)
+
+	return true
+}
+
+// drain removes and returns the jobs of every region
+func (b *batcher) drain() []Job {
+	var jobs []Job
+	for region := range b.pending {
+		jobs = append(jobs, b.take(region)...)
+	}
+	return jobs
+}
+
+// take removes and returns the jobs collected for the region
+func (b *batcher) take(region string) []Job {
+	jobs := b.pending[region]
+	delete(b.pending, region)
+	return jobs
+}
+
+// plannedCab is a nearby cab the batch plan places riders in
+type plannedCab struct {
+	cabID   string
+	driver  int
+	start   routing.Point
+	class   ride.VehicleClass
+	space   matching.Space
+	version int64
+	stops   []ride.Stop
+	members []int         // indexes into the batch's jobs
+	plans   [][]ride.Stop // stop list after adding each member
+}
+
+// matchBatch assigns a region's riders jointly with a greedy insertion
+// heuristic: all (rider, cab) options are ranked by the matcher of the
+// rider's zone and taken cheapest first while the rider still fits into
+// the cab's route.
+// Riders no cab can take wait for one on their own. Every placement is then
+// committed through tryAssignCab, so a cab changed concurrently only fails
+// the riders planned into it, whose jobs are retried on their own.
+// The batch gets a trace of its own, linked to the trace of every job in it.
+func (w *Worker) matchBatch(jobs []Job) {
+	links := make([]trace.Link, len(jobs))
+	for i, job := range jobs {
+		links[i] = trace.LinkFromContext(job.context())
+	}
+
+	ctx, span := tracing.Start(w.ctx, "Worker.matchBatch",
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.Int("worker.id", w.ID),
+			attribute.Int("batch.size", len(jobs)),
+		),
+	)
+	defer span.End()
+
+	w.Logger.InfoContext(ctx, "Matching batch", "riders", len(jobs))
+
+	// a rider with an offer out joins the batch only once the driver
+	// declined or let it expire
+	pending := jobs[:0]
+	for _, job := range jobs {
+		offer, err := w.Cabs.Offer(ctx, job.Rider.ID)
+		switch {
+		case errors.Is(err, ride.ErrOfferNotFound):
+		case err != nil:
+			w.Logger.ErrorContext(ctx, "Failed to read offer in batch", logging.RiderID(job.Rider.ID), logging.Err(err))
+			w.retry(ctx, job, err)
+			continue
+		case w.settleOffer(ctx, job, *job.Rider, offer):
+			continue
+		}
+		pending = append(pending, job)
+	}
+
+	jobs = pending
+	if len(jobs) == 0 {
+		return
+	}
+
+	cellSet := make(map[string]struct{})
+	for _, job := range jobs {
+		cellSet[job.Rider.Geohash] = struct{}{}
+		for _, c := range geohash.Neighbors(job.Rider.Geohash) {
+			cellSet[c] = struct{}{}
+		}
+	}
+
+	cells := make([]string, 0, len(cellSet))
+	for c := range cellSet {
+		cells = append(cells, c)
+	}
+
+	cabIDSet, err := w.nearbyCabIDs(ctx, cells)
+	if err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to read nearby cabs for batch", logging.Err(err))
+		for _, job := range jobs {
+			w.retry(ctx, job, err)
+		}
+		return
+	}
+
+	// riders retried after an offer keep away from the cabs that declined them
+	for i := range jobs {
+		declined, err := w.Cabs.DeclinedCabs(ctx, jobs[i].Rider.ID)
+		if err != nil {
+			w.Logger.WarnContext(ctx, "Ignoring unreadable declined cabs", logging.RiderID(jobs[i].Rider.ID), logging.Err(err))
+		}
+		jobs[i].declined = declined
+	}
+
+	candidates := w.loadCandidates(ctx, cabIDSet)
+
+	cabs, unplaced := planBatch(jobs, candidates, w.Matchers.For, w.Router, time.Now().Unix())
+
+	for _, r := range unplaced {
+		rider := jobs[r].Rider
+		w.Logger.InfoContext(ctx, "No cab can take the rider in batch", logging.RiderID(rider.ID), logging.TripID(rider.TripID))
+		w.waitForCab(ctx, jobs[r], *rider, fmt.Errorf("no cab available for rider:%d", rider.ID))
+	}
+
+	for _, cab := range cabs {
+		w.commitPlannedCab(ctx, jobs, cab)
+	}
+}
+
+// planBatch returns the cabs riders are placed in and the indexes of the
+// riders none of them can take. Every rider is ranked by the matcher of
+// their zone. Scores of different strategies do not compare, so the riders
+// of each strategy are placed in turn, around the riders placed before.
+func planBatch(jobs []Job, candidates []matching.Candidate, matcherFor func(geohash string) matching.Matcher, router routing.Router, now int64) ([]*plannedCab, []int) {
+	type option struct {
+		rider int
+		cab   int
+		matching.Assignment
+	}
+
+	index := make(map[string]int, len(candidates))
+	cabs := make([]*plannedCab, len(candidates))
+	for i, c := range candidates {
+		index[c.ID] = i
+		cabs[i] = &plannedCab{
+			cabID:   c.ID,
+			driver:  c.DriverID,
+			start:   routing.Point{Lat: c.Latitude, Lng: c.Longitude},
+			class:   c.VehicleClass,
+			space:   matching.Space{Seats: c.Capacity, Luggage: c.LuggageCapacity},
+			version: c.StopsVersion,
+			stops:   c.Stops,
+		}
+	}
+
+	// riders by strategy, strategies in the order their riders came in
+	var strategies []string
+	matchers := make(map[string]matching.Matcher)
+	riders := make(map[string][]int)
+	for r, job := range jobs {
+		matcher := matcherFor(job.Rider.Geohash)
+		name := matcher.Name()
+		if _, ok := matchers[name]; !ok {
+			strategies = append(strategies, name)
+			matchers[name] = matcher
+		}
+		riders[name] = append(riders[name], r)
+	}
+
+	assigned := make([]bool, len(jobs))
+	for _, name := range strategies {
+		var options []option
+		for _, r := range riders[name] {
+			rider := *jobs[r].Rider
+			eligible := matching.Eligible(rider, without(candidates, jobs[r].declined), now, router)
+			for _, a := range matchers[name].Rank(rider, eligible) {
+				options = append(options, option{rider: r, cab: index[a.CabID], Assignment: a})
+			}
+		}
+
+		sort.SliceStable(options, func(i, j int) bool {
+			if options[i].Score != options[j].Score {
+				return options[i].Score < options[j].Score
+			}
+			return options[i].DistanceKm < options[j].DistanceKm
+		})
+
+		for _, o := range options {
+			if assigned[o.rider] {
+				continue
+			}
+
+			// the option was ranked against the cab's original route, it has
+			// to be re-planned once riders of this batch joined the cab
+			if cabs[o.cab].tryAdd(router, o.rider, *jobs[o.rider].Rider) {
+				assigned[o.rider] = true
+			}
+		}
+	}
+
+	var unplaced []int
+	for r := range jobs {
+		if !assigned[r] {
+			unplaced = append(unplaced, r)
+		}
+	}
+
+	used := make([]*plannedCab, 0, len(cabs))
+	for _, cab := range cabs {
+		if len(cab.members) > 0 {
+			used = append(used, cab)
+		}
+	}
+
+	return used, unplaced
+}
+
+// without returns the candidates except the given cabs
+func without(candidates []matching.Candidate, cabIDs []string) []matching.Candidate {
+	if len(cabIDs) == 0 {
+		return candidates
+	}
+
+	out := make([]matching.Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if !slices.Contains(cabIDs, c.ID) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// serves reports whether the cab is of the class the rider asked for
+func (c *plannedCab) serves(rider ride.Rider) bool {
+	return rider.VehicleClass == "" || rider.VehicleClass == c.class
+}
+
+// tryAdd inserts the rider into the cab's planned route if it fits
+func (c *plannedCab) tryAdd(router routing.Router, index int, rider ride.Rider) bool {
+	if !c.serves(rider) {
+		return false
+	}
+
+	plan, ok := matching.Insert(router, c.start, c.space, c.stops, rider)
+	if !ok {
+		return false
+	}
+
+	c.add(index, plan.Stops)
+	return true
+}
+
+func (c *plannedCab) add(index int, stops []ride.Stop) {
+	c.stops = stops
+	c.members = append(c.members, index)
+	c.plans = append(c.plans, stops)
+}
+
+// commitPlannedCab writes the plan for one cab. Each plan builds on the
+// previous one, so once a commit fails the remaining riders of the cab are
+// retried. Riders offered to the cab's driver come back with the answer or
+// at the offer's deadline.
+func (w *Worker) commitPlannedCab(ctx context.Context, jobs []Job, cab *plannedCab) {
+	members := cab.members
+	plans := cab.plans
+	cabID := cab.cabID
+	version := cab.version
+
+	expiresAt, err := w.offerDeadline(cabID, cab.driver)
+	if err != nil {
+		w.Logger.ErrorContext(ctx, "Cannot offer riders to cab in batch", logging.CabID(cabID), logging.Err(err))
+		for _, r := range members {
+			w.retry(ctx, jobs[r], err)
+		}
+		return
+	}
+
+	for k, r := range members {
+		job := jobs[r]
+		rider := *job.Rider
+
+		success, err := w.tryAssignCab(ctx, job, cabID, rider, version, plans[k], expiresAt)
+		if errors.Is(err, errStaleRequest) {
+			w.Logger.InfoContext(ctx, "Dropping ride request the rider no longer waits for in batch", logging.RiderID(rider.ID), logging.TripID(rider.TripID))
+			_ = job.Message.Ack()
+
+			// the rest of the plan was made around the rider
+			err = fmt.Errorf("rider:%d planned into cab:%s left the batch", rider.ID, cabID)
+			for _, rest := range members[k+1:] {
+				w.retry(ctx, jobs[rest], err)
+			}
+			return
+		}
+		if err == nil && !success {
+			err = fmt.Errorf("race lost assigning rider:%d to cab:%s in batch", rider.ID, cabID)
+		}
+		if err != nil {
+			w.Logger.ErrorContext(ctx, "Failed to assign cab in batch", logging.RiderID(rider.ID), logging.CabID(cabID), logging.Err(err))
+			for _, rest := range members[k:] {
+				w.retry(ctx, jobs[rest], err)
+			}
+			return
+		}
+
+		version++
+
+		if !expiresAt.IsZero() {
+			w.Logger.InfoContext(ctx, "Offered rider to cab in batch", logging.RiderID(rider.ID), logging.TripID(rider.TripID), logging.CabID(cabID))
+			w.sendOffer(ctx, job, rider, &ride.Offer{RiderID: rider.ID, CabID: cabID, Status: ride.OfferOpen, ExpiresAt: expiresAt})
+			continue
+		}
+
+		w.Logger.InfoContext(ctx, "Assigned rider to cab in batch", logging.RiderID(rider.ID), logging.TripID(rider.TripID), logging.CabID(cabID))
+		w.recordAssignment(ctx, rider, cabID)
+		_ = job.Message.Ack()
+	}
+}
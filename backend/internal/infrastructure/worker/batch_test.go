@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/matching"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+)
+
+// recordingMatcher ranks like the strategy it wraps and remembers the
+// riders it ranked
+type recordingMatcher struct {
+	matching.Matcher
+	name   string
+	riders *[]int
+}
+
+func (m recordingMatcher) Name() string {
+	return m.name
+}
+
+func (m recordingMatcher) Rank(rider ride.Rider, cabs []matching.Candidate) []matching.Assignment {
+	*m.riders = append(*m.riders, rider.ID)
+	return m.Matcher.Rank(rider, cabs)
+}
+
+func TestPlanBatchRanksByZone(t *testing.T) {
+	router := routing.NewHaversineRouter(0)
+	greedy, _ := matching.New(matching.StrategyGreedy, router)
+	balance, _ := matching.New(matching.StrategyLoadBalance, router)
+
+	var downtown, elsewhere []int
+	matcherFor := func(geohash string) matching.Matcher {
+		if geohash == "tdr1v9" {
+			return recordingMatcher{Matcher: balance, name: "downtown", riders: &downtown}
+		}
+		return recordingMatcher{Matcher: greedy, name: "elsewhere", riders: &elsewhere}
+	}
+
+	now := time.Now().Unix()
+	candidates := []matching.Candidate{
+		{ID: "cab-1", DriverID: 1, Latitude: pickupLat, Longitude: pickupLng, Status: ride.CabAvailable, Capacity: 4, LuggageCapacity: 2, LastUpdate: now},
+	}
+
+	var jobs []Job
+	for id, cell := range []string{"tdr1v9", "tdr1vc", "tdr1v9"} {
+		jobs = append(jobs, Job{Rider: &ride.Rider{
+			ID:            id + 1,
+			Geohash:       cell,
+			Latitude:      pickupLat,
+			Longitude:     pickupLng,
+			Tolerance:     2,
+			DropLatitude:  pickupLat + 0.01,
+			DropLongitude: pickupLng,
+		}})
+	}
+
+	cabs, unplaced := planBatch(jobs, candidates, matcherFor, router, now)
+
+	if !slices.Equal(downtown, []int{1, 3}) || !slices.Equal(elsewhere, []int{2}) {
+		t.Errorf("downtown ranked riders %v and elsewhere %v, want [1 3] and [2]", downtown, elsewhere)
+	}
+	if len(unplaced) != 0 || len(cabs) != 1 || len(cabs[0].members) != 3 {
+		t.Errorf("planned %d cabs and left %v unplaced, want all riders in cab-1", len(cabs), unplaced)
+	}
+}
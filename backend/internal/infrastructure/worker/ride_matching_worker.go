@@ -6,35 +6,78 @@ import (
 
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"math"
+	"log/slog"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/matching"
 	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/metrics"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/tracing"
 	"github.com/mmcloughlin/geohash"
-	amqp "github.com/rabbitmq/amqp091-go"
-	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var queueName string
-var airportlat float64
-var airportlng float64
 
 type Job struct {
 	ID       int32
-	Delivery amqp.Delivery
+	Message  queue.Message
+	Rider    *ride.Rider // decoded by the batcher, nil for single jobs
+	Batch    []Job       // set when the job carries a whole region's batch
+	declined []string    // cabs that declined the rider, read by matchBatch
+	ctx      context.Context // carries the trace of the allocated message
 }
 
+// context returns the job's trace context
+func (j Job) context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// errStaleRequest is returned by tryAssignCab when the rider no longer
+// waits for the job's ride request
+var errStaleRequest = errors.New("rider no longer waits for this ride request")
+
 // Pool represents the worker pool structure
 type Pool struct {
 	WorkerCount   int
 	WorkerChannel chan chan Job
-	JobQueue      *amqp.Channel
-    RedisClient  *redis.Client
+	JobQueue      queue.JobQueue
+	Cabs          ride.CabStore
+	Riders        ride.LocationStore
+	Events        events.Publisher
+	Drivers       events.DriverPublisher
+	TripRepo      ride.Repository
+	MaxRetries    int
+	Matchers      *matching.Selector
+	Router        routing.Router
+	// OfferTimeout is how long a driver has to accept a rider, riders are
+	// assigned without asking when it is 0
+	OfferTimeout  time.Duration
+	Batch         BatchOptions
+	Wait          WaitOptions
+	Logger        *slog.Logger
 	Stopped       chan bool
+
+	// ctx is the parent of every job's context, cancelled when Stop runs
+	// out of time so that jobs still running hand their message back
+	ctx       context.Context
+	cancel    context.CancelFunc
+	workers   []*Worker
+	running   *sync.WaitGroup
+	allocated chan struct{} // closed once the allocator has returned
 }
 
 // Worker represents the actual worker doing the job
@@ -42,75 +85,203 @@ type Worker struct {
 	ID            int
 	JobChannel    chan Job
 	WorkerChannel chan chan Job // used to communicate between dispatcher and worker
-    RedisClient   *redis.Client
+	Cabs          ride.CabStore
+	Riders        ride.LocationStore // cleared when no cab takes the rider
+	Events        events.Publisher
+	Drivers       events.DriverPublisher
+	TripRepo      ride.Repository
+	JobQueue      queue.JobQueue // used to publish retries and dead letters
+	MaxRetries    int
+	Matchers      *matching.Selector
+	Router        routing.Router
+	OfferTimeout  time.Duration
+	Wait          WaitOptions
+	Logger        *slog.Logger
 	Quit          chan bool
+
+	ctx     context.Context
+	running *sync.WaitGroup
 }
 
 // NewPool returns contructs and returns new Pool object
-func NewPool(workerCount int, jobQueueChannel *amqp.Channel, queue string, rdb *redis.Client) Pool {
-	queueName = queue 
-	airportlat = 23.3179
-	airportlng = 77.349225
+func NewPool(workerCount int, jobs queue.JobQueue, maxRetries int, cabs ride.CabStore, riders ride.LocationStore, publisher events.Publisher, drivers events.DriverPublisher, tripRepo ride.Repository, matchers *matching.Selector, router routing.Router, logger *slog.Logger) Pool {
 	return Pool{
 		WorkerCount:   workerCount,
 		WorkerChannel: make(chan chan Job),
-		JobQueue:      jobQueueChannel,
-        RedisClient: rdb,
+		JobQueue:      jobs,
+		Cabs:          cabs,
+		Riders:        riders,
+		Events:        publisher,
+		Drivers:       drivers,
+		TripRepo:      tripRepo,
+		MaxRetries:    maxRetries,
+		Matchers:      matchers,
+		Router:        router,
+		Wait:          defaultWait,
+		Logger:        logger,
 		Stopped:       make(chan bool),
 	}
 }
 
 func (p *Pool) Run() {
-	log.Println("Spawning the workers")
+	p.Logger.Info("Spawning the workers", "count", p.WorkerCount)
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.running = &sync.WaitGroup{}
+	p.allocated = make(chan struct{})
 
 	for i := range p.WorkerCount {
-		worker := Worker{
+		worker := &Worker{
 			ID:            i + 1,
 			JobChannel:    make(chan Job),
 			WorkerChannel: p.WorkerChannel,
-            RedisClient: p.RedisClient,
+			Cabs:          p.Cabs,
+			Riders:        p.Riders,
+			Events:        p.Events,
+			Drivers:       p.Drivers,
+			TripRepo:      p.TripRepo,
+			JobQueue:      p.JobQueue,
+			MaxRetries:    p.MaxRetries,
+			Matchers:      p.Matchers,
+			Router:        p.Router,
+			OfferTimeout:  p.OfferTimeout,
+			Wait:          p.Wait,
+			Logger:        p.Logger.With("worker", i+1),
 			Quit:          make(chan bool),
+			ctx:           p.ctx,
+			running:       p.running,
 		}
+		p.workers = append(p.workers, worker)
 		worker.start()
 	}
 
 	p.allocate()
 }
 
-// RabbitMQ message conumer and job dispatcher
-func (p *Pool) allocate() {
-	q := p.JobQueue
-	
-	msgs, err := q.Consume(
-		queueName,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
+// Stop shuts the pool down: the consumer is cancelled, jobs not yet handed
+// to a worker are nacked back to the queue and running jobs may finish.
+// Once ctx is done the running jobs are cancelled, they nack their message
+// instead of scheduling a retry, and Stop returns ctx's error.
+func (p *Pool) Stop(ctx context.Context) error {
+	if err := p.JobQueue.Cancel(); err != nil {
+		p.Logger.Warn("Failed to cancel job consumer", logging.Err(err))
+	}
 
+	close(p.Stopped)
+	<-p.allocated
+
+	for _, w := range p.workers {
+		close(w.Quit)
+	}
+
+	idle := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(idle)
+	}()
+
+	select {
+	case <-idle:
+		p.cancel()
+		p.Logger.Info("Worker pool stopped")
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		p.Logger.Warn("Worker pool stop timed out, cancelling running jobs")
+		return ctx.Err()
+	}
+}
+
+// job queue conumer and job dispatcher
+func (p *Pool) allocate() {
+	msgs, err := p.JobQueue.Consume()
 	if err != nil {
-		log.Fatalf("Failed to register consumer: %v", err)
+		p.Logger.Error("Failed to register consumer", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var b *batcher
+	var flushes <-chan string // stays nil, and never fires, without batching
+	if p.Batch.Window > 0 {
+		p.Logger.Info("Batching ride requests per region", "window", p.Batch.Window)
+		b = newBatcher(p.Batch)
+		flushes = b.flush
+	}
+
+	// dispatch hands the job to the next free worker, false if the pool
+	// stops first
+	dispatch := func(job Job) bool {
+		select {
+		case workerCh := <-p.WorkerChannel:
+			workerCh <- job
+			return true
+		case <-p.Stopped:
+			return false
+		}
+	}
+
+	// requeue hands undispatched jobs back to the queue
+	var requeue func(jobs ...Job)
+	requeue = func(jobs ...Job) {
+		for _, job := range jobs {
+			if len(job.Batch) > 0 {
+				requeue(job.Batch...)
+				continue
+			}
+			if err := job.Message.Nack(true); err != nil {
+				p.Logger.Warn("Failed to requeue job", jobAttrs(job, logging.Err(err))...)
+			}
+		}
 	}
 
 	go func() {
+		defer close(p.allocated)
+
 		for {
 			select {
-			case d, ok := <-msgs:
+			case m, ok := <-msgs:
 				if !ok {
-					log.Println("RabbitMQ channel closed, stopping allocator")
+					p.Logger.Warn("Job queue closed, stopping allocator")
 					return
 				}
 
-				job := Job{Delivery: d}
+				metrics.QueueDeliveries.WithLabelValues(strconv.FormatBool(m.Redelivered)).Inc()
 
-				workerCh := <-p.WorkerChannel
-				workerCh <- job
+				// the span covers the wait for a free worker or the batch window
+				ctx, span := tracing.Start(m.Context(p.ctx), "Pool.allocate",
+					trace.WithSpanKind(trace.SpanKindConsumer),
+					trace.WithAttributes(
+						attribute.String("messaging.message.id", m.ID),
+						attribute.Int("job.retries", m.Retries),
+						attribute.Bool("job.redelivered", m.Redelivered),
+					),
+				)
+
+				job := Job{Message: m, ctx: ctx}
+
+				if b != nil && b.add(job) {
+					span.AddEvent("batched")
+					span.End()
+					continue
+				}
+
+				dispatched := dispatch(job)
+				span.End()
+				if !dispatched {
+					requeue(job)
+				}
+
+			case region := <-flushes:
+				job := Job{Batch: b.take(region)}
+				if !dispatch(job) {
+					requeue(job)
+				}
 
 			case <-p.Stopped:
-				log.Println("Allocator received stop signal, shutting down")
+				p.Logger.Info("Allocator received stop signal, shutting down")
+				if b != nil {
+					requeue(b.drain()...)
+				}
 				return
 			}
 		}
@@ -118,13 +289,39 @@ func (p *Pool) allocate() {
 }
 
 func (w *Worker) start() {
+	id := strconv.Itoa(w.ID)
+	busy := metrics.WorkerBusySeconds.WithLabelValues(id)
+	idle := metrics.WorkerIdleSeconds.WithLabelValues(id)
+
+	w.running.Add(1)
 
 	go func() {
+		defer w.running.Done()
+
 		for {
-			w.WorkerChannel <- w.JobChannel // when the worker is available place channel in queue
+			idleSince := time.Now()
+
+			// when the worker is available place channel in queue
+			select {
+			case w.WorkerChannel <- w.JobChannel:
+			case <-w.Quit:
+				return
+			}
+
 			select {
 			case job := <-w.JobChannel: // worker has recived job
-				w.matchRide(job)
+				busySince := time.Now()
+				idle.Add(busySince.Sub(idleSince).Seconds())
+				metrics.WorkersBusy.Inc()
+
+				if len(job.Batch) > 0 {
+					w.matchBatch(job.Batch)
+				} else {
+					w.matchRide(job)
+				}
+
+				metrics.WorkersBusy.Dec()
+				busy.Add(time.Since(busySince).Seconds())
 			case <-w.Quit:
 				return
 			}
@@ -136,275 +333,524 @@ func (w *Worker) start() {
 // This is the main function that matches riders
 // It looks for riders in the same geo cell and in neighbouring 8 geo cells
 // the function checks compatibility against each cab avaible in the geo area
-// the cab data maintains a special "min tolerance distance" attribute which 
-// is updated any time a new passengers boards the cab
-// the matchride function checks if detour <= min tolerance distance AND 
-// the capcity of the cab is not exceede
-// if not exceeded while matching, then we lock the cab and insert passenger into the cab
-// if no compatible match found, we simply book a cab only for a single passenger
+// every cab keeps an ordered list of pickups and drops in cab:{id}:stops
+// matching.Eligible inserts the rider's pickup and drop at the cheapest
+// positions such that nobody on board is detoured beyond their tolerance
+// AND the capcity of the cab is not exceede, the zone's Matcher then ranks the
+// remaining cabs and we try to lock them in order and insert the passenger
+// the first cab that takes the rider is offered to its driver and the job
+// comes back with the answer or at the offer's deadline, if the driver
+// declines or does not answer in time we match again without their cab
+// if no compatible match found, the job waits in the delay queue and tries
+// again until the rider waited too long and their trip is cancelled
 func (w *Worker) matchRide(job Job) {
-
-	log.Printf("------")
+	ctx, span := tracing.Start(job.context(), "Worker.matchRide",
+		trace.WithAttributes(attribute.Int("worker.id", w.ID)))
+	defer span.End()
 
     // fetch from redis all the active users
-    j := job.Delivery.Body
+    j := job.Message.Body
     var rider ride.Rider
     err := json.Unmarshal(j, &rider);
 	
     if(err != nil){
-		log.Println(fmt.Sprintf("Error while reading unmarshalling job for JOB ID %d : %s",job.ID,err.Error()))
+		w.Logger.ErrorContext(ctx, "Failed to decode ride request", "message_id", job.Message.ID, logging.Err(err))
+		// a message that cannot be decoded will never succeed, skip the retries
+		w.deadLetter(ctx, job, err)
         return
     }
 
 	job.ID = int32(rider.ID)
+	logger := w.Logger.With(logging.RiderID(rider.ID), logging.TripID(rider.TripID))
+	span.SetAttributes(
+		attribute.Int("rider.id", rider.ID),
+		attribute.Int("trip.id", rider.TripID),
+		attribute.String("rider.geohash", rider.Geohash),
+	)
 
-    cells := geohash.Neighbors(rider.Geohash)
-    
-    cells = append([]string{rider.Geohash}, rider.Geohash)
-
-    cabIDSet := make(map[string]struct{}) 
-
-    for _, cell := range cells{
-        geohash := cell
-        ids, err := w.RedisClient.SMembers(context.Background(),fmt.Sprintf("cell:%s:cabs",geohash)).Result()
-        if err != nil {
-            log.Println(fmt.Printf("Error while reading from Redis set for JOB ID %d : %s", job.ID,err.Error()))
-            return
-        }
-
-        for _, id := range ids {
-			cabIDSet[id] = struct{}{}
+	// a rider with an offer out is matched again only once the driver
+	// declined or let it expire
+	pending, err := w.Cabs.Offer(ctx, rider.ID)
+	switch {
+	case errors.Is(err, ride.ErrOfferNotFound):
+	case err != nil:
+		logger.ErrorContext(ctx, "Failed to read offer", logging.Err(err))
+		w.retry(ctx, job, err)
+		return
+	default:
+		if w.settleOffer(ctx, job, rider, pending) {
+			return
 		}
-        
-    }
-    
-    bestCabID := ""
-    bestScore := math.MaxFloat64
-
-    now := time.Now().Unix()
-
-	var totaldistance float64
+	}
 
-    for cabID := range cabIDSet {
-        cab, err := w.RedisClient.HGetAll(context.Background(),fmt.Sprintf("cab:%s", cabID)).Result()
+	ranked, cabs, err := w.rankCabs(ctx, rider, logger)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to read nearby cabs", logging.Err(err))
+		w.retry(ctx, job, err)
+		return
+	}
 
-        if err != nil || len(cab) == 0{
-            continue
-        }
+	if len(ranked) == 0 {
+		// cabs free up and move, the delay queue asks again later
+		logger.InfoContext(ctx, "No cab can take the rider")
+		w.waitForCab(ctx, job, rider, fmt.Errorf("no cab available for rider:%d", rider.ID))
+		return
+	}
 
-        if cab["status"] != "AVAILABLE"{
-            continue
-        }
+	// walk down the ranking, a cab may have been taken or its route changed
+	// since it was read
+	for _, option := range ranked {
+		cab := cabs[option.CabID]
 
-        lastUpdate, err := strconv.ParseInt(cab["last_update_ts"], 10, 64)
+		expiresAt, err := w.offerDeadline(option.CabID, cab.DriverID)
 		if err != nil {
+			logger.ErrorContext(ctx, "Cannot offer rider to cab", logging.CabID(option.CabID), logging.Err(err))
 			continue
 		}
-		if now-lastUpdate > 30 { 
+
+		success, err := w.tryAssignCab(ctx, job, option.CabID, rider, cab.StopsVersion, option.Plan.Stops, expiresAt)
+		if errors.Is(err, errStaleRequest) {
+			logger.InfoContext(ctx, "Dropping ride request the rider no longer waits for")
+			_ = job.Message.Ack()
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to assign cab", logging.CabID(option.CabID), logging.Err(err))
+			w.retry(ctx, job, err)
+			return
+		}
+
+		if !success {
+			logger.DebugContext(ctx, "Race lost assigning cab", logging.CabID(option.CabID))
 			continue
-		} 
-
-        // parse fields
-		cabLat, _ := strconv.ParseFloat(cab["lat"], 64)
-		cabLng, _ := strconv.ParseFloat(cab["lng"], 64)
-		passengerCount, _ := strconv.Atoi(cab["passenger_count"])
-        luggageCount, _ := strconv.Atoi(cab["luggage_count"])
-		minTolerance, _ := strconv.ParseFloat(cab["min_tolerance_km"], 64)
-        capacity, _ :=strconv.Atoi(cab["capacity"])
-
-        // compute distance (km)
-		totaldistance = haversineKm(rider.Latitude, rider.Longitude, cabLat, cabLng)
-
-        // tolerance rule
-		if passengerCount + luggageCount + 1 + rider.Luggage <= capacity {
-			if totaldistance > minTolerance {
-				continue
-			}
 		}
-        score := totaldistance
 
-        if score < bestScore{
-            bestScore = score
-            bestCabID = cabID
-        }
-    }
+		span.SetAttributes(attribute.String("cab.id", option.CabID))
 
-	d := haversineKm(rider.Latitude, rider.Longitude, airportlat, airportlng) 
-	tolerance := computeRiderToleranceKm(rider.Tolerance, d)
-	if bestCabID == "" {
-		log.Printf("No cab found for rider %d, creating a new cab", rider.ID)
+		if expiresAt.IsZero() {
+			logger.InfoContext(ctx, "Assigned rider to cab", logging.CabID(option.CabID), "score", option.Score)
+			w.recordAssignment(ctx, rider, option.CabID)
 
-		ctx := context.Background()
+			_ = job.Message.Ack()
+			return
+		}
 
-		cabID := randomCabID()
-		cabKey := fmt.Sprintf("cab:%s", cabID)
-		cabRidersKey := fmt.Sprintf("cab:%s:riders", cabID)
-		riderKey := fmt.Sprintf("rider:%d", rider.ID)
-		cellCabsKey := fmt.Sprintf("cell:%s:cabs", rider.Geohash)
+		logger.InfoContext(ctx, "Offered rider to cab", logging.CabID(option.CabID), "score", option.Score, "acceptance_rate", option.AcceptanceRate)
+		w.sendOffer(ctx, job, rider, &ride.Offer{RiderID: rider.ID, CabID: option.CabID, Status: ride.OfferOpen, ExpiresAt: expiresAt})
+		return
+	}
 
-		now := time.Now().Unix()
+	w.retry(ctx, job, fmt.Errorf("none of the %d ranked cabs took rider:%d", len(ranked), rider.ID))
+}
 
-		pipe := w.RedisClient.TxPipeline()
+// rankCabs ranks the cabs around the rider that can take them, leaving out
+// those whose drivers declined the rider. cabs are the eligible cabs by id,
+// as read when the plans were computed.
+func (w *Worker) rankCabs(ctx context.Context, rider ride.Rider, logger *slog.Logger) ([]matching.Assignment, map[string]matching.Candidate, error) {
+	cells := geohash.Neighbors(rider.Geohash)
+	cells = append([]string{rider.Geohash}, cells...)
 
-		pipe.HSet(ctx, cabKey, map[string]interface{}{
-			"lat":               rider.Latitude,
-			"lng":               rider.Longitude,
-			"passenger_count":   1,
-			"luggage_count":     rider.Luggage,
-			"capacity":          4, // or from config
-			"min_tolerance_km":  tolerance,
-			"status":            "AVAILABLE", // still available for more riders
-			"last_update_ts":    now,
-		})
+	cabIDSet, err := w.nearbyCabIDs(ctx, cells)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	declined, err := w.Cabs.DeclinedCabs(ctx, rider.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cabID := range declined {
+		delete(cabIDSet, cabID)
+	}
 
-		pipe.SAdd(ctx, cabRidersKey, rider.ID)
+	candidates := w.loadCandidates(ctx, cabIDSet)
+	eligible := matching.Eligible(rider, candidates, time.Now().Unix(), w.Router)
 
-		pipe.SAdd(ctx, cellCabsKey, cabID)
+	matcher := w.Matchers.For(rider.Geohash)
+	ranked := matcher.Rank(rider, eligible)
 
-		pipe.HSet(ctx, riderKey, map[string]interface{}{
-			"status":         "MATCHED",
-			"cab_id":         cabID,
-			"last_update_ts": now,
-		})
+	logger.DebugContext(ctx, "Ranked nearby cabs", "matcher", matcher.Name(), "ranked", len(ranked), "nearby", len(candidates), "declined", len(declined))
+
+	cabs := make(map[string]matching.Candidate, len(eligible))
+	for _, cab := range eligible {
+		cabs[cab.ID] = cab
+	}
 
-		waitKey := fmt.Sprintf("pool:cell:%s:waiting", rider.Geohash)
-		pipe.SRem(ctx, waitKey, rider.ID)
+	return ranked, cabs, nil
+}
 
-		if _, err := pipe.Exec(ctx); err != nil {
-			log.Println("Failed to create new cab and assign rider:", err)
-			_ = job.Delivery.Nack(false, true) // retry
-			return
+// nearbyCabIDs collects the ids of all cabs indexed in the given cells
+func (w *Worker) nearbyCabIDs(ctx context.Context, cells []string) (map[string]struct{}, error) {
+	ids, err := w.Cabs.CabsInCells(ctx, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	cabIDSet := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		cabIDSet[id] = struct{}{}
+	}
+
+	return cabIDSet, nil
+}
+
+// loadCandidates reads the cabs and their stop lists. Cabs that vanished
+// since the cell lookup are skipped.
+func (w *Worker) loadCandidates(ctx context.Context, cabIDs map[string]struct{}) []matching.Candidate {
+	candidates := make([]matching.Candidate, 0, len(cabIDs))
+
+	for cabID := range cabIDs {
+		cab, err := w.Cabs.Cab(ctx, cabID)
+		if err != nil {
+			continue
+		}
+
+		stops, err := w.Cabs.Stops(ctx, cabID)
+		if err != nil {
+			w.Logger.WarnContext(ctx, "Ignoring unreadable stop list", logging.CabID(cabID), logging.Err(err))
+			stops = nil
+		}
+
+		// without stats the driver counts as new
+		offers, err := w.Cabs.OfferStats(ctx, cabID)
+		if err != nil {
+			w.Logger.WarnContext(ctx, "Ignoring unreadable offer stats", logging.CabID(cabID), logging.Err(err))
 		}
 
-		_ = job.Delivery.Ack(false)
+		candidates = append(candidates, matching.Candidate{
+			ID:              cabID,
+			DriverID:        cab.DriverID,
+			Latitude:        cab.Latitude,
+			Longitude:       cab.Longitude,
+			Status:          cab.Status,
+			PassengerCount:  cab.PassengerCount,
+			LuggageCount:    cab.LuggageCount,
+			Capacity:        cab.Capacity,
+			LuggageCapacity: cab.LuggageCapacity,
+			VehicleClass:    cab.VehicleClass,
+			LastUpdate:      cab.LastUpdate,
+			Stops:           stops,
+			StopsVersion:    cab.StopsVersion,
+			Offers:          offers,
+		})
+	}
+
+	return candidates
+}
+
+// retry schedules the job for another attempt after an exponential backoff.
+// Once MaxRetries is exhausted the rider's trip is cancelled and the job
+// is moved to the dead-letter queue.
+// The original message is only acked after the copy has been published.
+// The reason is recorded on the span in ctx.
+func (w *Worker) retry(ctx context.Context, job Job, reason error) {
+	if w.ctx.Err() != nil {
+		// the pool is stopping, the job goes back as it came
+		w.Logger.InfoContext(ctx, "Returning job to the queue on shutdown", jobAttrs(job, logging.Err(reason))...)
+		_ = job.Message.Nack(true)
 		return
 	}
 
-	
-    success, err := w.tryAssignCab(context.Background(), bestCabID, rider.ID, tolerance)
-	if err != nil {
-		log.Printf("Assignment error: %v", err)
-		_ = job.Delivery.Nack(false, true)
+	attempt := job.Message.Retries + 1
+
+	if attempt > w.MaxRetries {
+		w.Logger.WarnContext(ctx, "Job exhausted its retries", jobAttrs(job, slog.Int("max_retries", w.MaxRetries), logging.Err(reason))...)
+		w.abandonJob(ctx, job)
+		w.deadLetter(ctx, job, reason)
 		return
 	}
 
-	if success {
-		log.Printf(fmt.Sprintf("Assigned rider %d to cab %s", rider.ID, bestCabID))
-	
-		_ = job.Delivery.Ack(false)
+	tracing.RecordError(trace.SpanFromContext(ctx), reason)
+
+	if err := w.JobQueue.Retry(job.Message, attempt); err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to schedule retry", jobAttrs(job, slog.Int("attempt", attempt), logging.Err(err))...)
+		_ = job.Message.Nack(true)
 		return
 	}
 
-	log.Printf("Race lost assigning cab %s, retrying job %d", bestCabID, job.ID)
-	_ = job.Delivery.Nack(false, true)
+	metrics.QueueRetries.Inc()
+	w.Logger.InfoContext(ctx, "Scheduled retry", jobAttrs(job, slog.Int("attempt", attempt), logging.Err(reason))...)
 
-	_ = job.Delivery.Ack(false)
-	log.Printf("Processed by Worker [%d]", w.ID)
-	log.Printf("Processed Job With ID [%d] & content: [%v]", job.ID, job.Delivery)
-	log.Printf("-------")
+	_ = job.Message.Ack()
 }
 
-func (w *Worker) tryAssignCab(ctx context.Context, cabID string, riderID int, riderToleranceKm float64) (bool, error) {
-	lua := `
-        -- KEYS[1] = cab key
-        -- KEYS[2] = rider key
-        -- KEYS[3] = cab riders set key
-        -- ARGV[1] = riderID
-        -- ARGV[2] = rider_tolerance_km
-
-        local status = redis.call("HGET", KEYS[1], "status")
-        if status ~= "AVAILABLE" then
-            return 0
-        end
-
-        local passenger_count = tonumber(redis.call("HGET", KEYS[1], "passenger_count") or "0")
-        local luggage_count = tonumber(redis.call("HGET", KEYS[1], "luggage_count") or "0")
-        local capacity = tonumber(redis.call("HGET", KEYS[1], "capacity") or "4")
-
-        if (passenger_count + luggage_count) >= capacity then
-            return 0
-        end
-
-        redis.call("HINCRBY", KEYS[1], "passenger_count", 1)
-
-        local rider_tol = tonumber(ARGV[2])
-        local old_min_tol = redis.call("HGET", KEYS[1], "min_tolerance_km")
-
-        if old_min_tol == false then
-            -- If not set yet, set to rider's tolerance
-            redis.call("HSET", KEYS[1], "min_tolerance_km", rider_tol)
-        else
-            local old_tol = tonumber(old_min_tol)
-            if rider_tol < old_tol then
-                redis.call("HSET", KEYS[1], "min_tolerance_km", rider_tol)
-            end
-        end
-
-        redis.call("HSET", KEYS[2], "cab_id", string.sub(KEYS[1], 5))
-        redis.call("HSET", KEYS[2], "status", "MATCHED")
-
-        redis.call("SADD", KEYS[3], ARGV[1])
-
-        if (passenger_count + luggage_count + 1) >= capacity then
-            redis.call("HSET", KEYS[1], "status", "FULL")
-        end
-
-        return 1
-    `
-
-	cabKey := fmt.Sprintf("cab:%s", cabID)
-	riderKey := fmt.Sprintf("rider:%d", riderID)
-	cabRidersKey := fmt.Sprintf("cab:%s:riders", cabID)
-
-	res, err := w.RedisClient.Eval(
-		ctx,
-		lua,
-		[]string{cabKey, riderKey, cabRidersKey},
-		strconv.Itoa(riderID),
-		fmt.Sprintf("%f", riderToleranceKm),
-	).Result()
+// deadLetter moves the job to the dead-letter queue together with the reason.
+// If that publish fails the message is rejected, which the work queue
+// dead-letters as well, only without the reason.
+func (w *Worker) deadLetter(ctx context.Context, job Job, reason error) {
+	span := trace.SpanFromContext(ctx)
+	tracing.RecordError(span, reason)
+	span.AddEvent("dead-lettered")
+
+	if err := w.JobQueue.DeadLetter(job.Message, reason); err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to dead-letter job", jobAttrs(job, logging.Err(err))...)
+		_ = job.Message.Nack(false)
+		metrics.QueueDeadLetters.Inc()
+		return
+	}
+
+	metrics.QueueDeadLetters.Inc()
+	_ = job.Message.Ack()
+}
 
+// tryAssignCab adds the rider to the cab, or with an expiresAt offers them
+// to its driver until then, and replaces its stop list with the planned
+// one. It only succeeds if the route is still the one the plan was
+// computed from, i.e. stops_version has not moved. A rider who cancelled or
+// asked again since the job was queued gets errStaleRequest. An offer
+// remembers the job, whose retries the driver's answer carries on.
+func (w *Worker) tryAssignCab(ctx context.Context, job Job, cabID string, rider ride.Rider, version int64, stops []ride.Stop, expiresAt time.Time) (bool, error) {
+	var result ride.AssignResult
+	var err error
+	if expiresAt.IsZero() {
+		result, err = w.Cabs.AssignRider(ctx, cabID, rider, version, stops)
+	} else {
+		from := ride.JobRef{Retries: job.Message.Retries, RequestID: job.Message.RequestID}
+		result, err = w.Cabs.OfferRider(ctx, cabID, rider, version, stops, expiresAt, from)
+	}
 	if err != nil {
 		return false, err
 	}
 
-	ok, okType := res.(int64)
-	if !okType {
-		return false, fmt.Errorf("unexpected Lua return type: %T", res)
+	switch result {
+	case ride.AssignOK:
+		metrics.AssignAttempts.WithLabelValues(metrics.OutcomeAssigned).Inc()
+	case ride.AssignFull:
+		metrics.AssignAttempts.WithLabelValues(metrics.OutcomeFull).Inc()
+	case ride.AssignUnavailable:
+		metrics.AssignAttempts.WithLabelValues(metrics.OutcomeUnavailable).Inc()
+	case ride.AssignStale:
+		metrics.AssignAttempts.WithLabelValues(metrics.OutcomeStale).Inc()
+		return false, errStaleRequest
+	default:
+		metrics.AssignAttempts.WithLabelValues(metrics.OutcomeRaceLost).Inc()
 	}
 
-	if ok != 1 {
-		return false, fmt.Errorf("failed to assign rider:%d to cab:%s", riderID, cabID)
+	// the cab filled up, changed status or route since it was read
+	return result == ride.AssignOK, nil
+}
+
+// offerDeadline is when an offer made now to the cab's driver expires,
+// zero when riders are assigned without asking. A cab without a driver
+// cannot be offered riders.
+func (w *Worker) offerDeadline(cabID string, driverID int) (time.Time, error) {
+	if w.OfferTimeout <= 0 {
+		return time.Time{}, nil
 	}
+	if driverID == 0 {
+		return time.Time{}, fmt.Errorf("cab:%s has no driver to offer riders to", cabID)
+	}
+	return time.Now().Add(w.OfferTimeout), nil
+}
 
-	return true, nil
+// sendOffer asks the cab's driver to accept the rider and acks the job
+// until the answer or the offer's deadline brings it back
+func (w *Worker) sendOffer(ctx context.Context, job Job, rider ride.Rider, offer *ride.Offer) {
+	w.offerDriver(ctx, rider, offer)
+	w.awaitAnswer(ctx, job, offer)
 }
 
-func computeRiderToleranceKm(detourFactor, directKm float64) float64 {
-	
-	tolerance := directKm * detourFactor 
+// awaitAnswer schedules a check of the open offer at its deadline and acks
+// the job. The driver's answer queues the request again by itself.
+func (w *Worker) awaitAnswer(ctx context.Context, job Job, offer *ride.Offer) {
+	if err := w.JobQueue.Delay(job.Message, time.Until(offer.ExpiresAt)); err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to schedule offer check", jobAttrs(job, logging.CabID(offer.CabID), logging.Err(err))...)
+		// the retry finds the offer open and schedules the check again
+		w.retry(ctx, job, err)
+		return
+	}
 
-	return tolerance
+	_ = job.Message.Ack()
 }
 
+// settleOffer acts on the rider's offer. It reports whether the job is
+// done: the offer is still open, was accepted or withdrawn, or is another
+// job's to act on. Otherwise the driver declined or let the offer expire
+// and the rider has to be matched again.
+//
+// A job back from the delay queue checks the offer at its deadline and
+// expires it if still open; an answered offer belongs to the job the
+// driver's answer queued. Any job finding an open offer before its
+// deadline, e.g. one redelivered before it was acked, schedules a check.
+func (w *Worker) settleOffer(ctx context.Context, job Job, rider ride.Rider, offer *ride.Offer) bool {
+	logger := w.Logger.With(logging.RiderID(rider.ID), logging.TripID(rider.TripID), logging.CabID(offer.CabID))
+
+	switch offer.Status {
+	case ride.OfferWithdrawn:
+		metrics.OfferAnswers.WithLabelValues(strings.ToLower(string(offer.Status))).Inc()
+		logger.InfoContext(ctx, "Rider left while offered to driver")
+		_ = job.Message.Ack()
+		return true
+
+	case ride.OfferOpen:
+		if time.Now().Before(offer.ExpiresAt) {
+			w.awaitAnswer(ctx, job, offer)
+			return true
+		}
+
+		_, err := w.Cabs.AnswerOffer(ctx, offer.CabID, rider.ID, ride.OfferExpired, time.Now())
+		if errors.Is(err, ride.ErrOfferClosed) || errors.Is(err, ride.ErrOfferNotFound) {
+			// the driver answered meanwhile or the rider requested a new ride
+			logger.InfoContext(ctx, "Offer closed before its check")
+			_ = job.Message.Ack()
+			return true
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to expire offer", logging.Err(err))
+			w.retry(ctx, job, err)
+			return true
+		}
+
+		metrics.OfferAnswers.WithLabelValues(strings.ToLower(string(ride.OfferExpired))).Inc()
+		logger.InfoContext(ctx, "Driver did not answer in time, matching again")
+		w.notifyOfferExpired(ctx, rider, offer.CabID)
+		return false
+	}
+
+	if job.Message.Delayed {
+		logger.DebugContext(ctx, "Offer answered before its check", "answer", offer.Status)
+		_ = job.Message.Ack()
+		return true
+	}
+
+	if offer.Status == ride.OfferAccepted {
+		metrics.OfferAnswers.WithLabelValues(strings.ToLower(string(offer.Status))).Inc()
+		logger.InfoContext(ctx, "Driver accepted rider")
+		w.recordAssignment(ctx, rider, offer.CabID)
+
+		_ = job.Message.Ack()
+		return true
+	}
+
+	if offer.Status == ride.OfferDeclined {
+		metrics.OfferAnswers.WithLabelValues(strings.ToLower(string(offer.Status))).Inc()
+	}
+	logger.InfoContext(ctx, "Driver did not take rider, matching again", "answer", offer.Status)
+	return false
+}
+
+// offerDriver asks the cab's driver to accept the rider
+func (w *Worker) offerDriver(ctx context.Context, rider ride.Rider, offer *ride.Offer) {
+	err := w.Drivers.PublishDriverEvent(ctx, events.DriverEvent{
+		Type:      events.TypeOffered,
+		CabID:     offer.CabID,
+		RiderID:   rider.ID,
+		TripID:    rider.TripID,
+		ExpiresAt: offer.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		w.Logger.WarnContext(ctx, "Failed to send offer to driver", logging.RiderID(rider.ID), logging.CabID(offer.CabID), logging.Err(err))
+	}
+}
+
+// notifyOfferExpired tells the driver the rider is no longer theirs to take
+func (w *Worker) notifyOfferExpired(ctx context.Context, rider ride.Rider, cabID string) {
+	err := w.Drivers.PublishDriverEvent(ctx, events.DriverEvent{
+		Type:    events.TypeOfferExpired,
+		CabID:   cabID,
+		RiderID: rider.ID,
+		TripID:  rider.TripID,
+	})
+	if err != nil {
+		w.Logger.WarnContext(ctx, "Failed to notify driver of expired offer", logging.RiderID(rider.ID), logging.CabID(cabID), logging.Err(err))
+	}
+}
 
+// recordAssignment persists the match on the rider's trip row and notifies
+// the rider and the driver. A trip that closed since the seat was taken
+// gets the seat released instead. The cab store stays the source of truth
+// for matching, so any other failure to persist is only logged.
+func (w *Worker) recordAssignment(ctx context.Context, rider ride.Rider, cabID string) {
+	logger := w.Logger.With(logging.RiderID(rider.ID), logging.TripID(rider.TripID), logging.CabID(cabID))
+
+	if rider.TripID != 0 {
+		err := w.TripRepo.AssignTripCab(ctx, ride.Trip{
+			TripID:    rider.TripID,
+			CabID:     cabID,
+			PickupLat: rider.Latitude,
+			PickupLng: rider.Longitude,
+			DropLat:   rider.DropLatitude,
+			DropLng:   rider.DropLongitude,
+		})
+		switch {
+		case errors.Is(err, ride.ErrTripConflict):
+			if w.tripRunsWith(ctx, rider.TripID, cabID) {
+				// a redelivered job recording the match again
+				break
+			}
+			logger.WarnContext(ctx, "Trip closed before the match was recorded, releasing the seat")
+			if err := w.Cabs.ReleaseSeat(ctx, cabID, rider.ID); err != nil {
+				logger.ErrorContext(ctx, "Failed to release seat of closed trip", logging.Err(err))
+			}
+			return
+		case err != nil:
+			logger.ErrorContext(ctx, "Failed to record assignment", logging.Err(err))
+		}
+	}
+
+	w.notifyDriver(ctx, rider, cabID)
+
+	err := w.Events.PublishRiderEvent(ctx, events.RiderEvent{
+		Type:    events.TypeStatus,
+		RiderID: rider.ID,
+		TripID:  rider.TripID,
+		Status:  "MATCHED",
+		CabID:   cabID,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to publish match", logging.Err(err))
+	}
+}
 
-func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371.0 // Earth radius in km
+// tripRunsWith reports whether the trip is already assigned to the cab and
+// still running. An unreadable trip counts as running, the seat is only
+// released for trips known to be closed.
+func (w *Worker) tripRunsWith(ctx context.Context, tripID int, cabID string) bool {
+	trip, err := w.TripRepo.GetTrip(ctx, tripID)
+	if err != nil {
+		w.Logger.WarnContext(ctx, "Failed to read trip of conflicting assignment", logging.TripID(tripID), logging.Err(err))
+		return true
+	}
+	return trip.CabID == cabID && trip.Status != ride.TripCancelled && trip.Status != ride.TripCompleted
+}
 
-	dLat := (lat2 - lat1) * math.Pi / 180
-	dLon := (lon2 - lon1) * math.Pi / 180
+// notifyDriver tells the cab's driver about the new rider on their route,
+// and that the pool is full once the last seat is taken
+func (w *Worker) notifyDriver(ctx context.Context, rider ride.Rider, cabID string) {
+	err := w.Drivers.PublishDriverEvent(ctx, events.DriverEvent{
+		Type:    events.TypeAssigned,
+		CabID:   cabID,
+		RiderID: rider.ID,
+		TripID:  rider.TripID,
+	})
+	if err != nil {
+		w.Logger.WarnContext(ctx, "Failed to notify driver of assignment", logging.RiderID(rider.ID), logging.CabID(cabID), logging.Err(err))
+	}
 
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
+	cab, err := w.Cabs.Cab(ctx, cabID)
+	if err != nil || cab.Status != ride.CabFull {
+		return
+	}
 
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
+	err = w.Drivers.PublishDriverEvent(ctx, events.DriverEvent{
+		Type:           events.TypePoolFull,
+		CabID:          cabID,
+		PassengerCount: cab.PassengerCount,
+		Capacity:       cab.Capacity,
+	})
+	if err != nil {
+		w.Logger.WarnContext(ctx, "Failed to notify driver of full pool", logging.CabID(cabID), logging.Err(err))
+	}
 }
 
-func randomCabID() string {
-	return uuid.NewString() 
+// jobAttrs are the attributes identifying a job in the logs, the job ID is
+// the rider's once the request was decoded
+func jobAttrs(job Job, attrs ...any) []any {
+	out := []any{slog.String("message_id", job.Message.ID)}
+	if job.ID != 0 {
+		out = append(out, logging.RiderID(int(job.ID)))
+	}
+	return append(out, attrs...)
 }
 
 
@@ -0,0 +1,335 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/driver"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/matching"
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/database/memory"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/queue"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/routing"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/store"
+	"github.com/mmcloughlin/geohash"
+)
+
+const (
+	pickupLat = 12.9716
+	pickupLng = 77.5946
+
+	nearCab = "cab-near"
+	farCab  = "cab-far"
+)
+
+// backend is a worker pool running on the in-memory queue and stores
+type backend struct {
+	jobs    *queue.Memory
+	cabs    *store.Memory
+	trips   ride.Repository
+	drivers driver.Service
+	riders  *events.Hub
+}
+
+// runPool starts a single worker pool with a driven cab at the pickup and
+// another one about half a kilometre away. configure adjusts the pool
+// before it runs.
+func runPool(t *testing.T, offerTimeout time.Duration, nearDriver int, configure ...func(p *Pool)) backend {
+	t.Helper()
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	b := backend{
+		jobs:   queue.NewMemoryQueue(queue.RetryOptions{MaxRetries: 50, BaseDelay: 20 * time.Millisecond}, logger),
+		cabs:   store.NewMemoryStore(),
+		trips:  memory.NewRideRepository(),
+		riders: events.NewLocalHub(),
+	}
+	b.drivers = driver.NewDriverService(b.cabs, events.NewLocalHub(), b.jobs, memory.NewDriverRepository(), logger)
+
+	cabs := []ride.CabState{
+		{ID: nearCab, DriverID: nearDriver, Latitude: pickupLat, Longitude: pickupLng},
+		{ID: farCab, DriverID: 2, Latitude: pickupLat, Longitude: pickupLng + 0.005},
+	}
+	for _, cab := range cabs {
+		cab.Geohash = geohash.EncodeWithPrecision(cab.Latitude, cab.Longitude, 6)
+		cab.Capacity = 4
+		cab.LuggageCapacity = 2
+		cab.VehicleClass = ride.VehicleSedan
+		cab.LastUpdate = time.Now().Unix()
+		if err := b.cabs.GoOnline(ctx, cab); err != nil {
+			t.Fatalf("GoOnline: %v", err)
+		}
+	}
+
+	router := routing.NewHaversineRouter(0)
+	matchers, err := matching.NewSelector(matching.StrategyGreedy, nil, 0, router)
+	if err != nil {
+		t.Fatalf("NewSelector: %v", err)
+	}
+
+	pool := NewPool(1, b.jobs, 50, b.cabs, b.cabs, b.riders, events.NewLocalDriverHub(), b.trips, matchers, router, logger)
+	pool.OfferTimeout = offerTimeout
+	for _, c := range configure {
+		c(&pool)
+	}
+	go pool.Run()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		pool.Stop(ctx)
+	})
+
+	return b
+}
+
+// requestRide queues a ride request from the pickup the way the ride
+// service does
+func (b backend) requestRide(t *testing.T) ride.Rider {
+	t.Helper()
+	ctx := context.Background()
+
+	tripID, err := b.trips.CreateTrip(ctx, 7)
+	if err != nil {
+		t.Fatalf("CreateTrip: %v", err)
+	}
+
+	rider := ride.Rider{
+		ID:            7,
+		TripID:        tripID,
+		Geohash:       geohash.EncodeWithPrecision(pickupLat, pickupLng, 6),
+		Latitude:      pickupLat,
+		Longitude:     pickupLng,
+		Tolerance:     2,
+		DropLatitude:  pickupLat + 0.05,
+		DropLongitude: pickupLng,
+	}
+	if err := b.cabs.AddRider(ctx, rider); err != nil {
+		t.Fatalf("AddRider: %v", err)
+	}
+
+	body, _ := json.Marshal(rider)
+	if err := b.jobs.Publish(ctx, body); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	return rider
+}
+
+// waitFor polls until the condition holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// riderIn reports whether the rider is in the status with the cab
+func (b backend) riderIn(rider ride.Rider, status, cabID string) func() bool {
+	return func() bool {
+		got, gotCab, err := b.cabs.RiderStatus(context.Background(), rider.ID)
+		return err == nil && got == status && gotCab == cabID
+	}
+}
+
+// offeredTo reports whether the rider's latest offer went to the cab
+func (b backend) offeredTo(rider ride.Rider, cabID string) func() bool {
+	return func() bool {
+		offer, err := b.cabs.Offer(context.Background(), rider.ID)
+		return err == nil && offer.CabID == cabID
+	}
+}
+
+// assertTripCab checks the match made it to the rider's trip
+func (b backend) assertTripCab(t *testing.T, rider ride.Rider, cabID string) {
+	t.Helper()
+
+	waitFor(t, "the trip is assigned to "+cabID, func() bool {
+		trip, err := b.trips.GetTrip(context.Background(), rider.TripID)
+		return err == nil && trip.CabID == cabID
+	})
+}
+
+func TestMatchRide(t *testing.T) {
+	t.Run("assigned to the nearest cab", func(t *testing.T) {
+		b := runPool(t, 0, 1)
+		rider := b.requestRide(t)
+
+		waitFor(t, "the rider is matched", b.riderIn(rider, "MATCHED", nearCab))
+		b.assertTripCab(t, rider, nearCab)
+
+		if _, err := b.cabs.Offer(context.Background(), rider.ID); err == nil {
+			t.Error("rider was offered although offers are off")
+		}
+	})
+
+	t.Run("offer accepted", func(t *testing.T) {
+		b := runPool(t, time.Minute, 1)
+		rider := b.requestRide(t)
+
+		waitFor(t, "the rider is offered", b.riderIn(rider, string(ride.OfferOpen), nearCab))
+
+		if err := b.drivers.AnswerOffer(context.Background(), nearCab, rider.ID, true); err != nil {
+			t.Fatalf("AnswerOffer: %v", err)
+		}
+
+		waitFor(t, "the rider is matched", b.riderIn(rider, "MATCHED", nearCab))
+		b.assertTripCab(t, rider, nearCab)
+	})
+
+	t.Run("offer declined goes to the next cab", func(t *testing.T) {
+		b := runPool(t, time.Minute, 1)
+		rider := b.requestRide(t)
+
+		waitFor(t, "the rider is offered", b.riderIn(rider, string(ride.OfferOpen), nearCab))
+
+		if err := b.drivers.AnswerOffer(context.Background(), nearCab, rider.ID, false); err != nil {
+			t.Fatalf("AnswerOffer: %v", err)
+		}
+
+		waitFor(t, "the rider is offered to the far cab", b.riderIn(rider, string(ride.OfferOpen), farCab))
+	})
+
+	t.Run("offer expired goes to the next cab", func(t *testing.T) {
+		b := runPool(t, 100*time.Millisecond, 1)
+		rider := b.requestRide(t)
+
+		waitFor(t, "the rider is offered to the far cab", b.offeredTo(rider, farCab))
+
+		declined, _ := b.cabs.DeclinedCabs(context.Background(), rider.ID)
+		if !slices.Contains(declined, nearCab) {
+			t.Errorf("declined cabs = %v, want %s whose offer expired", declined, nearCab)
+		}
+	})
+
+	t.Run("cab without a driver is not offered riders", func(t *testing.T) {
+		b := runPool(t, time.Minute, 0)
+		rider := b.requestRide(t)
+
+		waitFor(t, "the rider is offered to the far cab", b.riderIn(rider, string(ride.OfferOpen), farCab))
+
+		cab, _ := b.cabs.Cab(context.Background(), nearCab)
+		if cab.PassengerCount != 0 {
+			t.Errorf("driverless cab holds %d passengers", cab.PassengerCount)
+		}
+	})
+
+	t.Run("stale request is dropped", func(t *testing.T) {
+		b := runPool(t, 0, 1)
+		ctx := context.Background()
+
+		// the rider asked again before the first request was matched
+		first := b.requestRide(t)
+		second := b.requestRide(t)
+
+		waitFor(t, "the rider is matched", b.riderIn(second, "MATCHED", nearCab))
+		b.assertTripCab(t, second, nearCab)
+
+		time.Sleep(50 * time.Millisecond)
+		cab, _ := b.cabs.Cab(ctx, nearCab)
+		if cab.PassengerCount != 1 {
+			t.Errorf("cab holds %d passengers, want the second request only", cab.PassengerCount)
+		}
+		if trip, _ := b.trips.GetTrip(ctx, first.TripID); trip.CabID != "" {
+			t.Errorf("stale trip %d got cab %q", first.TripID, trip.CabID)
+		}
+	})
+
+	t.Run("rider no cab takes in time is given up", func(t *testing.T) {
+		b := runPool(t, 0, 1, func(p *Pool) {
+			p.Wait = WaitOptions{Limit: 300 * time.Millisecond, Interval: 20 * time.Millisecond}
+		})
+		ctx := context.Background()
+
+		for _, cabID := range []string{nearCab, farCab} {
+			if err := b.cabs.GoOffline(ctx, cabID); err != nil {
+				t.Fatalf("GoOffline: %v", err)
+			}
+		}
+
+		riderEvents, unsubscribe := b.riders.Subscribe(7)
+		defer unsubscribe()
+
+		rider := b.requestRide(t)
+
+		select {
+		case e := <-riderEvents:
+			if e.Status != events.StatusNoCab || e.TripID != rider.TripID {
+				t.Fatalf("rider got %+v, want %s for trip %d", e, events.StatusNoCab, rider.TripID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the rider to be told no cab was found")
+		}
+
+		if trip, _ := b.trips.GetTrip(ctx, rider.TripID); trip.Status != ride.TripCancelled {
+			t.Errorf("trip status = %s, want %s", trip.Status, ride.TripCancelled)
+		}
+		if _, _, err := b.cabs.RiderStatus(ctx, rider.ID); !errors.Is(err, ride.ErrRiderNotFound) {
+			t.Errorf("RiderStatus err = %v, want the rider's state cleared", err)
+		}
+		if waiting, _ := b.cabs.WaitingCount(ctx, rider.Geohash); waiting != 0 {
+			t.Errorf("%d riders left in the waiting pool", waiting)
+		}
+		if dead, _ := b.jobs.PeekDeadLetters(10); len(dead) != 0 {
+			t.Errorf("waiting for a cab dead-lettered %d jobs", len(dead))
+		}
+	})
+}
+
+func TestRecordAssignmentOfClosedTrip(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	cabs := store.NewMemoryStore()
+	trips := memory.NewRideRepository()
+	w := &Worker{
+		Cabs:     cabs,
+		Events:   events.NewLocalHub(),
+		Drivers:  events.NewLocalDriverHub(),
+		TripRepo: trips,
+		Logger:   logger,
+	}
+
+	if err := cabs.GoOnline(ctx, ride.CabState{ID: nearCab, DriverID: 1, Geohash: "tdr1v9", Capacity: 4, LuggageCapacity: 2}); err != nil {
+		t.Fatalf("GoOnline: %v", err)
+	}
+
+	tripID, _ := trips.CreateTrip(ctx, 7)
+	rider := ride.Rider{ID: 7, TripID: tripID, Geohash: "tdr1v9"}
+	if err := cabs.AddRider(ctx, rider); err != nil {
+		t.Fatalf("AddRider: %v", err)
+	}
+
+	cab, _ := cabs.Cab(ctx, nearCab)
+	stops := []ride.Stop{{RiderID: 7, TripID: tripID, Kind: ride.StopPickup, Seats: 1}, {RiderID: 7, TripID: tripID, Kind: ride.StopDrop, Seats: 1}}
+	if result, err := cabs.AssignRider(ctx, nearCab, rider, cab.StopsVersion, stops); err != nil || result != ride.AssignOK {
+		t.Fatalf("AssignRider = %v, %v", result, err)
+	}
+
+	// the rider cancels between the seat being taken and the match recorded
+	if err := trips.TransitionTrip(ctx, tripID, ride.TripCreated, ride.TripCancelled); err != nil {
+		t.Fatalf("TransitionTrip: %v", err)
+	}
+
+	w.recordAssignment(ctx, rider, nearCab)
+
+	cab, _ = cabs.Cab(ctx, nearCab)
+	if cab.PassengerCount != 0 {
+		t.Errorf("cab holds %d passengers after the trip closed, want the seat released", cab.PassengerCount)
+	}
+	if stops, _ := cabs.Stops(ctx, nearCab); len(stops) != 0 {
+		t.Errorf("cab keeps stops %+v of the closed trip", stops)
+	}
+}
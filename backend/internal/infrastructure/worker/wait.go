@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/mahimapatel13/ride-sharing-system/internal/domain/ride"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/events"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/logging"
+	"github.com/mahimapatel13/ride-sharing-system/internal/infrastructure/metrics"
+)
+
+// WaitOptions bounds how long a rider no cab can take is matched again.
+// Waiting does not use up the job's retries.
+type WaitOptions struct {
+	// Limit is how long after the ride request the trip is cancelled
+	Limit time.Duration
+	// Interval is how long the job waits before matching again
+	Interval time.Duration
+}
+
+// defaultWait is used unless the pool is configured otherwise
+var defaultWait = WaitOptions{Limit: 2 * time.Minute, Interval: 5 * time.Second}
+
+// waitForCab postpones the job until cabs free up or move closer, or gives
+// up on the rider once they waited Wait.Limit since the trip was created.
+// Jobs without a trip are retried instead, there is no telling how long
+// their rider waited.
+func (w *Worker) waitForCab(ctx context.Context, job Job, rider ride.Rider, reason error) {
+	if rider.TripID == 0 || w.ctx.Err() != nil {
+		w.retry(ctx, job, reason)
+		return
+	}
+
+	trip, err := w.TripRepo.GetTrip(ctx, rider.TripID)
+	if err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to read trip of waiting rider", jobAttrs(job, logging.TripID(rider.TripID), logging.Err(err))...)
+		w.retry(ctx, job, err)
+		return
+	}
+
+	waited := time.Since(trip.CreatedAt)
+	if waited >= w.Wait.Limit {
+		w.Logger.InfoContext(ctx, "Rider waited too long for a cab", jobAttrs(job, logging.TripID(rider.TripID), slog.Duration("waited", waited))...)
+		if err := w.abandon(ctx, rider); err != nil {
+			w.Logger.ErrorContext(ctx, "Failed to give up on rider", jobAttrs(job, logging.TripID(rider.TripID), logging.Err(err))...)
+			w.retry(ctx, job, err)
+			return
+		}
+		_ = job.Message.Ack()
+		return
+	}
+
+	after := min(w.Wait.Interval, w.Wait.Limit-waited)
+	if err := w.JobQueue.Postpone(job.Message, after); err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to postpone job", jobAttrs(job, logging.Err(err))...)
+		w.retry(ctx, job, err)
+		return
+	}
+
+	w.Logger.DebugContext(ctx, "Waiting for a cab", jobAttrs(job, logging.TripID(rider.TripID), slog.Duration("after", after))...)
+	_ = job.Message.Ack()
+}
+
+// abandonJob gives up on the rider of a job that exhausted its retries.
+// Failures are only logged, the job is dead-lettered either way.
+func (w *Worker) abandonJob(ctx context.Context, job Job) {
+	var rider ride.Rider
+	if err := json.Unmarshal(job.Message.Body, &rider); err != nil {
+		return
+	}
+
+	if err := w.abandon(ctx, rider); err != nil {
+		w.Logger.ErrorContext(ctx, "Failed to give up on rider", jobAttrs(job, logging.TripID(rider.TripID), logging.Err(err))...)
+	}
+}
+
+// abandon cancels the trip of a rider no cab took, clears the rider's
+// state and tells them, whether or not their socket is still open. Riders
+// who were matched, offered, cancelled or asked again meanwhile are left
+// alone.
+func (w *Worker) abandon(ctx context.Context, rider ride.Rider) error {
+	logger := w.Logger.With(logging.RiderID(rider.ID), logging.TripID(rider.TripID))
+
+	status, _, err := w.Riders.RiderStatus(ctx, rider.ID)
+	if errors.Is(err, ride.ErrRiderNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != "PENDING" {
+		logger.InfoContext(ctx, "Rider no longer waits for a cab", "status", status)
+		return nil
+	}
+
+	if rider.TripID != 0 {
+		err := w.TripRepo.TransitionTrip(ctx, rider.TripID, ride.TripCreated, ride.TripCancelled)
+		if errors.Is(err, ride.ErrTripConflict) {
+			logger.InfoContext(ctx, "Trip no longer waits for a cab")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.Riders.RemoveFromWaitingPool(ctx, rider.ID, rider.Geohash); err != nil {
+		logger.WarnContext(ctx, "Failed to remove rider from waiting pool", logging.Err(err))
+	}
+	if err := w.Riders.DeleteRider(ctx, rider.ID); err != nil {
+		logger.WarnContext(ctx, "Failed to delete rider state", logging.Err(err))
+	}
+
+	metrics.NoCab.Inc()
+	logger.InfoContext(ctx, "Cancelled trip no cab took")
+
+	err = w.Events.PublishRiderEvent(ctx, events.RiderEvent{
+		Type:    events.TypeStatus,
+		RiderID: rider.ID,
+		TripID:  rider.TripID,
+		Status:  events.StatusNoCab,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to tell rider no cab was found", logging.Err(err))
+	}
+
+	return nil
+}
@@ -1,5 +1,5 @@
 import { useState } from "react";
-import { API_BASE } from "@/config/constants";
+import { API_BASE, RIDE_PROTOCOL } from "@/config/constants";
 
 interface BookingPanelProps {
   pickup: { lat: number; lng: number } | null;
@@ -8,9 +8,9 @@ interface BookingPanelProps {
 }
 
 const BookingPanel = ({ pickup, onBooked, disabled }: BookingPanelProps) => {
-  const [riderId, setRiderId] = useState("1");
+  const [accessToken, setAccessToken] = useState("");
   const [luggage, setLuggage] = useState("1");
-  const [tolerance, setTolerance] = useState("5");
+  const [tolerance, setTolerance] = useState("0.3");
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
@@ -21,19 +21,25 @@ const handleBook = () => {
   setError(null);
 
   try {
-    const ws = new WebSocket(`${API_BASE.replace("http", "ws")}/ride/request`);
+    // browsers cannot set the Authorization header on a WebSocket upgrade
+    const ws = new WebSocket(
+      `${API_BASE.replace("http", "ws")}/ride/request?access_token=${encodeURIComponent(accessToken)}`,
+      RIDE_PROTOCOL
+    );
 
     ws.onopen = () => {
       console.log("WebSocket connected");
 
-      // Send booking request over WS
+      // Send booking request over WS, see src/protocol/ride.v1.schema.json
       ws.send(
         JSON.stringify({
-          RiderID: parseInt(riderId),
-          Luggage: parseInt(luggage),
-          Lat: pickup.lat,
-          Lng: pickup.lng,
-          Tolerance: parseInt(tolerance),
+          type: "REQUEST",
+          payload: {
+            luggage: parseInt(luggage),
+            lat: pickup.lat,
+            lng: pickup.lng,
+            tolerance: parseFloat(tolerance),
+          },
         })
       );
     };
@@ -42,14 +48,14 @@ const handleBook = () => {
       const msg = JSON.parse(event.data);
       console.log("WS message:", msg);
 
-      if (msg.status === "MATCHED") {
+      if (msg.type === "MATCHED") {
         onBooked();
         ws.close();
-      } else if (msg.status === "CANCELLED") {
+      } else if (msg.type === "STATUS" && msg.payload?.status === "CANCELLED") {
         setError("Ride cancelled");
         ws.close();
-      } else if (msg.type === "error") {
-        setError(msg.message || "Booking failed");
+      } else if (msg.type === "ERROR") {
+        setError(msg.payload?.message || "Booking failed");
         ws.close();
       }
     };
@@ -83,12 +89,12 @@ const handleBook = () => {
         <div className="grid grid-cols-3 gap-3">
           <div>
             <label className="airport-label text-muted-foreground block mb-1">
-              Rider ID
+              Access Token
             </label>
             <input
-              type="number"
-              value={riderId}
-              onChange={(e) => setRiderId(e.target.value)}
+              type="password"
+              value={accessToken}
+              onChange={(e) => setAccessToken(e.target.value)}
               className="brutal-input w-full px-3 py-2 text-sm font-mono"
               disabled={disabled}
             />
@@ -111,6 +117,7 @@ const handleBook = () => {
             </label>
             <input
               type="number"
+              step="0.1"
               value={tolerance}
               onChange={(e) => setTolerance(e.target.value)}
               className="brutal-input w-full px-3 py-2 text-sm font-mono"
@@ -1,3 +1,5 @@
+import rideProtocol from "@/protocol/ride.v1.schema.json";
+
 export const AIRPORT = {
   lat: 23.2875,
   lng: 77.3370,
@@ -10,3 +12,6 @@ export const API_BASE = "http://localhost:8081/api/v1";
 
 // WebSocket base (derived from API_BASE or set separately)
 export const WS_BASE = API_BASE.replace(/^http/, "ws");
+
+// WebSocket subprotocol of the ride request socket
+export const RIDE_PROTOCOL: string = rideProtocol["x-subprotocol"];